@@ -1,67 +1,79 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
 
+	"wywk/archive"
+	"wywk/drift"
+	"wywk/gateway"
+	"wywk/inventory"
+	"wywk/layout"
 	. "wywk/models"
+	"wywk/report"
 )
 
-func GetShopStats(db *gorm.DB, commonCode string) (string, string, error) {
-	shopInfo, err := getShopInfo("https://vip-gateway.wywk.cn", commonCode)
+func GetShopStats(db *gorm.DB, commonCode string) (*report.Report, string, error) {
+	// 同一次抓取的两个响应共用一个时间，归档和快照都以它为准
+	at := time.Now().UTC().Truncate(time.Second)
+	shopInfo, err := getShopInfo(db, commonCode, at)
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	shop, err := createOrUpdateShop(db, commonCode, shopInfo)
 	if err != nil {
-		return "", "", err
+		return nil, "", err
 	}
 
 	if shopInfo.Data.ShopStatus != "营业中" {
-		handleNonOperatingStatus(db, shop.ID, shopInfo.Data.ShopStatus)
-		return fmt.Sprintf(`店名: %s
-地址: %s
-状态: %s`, shop.Name, shop.Address, shopInfo.Data.ShopStatus), shop.Name, nil
+		handleNonOperatingStatus(db, shop.ID, shopInfo.Data.ShopStatus, at)
+		r := &report.Report{Title: fmt.Sprintf("【%s】实时状态", shop.Name), Group: shop.Name}
+		section := r.AddSection("")
+		section.AddMetric("地址", shop.Address)
+		section.AddMetric("状态", shopInfo.Data.ShopStatus)
+		return r, shop.Name, nil
 	}
 
-	detailResponse, err := getShopDetails(commonCode)
+	detailResponse, err := getShopDetails(db, commonCode, at)
 	if err != nil {
-		return "", shop.Name, err
+		return nil, shop.Name, err
 	}
 
 	totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties := processShopData(detailResponse)
 
-	err = saveShopData(db, shop, totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties)
+	err = saveShopData(db, shop, at, totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties, false)
 	if err != nil {
-		return "", shop.Name, err
+		return nil, shop.Name, err
+	}
+	if err := layout.Check(db, shop, detailResponse, at); err != nil {
+		log.Printf("Failed to check layout of %s: %v", shop.Name, err)
+	}
+	if err := inventory.Update(db, shop, detailResponse, at); err != nil {
+		log.Printf("Failed to update device inventory of %s: %v", shop.Name, err)
 	}
 
-	notification := formatNotification(shop, totalDevices, usedDevices, roomStats, roomCodeToName)
-	return notification, shop.Name, nil
+	r := buildStatusReport(shop, totalDevices, usedDevices, roomStats, roomCodeToName)
+	return r, shop.Name, nil
 }
 
-func getShopInfo(baseURL, commonCode string) (*ShopInfoResponse, error) {
-	shopInfoURL := fmt.Sprintf("%s/asset-svc/shop/store/portal/baseMessage?commonCode=%s", baseURL, commonCode)
-	resp, err := http.Get(shopInfoURL)
+func getShopInfo(db *gorm.DB, commonCode string, at time.Time) (*ShopInfoResponse, error) {
+	body, err := gateway.Default().Get("/asset-svc/shop/store/portal/baseMessage", url.Values{"commonCode": {commonCode}})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get shop info: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	observeResponse(db, commonCode, archive.Info, at, body, &ShopInfoResponse{})
+	return parseShopInfo(body)
+}
 
+func parseShopInfo(body []byte) (*ShopInfoResponse, error) {
 	var shopInfoResponse ShopInfoResponse
 	if err := json.Unmarshal(body, &shopInfoResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse shop info JSON: %w", err)
@@ -69,11 +81,41 @@ func getShopInfo(baseURL, commonCode string) (*ShopInfoResponse, error) {
 	return &shopInfoResponse, nil
 }
 
+// observeResponse archives the raw body for replay and checks it for schema drift against
+// model; neither ever fails the crawl. Error and maintenance responses are archived but not
+// checked, since their shape says nothing about the data the crawl reads.
+func observeResponse(db *gorm.DB, commonCode, kind string, at time.Time, body []byte, model any) {
+	if err := archive.Save(commonCode, kind, at, body); err != nil {
+		log.Printf("Failed to archive %s response of %s: %v", kind, commonCode, err)
+	}
+	if !succeeded(body) {
+		return
+	}
+	if err := drift.Check(db, commonCode, kind, body, model); err != nil {
+		log.Printf("Failed to check %s response of %s for schema drift: %v", kind, commonCode, err)
+	}
+}
+
+// succeeded reports whether body is a gateway response with code 0, or without a code at all.
+func succeeded(body []byte) bool {
+	var status struct {
+		Code json.RawMessage `json:"code"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return false
+	}
+	code := strings.Trim(string(status.Code), `"`)
+	return code == "" || code == "0" || code == "null"
+}
+
 func createOrUpdateShop(db *gorm.DB, commonCode string, shopInfo *ShopInfoResponse) (*Shop, error) {
 	shop := Shop{
 		CommonCode: commonCode,
 		Name:       shopInfo.Data.StoreName,
 		Address:    shopInfo.Data.StoreAddress,
+		// 上游未提供坐标时为零值，Assign 会跳过零值，不会覆盖已有坐标
+		Latitude:  float64(shopInfo.Data.Latitude),
+		Longitude: float64(shopInfo.Data.Longitude),
 	}
 	if err := db.Where(Shop{CommonCode: commonCode}).Assign(shop).FirstOrCreate(&shop).Error; err != nil {
 		return nil, fmt.Errorf("failed to save shop to DB: %w", err)
@@ -81,10 +123,10 @@ func createOrUpdateShop(db *gorm.DB, commonCode string, shopInfo *ShopInfoRespon
 	return &shop, nil
 }
 
-func handleNonOperatingStatus(db *gorm.DB, shopID uint, status string) {
+func handleNonOperatingStatus(db *gorm.DB, shopID uint, status string, at time.Time) {
 	snapshot := Snapshot{
 		ShopID:     shopID,
-		Timestamp:  time.Now(),
+		Timestamp:  at,
 		ShopStatus: status,
 	}
 	if err := db.Create(&snapshot).Error; err != nil {
@@ -92,29 +134,16 @@ func handleNonOperatingStatus(db *gorm.DB, shopID uint, status string) {
 	}
 }
 
-func getShopDetails(commonCode string) (*DetailResponse, error) {
-	apiURL := "https://vip-gateway.wywk.cn/surf-internet/shop/v3/get"
-	payload := map[string]string{"commonCode": commonCode}
-	jsonPayload, _ := json.Marshal(payload)
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+func getShopDetails(db *gorm.DB, commonCode string, at time.Time) (*DetailResponse, error) {
+	body, err := gateway.Default().Post("/surf-internet/shop/v3/get", map[string]string{"commonCode": commonCode})
 	if err != nil {
 		return nil, err
 	}
+	observeResponse(db, commonCode, archive.Detail, at, body, &DetailResponse{})
+	return parseShopDetails(body)
+}
 
+func parseShopDetails(body []byte) (*DetailResponse, error) {
 	var detailResponse DetailResponse
 	if err := json.Unmarshal(body, &detailResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse detailed shop data JSON: %w", err)
@@ -183,17 +212,20 @@ func processShopData(detailResponse *DetailResponse) (int, int, map[string]map[s
 	return totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties
 }
 
-func saveShopData(db *gorm.DB, shop *Shop, totalDevices int, usedDevices int, roomStats map[string]map[string]int, roomCodeToName map[string]string, physicalRoomProperties map[int]RoomProperties) error {
+// saveShopData stores a snapshot of shop at at and updates its rooms. For a replay, renames
+// are placed in the rooms' history by at, and rooms keep their current name and properties
+// when at is older than their latest snapshot, since the capture no longer describes them.
+func saveShopData(db *gorm.DB, shop *Shop, at time.Time, totalDevices int, usedDevices int, roomStats map[string]map[string]int, roomCodeToName map[string]string, physicalRoomProperties map[int]RoomProperties, replay bool) error {
 	mainSnapshot := Snapshot{
 		ShopID:     shop.ID,
-		Timestamp:  time.Now(),
+		Timestamp:  at,
 		ShopStatus: "营业中",
 	}
 
 	return db.Transaction(func(tx *gorm.DB) error {
 		mainSnapshot.TotalDevices = totalDevices
 		mainSnapshot.UsedDevices = usedDevices
-		mainSnapshot.UsageRate = float64(usedDevices) / float64(totalDevices) * 100
+		mainSnapshot.UsageRate = usageRate(usedDevices, totalDevices)
 		if err := tx.Create(&mainSnapshot).Error; err != nil {
 			return fmt.Errorf("failed to save main snapshot: %w", err)
 		}
@@ -204,21 +236,53 @@ func saveShopData(db *gorm.DB, shop *Shop, totalDevices int, usedDevices int, ro
 			roomDetails, detailsFound := physicalRoomProperties[roomID]
 
 			var existingRoom Room
-			if err := tx.Where(Room{Code: roomCode}).FirstOrInit(&existingRoom).Error; err != nil {
+			if err := tx.Where(Room{ShopID: shop.ID, Code: roomCode}).FirstOrInit(&existingRoom).Error; err != nil {
 				return fmt.Errorf("failed to find or init room %s: %w", roomName, err)
 			}
 
-			if detailsFound {
-				existingRoom.NoSmoking = roomDetails.NoSmoking
-				existingRoom.Width = roomDetails.Width
-				existingRoom.Height = roomDetails.Height
+			outdated := false
+			previousName := existingRoom.Name
+			if replay && existingRoom.ID != 0 {
+				var latest Snapshot
+				err := tx.Where("id IN (SELECT snapshot_id FROM room_snapshots WHERE room_id = ?)", existingRoom.ID).
+					Order("timestamp DESC").Limit(1).Find(&latest).Error
+				if err != nil {
+					return fmt.Errorf("failed to find latest snapshot of room %s: %w", roomCode, err)
+				}
+				outdated = latest.ID != 0 && at.Before(latest.Timestamp)
+				// 回放的数据可能早于现有记录，要和当时的房名比较，而不是现在的
+				if previousName, err = nameAt(tx, &existingRoom, at); err != nil {
+					return fmt.Errorf("failed to find name of room %s: %w", roomCode, err)
+				}
 			}
-			existingRoom.ShopID = shop.ID
-			existingRoom.Name = roomName
-			existingRoom.TotalDevices = stats["total"]
 
-			if err := tx.Save(&existingRoom).Error; err != nil {
-				return fmt.Errorf("failed to save room %s to DB: %w", roomName, err)
+			// 同一编号的房间改名时记录下来
+			if existingRoom.ID != 0 && roomName != "" && previousName != roomName {
+				log.Printf("Room %s of %s renamed from %s to %s", roomCode, shop.Name, previousName, roomName)
+				change := RoomNameChange{RoomID: existingRoom.ID, OldName: previousName, NewName: roomName, ChangedAt: at}
+				if err := tx.Create(&change).Error; err != nil {
+					return fmt.Errorf("failed to record rename of room %s: %w", roomCode, err)
+				}
+				if replay {
+					if err := mergeNextRename(tx, &change); err != nil {
+						return fmt.Errorf("failed to update rename history of room %s: %w", roomCode, err)
+					}
+				}
+			}
+
+			if !outdated {
+				if detailsFound {
+					existingRoom.NoSmoking = roomDetails.NoSmoking
+					existingRoom.Width = roomDetails.Width
+					existingRoom.Height = roomDetails.Height
+				}
+				existingRoom.ShopID = shop.ID
+				existingRoom.Name = roomName
+				existingRoom.TotalDevices = stats["total"]
+
+				if err := tx.Save(&existingRoom).Error; err != nil {
+					return fmt.Errorf("failed to save room %s to DB: %w", roomName, err)
+				}
 			}
 
 			roomSnapshot := RoomSnapshot{
@@ -226,7 +290,7 @@ func saveShopData(db *gorm.DB, shop *Shop, totalDevices int, usedDevices int, ro
 				RoomID:       existingRoom.ID,
 				TotalDevices: stats["total"],
 				UsedDevices:  stats["used"],
-				UsageRate:    float64(stats["used"]) / float64(stats["total"]) * 100,
+				UsageRate:    usageRate(stats["used"], stats["total"]),
 			}
 			if err := tx.Create(&roomSnapshot).Error; err != nil {
 				return fmt.Errorf("failed to save room snapshot for %s: %w", roomName, err)
@@ -237,30 +301,38 @@ func saveShopData(db *gorm.DB, shop *Shop, totalDevices int, usedDevices int, ro
 	})
 }
 
-func formatNotification(shop *Shop, totalDevices int, usedDevices int, roomStats map[string]map[string]int, roomCodeToName map[string]string) string {
-	var result strings.Builder
-	result.WriteString(fmt.Sprintf(`店名: %s
-地址: %s
-`, shop.Name, shop.Address))
-	result.WriteString(fmt.Sprintf(`总设备: %d, 在用: %d
-`, totalDevices, usedDevices))
+// usageRate is used as a percentage of total, 0 when there are no devices at all.
+func usageRate(used, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
+
+// buildStatusReport summarizes the current usage of a shop and each of its rooms.
+func buildStatusReport(shop *Shop, totalDevices int, usedDevices int, roomStats map[string]map[string]int, roomCodeToName map[string]string) *report.Report {
+	r := &report.Report{Title: fmt.Sprintf("【%s】实时状态", shop.Name), Group: shop.Name}
+	summary := r.AddSection("")
+	summary.AddMetric("地址", shop.Address)
+	summary.AddMetric("总设备", fmt.Sprintf("%d, 在用: %d", totalDevices, usedDevices))
 	if totalDevices > 0 {
-		usageRate := float64(usedDevices) / float64(totalDevices) * 100
-		result.WriteString(fmt.Sprintf(`总使用率: %.2f%%
+		summary.AddMetric("总使用率", fmt.Sprintf("%.2f%%", usageRate(usedDevices, totalDevices)))
+	}
 
-`, usageRate))
+	roomCodes := make([]string, 0, len(roomStats))
+	for roomCode := range roomStats {
+		roomCodes = append(roomCodes, roomCode)
 	}
+	sort.Slice(roomCodes, func(i, j int) bool { return roomCodeToName[roomCodes[i]] < roomCodeToName[roomCodes[j]] })
 
-	result.WriteString(`各房间使用率:
-`)
-	for roomCode, stats := range roomStats {
+	rooms := r.AddSection("各房间使用率")
+	for _, roomCode := range roomCodes {
+		stats := roomStats[roomCode]
 		if stats["total"] > 0 {
 			roomName := roomCodeToName[roomCode]
-			roomUsageRate := float64(stats["used"]) / float64(stats["total"]) * 100
-			result.WriteString(fmt.Sprintf(`%s: %.2f%% (%d/%d)
-`, roomName, roomUsageRate, stats["used"], stats["total"]))
+			rooms.AddMetric(roomName, fmt.Sprintf("%.2f%% (%d/%d)", usageRate(stats["used"], stats["total"]), stats["used"], stats["total"]))
 		}
 	}
 
-	return result.String()
+	return r
 }
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/archive"
+	"wywk/db"
+	"wywk/drift"
+	. "wywk/models"
+)
+
+// openTestDB returns a migrated SQLite database in a temporary directory.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database := db.Connect(filepath.Join(t.TempDir(), "test.db"))
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+func TestUsageRate(t *testing.T) {
+	tests := []struct {
+		used, total int
+		want        float64
+	}{
+		{0, 0, 0},
+		{3, 0, 0},
+		{0, 10, 0},
+		{5, 10, 50},
+		{10, 10, 100},
+		{1, 3, 100.0 / 3},
+	}
+	for _, tt := range tests {
+		got := usageRate(tt.used, tt.total)
+		if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("usageRate(%d, %d) = %v, want %v", tt.used, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestSucceeded(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"code": 0, "data": {}}`, true},
+		{`{"code": "0", "data": {}}`, true},
+		{`{"data": {"storeName": "店"}}`, true},
+		{`{"code": 500, "message": "系统维护中", "data": null}`, false},
+		{`{"code": "A0001", "message": "error"}`, false},
+		{`<html>502 Bad Gateway</html>`, false},
+	}
+	for _, tt := range tests {
+		if got := succeeded([]byte(tt.body)); got != tt.want {
+			t.Errorf("succeeded(%s) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestObserveResponseSkipsErrors(t *testing.T) {
+	database := openTestDB(t)
+	defer archive.SetDir(archive.Dir())
+	archive.SetDir(t.TempDir())
+	defer func(onChange func(string, string, []string, []string)) { drift.OnChange = onChange }(drift.OnChange)
+	var alerts [][]string
+	drift.OnChange = func(commonCode, endpoint string, changes, unknown []string) {
+		alerts = append(alerts, changes)
+	}
+
+	at := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	bodies := []string{
+		`{"code": 0, "message": null, "data": {"commonCode": "A", "areas": []}}`,
+		`{"code": 500, "message": "系统维护中", "data": null, "traceId": "x"}`,
+		`{"code": 0, "message": null, "data": {"commonCode": "A", "areas": []}}`,
+	}
+	for i, body := range bodies {
+		observeResponse(database, "A", archive.Detail, at.Add(time.Duration(i)*time.Minute), []byte(body), &DetailResponse{})
+	}
+	if len(alerts) != 0 {
+		t.Errorf("drift alerts %q, want none for an error response", alerts)
+	}
+	captures, err := archive.List("A", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("archive.List: %v", err)
+	}
+	if len(captures) != len(bodies) {
+		t.Errorf("archived %d responses, want %d", len(captures), len(bodies))
+	}
+}
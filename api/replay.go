@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/archive"
+	. "wywk/models"
+)
+
+// ReplayResult summarizes a replay of archived responses.
+type ReplayResult struct {
+	ShopID   uint
+	From, To time.Time // span of the replayed captures, [From, To)
+	Saved    int
+	Skipped  int // already in the database
+	Failed   int
+}
+
+// Replay re-runs processShopData and saveShopData over the archived responses of commonCode
+// in [from, to). Captures that already have a snapshot are skipped, unless replace is set, in
+// which case the snapshots in the span of the archive are deleted and derived again.
+// Rooms go through the same lifecycle as in a live crawl: renames found in the captures are
+// recorded when they happened, and with replace, rooms that no capture has any more are
+// removed. Rooms keep the name and properties of their latest snapshot.
+func Replay(db *gorm.DB, commonCode string, from, to time.Time, replace bool) (*ReplayResult, error) {
+	captures, err := archive.List(commonCode, from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := &ReplayResult{}
+	if len(captures) == 0 {
+		return result, nil
+	}
+	result.From = captures[0].At.UTC()
+	result.To = captures[len(captures)-1].At.Add(time.Second).UTC()
+
+	var shop *Shop
+	for _, capture := range captures {
+		body, err := capture.Read(archive.Info)
+		if err != nil || body == nil {
+			log.Printf("Skipping capture of %s at %s without shop info: %v", commonCode, capture.At.Format(time.RFC3339), err)
+			result.Failed++
+			continue
+		}
+		shopInfo, err := parseShopInfo(body)
+		if err != nil {
+			log.Printf("Skipping capture of %s at %s: %v", commonCode, capture.At.Format(time.RFC3339), err)
+			result.Failed++
+			continue
+		}
+
+		if shop == nil {
+			// 只在店铺不存在时创建，回放旧数据不应覆盖当前的店名和地址
+			shop = &Shop{CommonCode: commonCode}
+			attrs := Shop{Name: shopInfo.Data.StoreName, Address: shopInfo.Data.StoreAddress}
+			if err := db.Where(Shop{CommonCode: commonCode}).Attrs(attrs).FirstOrCreate(shop).Error; err != nil {
+				return nil, fmt.Errorf("failed to save shop to DB: %w", err)
+			}
+			result.ShopID = shop.ID
+			if replace {
+				if err := deleteSnapshots(db, shop.ID, result.From, result.To); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		at := capture.At.UTC()
+		if !replace && hasSnapshot(db, shop.ID, at) {
+			result.Skipped++
+			continue
+		}
+
+		if shopInfo.Data.ShopStatus != "营业中" {
+			handleNonOperatingStatus(db, shop.ID, shopInfo.Data.ShopStatus, at)
+			result.Saved++
+			continue
+		}
+
+		body, err = capture.Read(archive.Detail)
+		if err == nil && body == nil {
+			err = fmt.Errorf("no detail response archived")
+		}
+		var detailResponse *DetailResponse
+		if err == nil {
+			detailResponse, err = parseShopDetails(body)
+		}
+		if err != nil {
+			log.Printf("Skipping capture of %s at %s: %v", commonCode, capture.At.Format(time.RFC3339), err)
+			result.Failed++
+			continue
+		}
+
+		totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties := processShopData(detailResponse)
+		if err := saveShopData(db, shop, at, totalDevices, usedDevices, roomStats, roomCodeToName, physicalRoomProperties, true); err != nil {
+			return result, err
+		}
+		result.Saved++
+	}
+	if replace && shop != nil {
+		if err := deleteStaleRooms(db, shop.ID); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// nameAt returns the name room had at at according to its rename history: the name of the
+// last rename up to at, or the old name of the first one after it.
+func nameAt(tx *gorm.DB, room *Room, at time.Time) (string, error) {
+	var before, after RoomNameChange
+	err := tx.Where("room_id = ? AND changed_at <= ?", room.ID, at).Order("changed_at DESC, id DESC").Limit(1).Find(&before).Error
+	if err != nil || before.ID != 0 {
+		return before.NewName, err
+	}
+	err = tx.Where("room_id = ? AND changed_at > ?", room.ID, at).Order("changed_at, id").Limit(1).Find(&after).Error
+	if err != nil || after.ID != 0 {
+		return after.OldName, err
+	}
+	return room.Name, nil
+}
+
+// mergeNextRename keeps the rename history consistent after change was inserted by a replay:
+// the next rename now starts from change's name, or is dropped if it recorded the same
+// rename when a later crawl noticed it.
+func mergeNextRename(tx *gorm.DB, change *RoomNameChange) error {
+	var next RoomNameChange
+	err := tx.Where("room_id = ? AND changed_at > ?", change.RoomID, change.ChangedAt).Order("changed_at, id").Limit(1).Find(&next).Error
+	if err != nil || next.ID == 0 {
+		return err
+	}
+	if next.NewName == change.NewName {
+		return tx.Delete(&next).Error
+	}
+	return tx.Model(&next).Update("old_name", change.NewName).Error
+}
+
+// deleteStaleRooms removes the rooms of shopID without any snapshot, along with their rename
+// history: after a replay with replace, no capture has them any more.
+func deleteStaleRooms(db *gorm.DB, shopID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var stale []uint
+		err := tx.Model(&Room{}).Where("shop_id = ? AND id NOT IN (SELECT room_id FROM room_snapshots)", shopID).Pluck("id", &stale).Error
+		if err != nil {
+			return fmt.Errorf("failed to find stale rooms: %w", err)
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		log.Printf("Removing %d rooms of shop %d that no snapshot has any more", len(stale), shopID)
+		if err := tx.Where("room_id IN ?", stale).Delete(&RoomNameChange{}).Error; err != nil {
+			return fmt.Errorf("failed to delete rename history of stale rooms: %w", err)
+		}
+		if err := tx.Where("room_id IN ?", stale).Delete(&RoomRollup{}).Error; err != nil {
+			return fmt.Errorf("failed to delete rollups of stale rooms: %w", err)
+		}
+		if err := tx.Delete(&Room{}, stale).Error; err != nil {
+			return fmt.Errorf("failed to delete stale rooms: %w", err)
+		}
+		return nil
+	})
+}
+
+func hasSnapshot(db *gorm.DB, shopID uint, at time.Time) bool {
+	var count int64
+	db.Model(&Snapshot{}).
+		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shopID, at, at.Add(time.Second)).
+		Count(&count)
+	return count > 0
+}
+
+func deleteSnapshots(db *gorm.DB, shopID uint, from, to time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM room_snapshots WHERE snapshot_id IN (SELECT id FROM snapshots WHERE shop_id = ? AND timestamp >= ? AND timestamp < ?)", shopID, from, to).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete room snapshots: %w", err)
+		}
+		if err := tx.Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shopID, from, to).Delete(&Snapshot{}).Error; err != nil {
+			return fmt.Errorf("failed to delete snapshots: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/archive"
+	. "wywk/models"
+)
+
+var replayStart = time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+// archiveCapture archives an open shop at minute m of replayStart with one used seat in
+// each room, given as code -> name.
+func archiveCapture(t *testing.T, m int, rooms map[string]string) {
+	t.Helper()
+	at := replayStart.Add(time.Duration(m) * time.Minute)
+	info := `{"code": 0, "data": {"storeName": "门店A", "shopStatus": "营业中"}}`
+	var seats string
+	id := 0
+	for code, name := range rooms {
+		id++
+		if seats != "" {
+			seats += ","
+		}
+		seats += fmt.Sprintf(`{"id": %d, "elementCode": "SEAT", "clientInfo": {"roomCode": %q, "roomName": %q, "status": 1}}`, id, code, name)
+	}
+	detail := `{"code": 0, "data": {"areas": [{"elements": [` + seats + `]}]}}`
+	if err := archive.Save("A", archive.Info, at, []byte(info)); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Save("A", archive.Detail, at, []byte(detail)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type renameRow struct {
+	OldName, NewName string
+	Minute           int
+}
+
+func renames(t *testing.T, database *gorm.DB, code string) []renameRow {
+	t.Helper()
+	var changes []RoomNameChange
+	database.Where("room_id IN (SELECT id FROM rooms WHERE code = ?)", code).Order("changed_at, id").Find(&changes)
+	var rows []renameRow
+	for _, c := range changes {
+		rows = append(rows, renameRow{c.OldName, c.NewName, int(c.ChangedAt.Sub(replayStart) / time.Minute)})
+	}
+	return rows
+}
+
+func roomName(t *testing.T, database *gorm.DB, code string) string {
+	t.Helper()
+	var room Room
+	database.Where("code = ?", code).Find(&room)
+	return room.Name
+}
+
+func replay(t *testing.T, database *gorm.DB, replace bool) {
+	t.Helper()
+	if _, err := Replay(database, "A", time.Time{}, time.Time{}, replace); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+}
+
+func checkRenames(t *testing.T, database *gorm.DB, want []renameRow) {
+	t.Helper()
+	got := renames(t, database, "R1")
+	if len(got) != len(want) {
+		t.Fatalf("renames = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("renames = %+v, want %+v", got, want)
+			break
+		}
+	}
+	if name := roomName(t, database, "R1"); name != "新名" {
+		t.Errorf("room name = %q, want 新名", name)
+	}
+}
+
+func TestReplayRename(t *testing.T) {
+	defer archive.SetDir(archive.Dir())
+	archive.SetDir(t.TempDir())
+	database := openTestDB(t)
+
+	archiveCapture(t, 0, map[string]string{"R1": "旧名"})
+	archiveCapture(t, 10, map[string]string{"R1": "新名"})
+	archiveCapture(t, 20, map[string]string{"R1": "新名"})
+	want := []renameRow{{"旧名", "新名", 10}}
+
+	replay(t, database, false)
+	checkRenames(t, database, want)
+
+	// 重新回放不应重复记录改名，也不应把房名改回旧名
+	replay(t, database, true)
+	checkRenames(t, database, want)
+}
+
+func TestReplayRenameIntoGap(t *testing.T) {
+	defer archive.SetDir(archive.Dir())
+	archive.SetDir(t.TempDir())
+	database := openTestDB(t)
+
+	// 实时抓取在 20 分钟时才发现改名，中间那次抓取只在归档里
+	archiveCapture(t, 0, map[string]string{"R1": "旧名"})
+	archiveCapture(t, 20, map[string]string{"R1": "新名"})
+	replay(t, database, false)
+	checkRenames(t, database, []renameRow{{"旧名", "新名", 20}})
+
+	archiveCapture(t, 10, map[string]string{"R1": "新名"})
+	replay(t, database, false)
+	checkRenames(t, database, []renameRow{{"旧名", "新名", 10}})
+}
+
+func TestReplayRemovesStaleRooms(t *testing.T) {
+	defer archive.SetDir(archive.Dir())
+	archive.SetDir(t.TempDir())
+	database := openTestDB(t)
+
+	archiveCapture(t, 0, map[string]string{"R1": "新名"})
+	archiveCapture(t, 10, map[string]string{"R1": "新名"})
+	replay(t, database, false)
+	// 之前按错误的解析结果存下的房间，重新回放后不再有任何快照
+	shop := &Shop{}
+	database.Where("common_code = ?", "A").First(shop)
+	stats := map[string]map[string]int{"GONE": {"total": 1, "used": 1}}
+	if err := saveShopData(database, shop, replayStart.Add(5*time.Minute), 1, 1, stats, map[string]string{"GONE": "误识别"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	replay(t, database, true)
+	var rooms []string
+	database.Model(&Room{}).Order("code").Pluck("code", &rooms)
+	if len(rooms) != 1 || rooms[0] != "R1" {
+		t.Errorf("rooms after replay = %q, want [R1]", rooms)
+	}
+}
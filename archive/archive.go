@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of archived responses.
+const (
+	Info   = "info"   // store baseMessage
+	Detail = "detail" // shop/v3/get
+)
+
+// timeFormat names archive files; UTC so that names sort by capture time.
+const timeFormat = "20060102T150405Z"
+
+var (
+	mu         sync.RWMutex
+	archiveDir string
+)
+
+// SetDir sets where raw upstream responses are archived, as
+// <dir>/<commonCode>/<YYYY-MM-DD>/<time>-<kind>.json.gz. Empty disables archival.
+func SetDir(dir string) {
+	mu.Lock()
+	archiveDir = dir
+	mu.Unlock()
+}
+
+// Dir returns the archive directory set by SetDir.
+func Dir() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return archiveDir
+}
+
+// Save archives a raw response body of commonCode captured at at. It is a no-op when Dir is empty.
+func Save(commonCode, kind string, at time.Time, body []byte) error {
+	root := Dir()
+	if root == "" {
+		return nil
+	}
+	at = at.UTC()
+	dir := filepath.Join(root, commonCode, at.Format("2006-01-02"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, at.Format(timeFormat)+"-"+kind+".json.gz")
+
+	// 先写临时文件再改名，避免回放时读到写了一半的文件
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write(body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Capture is one crawl of a shop: the info response and, if the shop was open, the detail response.
+type Capture struct {
+	CommonCode string
+	At         time.Time
+	Paths      map[string]string // kind -> file
+}
+
+// Read returns the decompressed response of kind, or nil if it was not archived.
+func (c Capture) Read(kind string) ([]byte, error) {
+	path, ok := c.Paths[kind]
+	if !ok {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// List returns the archived captures of commonCode in [from, to), oldest first.
+// Zero times leave the range open.
+func List(commonCode string, from, to time.Time) ([]Capture, error) {
+	root := Dir()
+	if root == "" {
+		return nil, fmt.Errorf("no archive directory configured")
+	}
+	days, err := os.ReadDir(filepath.Join(root, commonCode))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	byTime := make(map[time.Time]*Capture)
+	for _, day := range days {
+		if !day.IsDir() {
+			continue
+		}
+		// 按日期目录先粗略过滤，目录以 UTC 日期命名
+		if date, err := time.Parse("2006-01-02", day.Name()); err == nil {
+			if !from.IsZero() && !date.AddDate(0, 0, 1).After(from) || !to.IsZero() && !date.Before(to) {
+				continue
+			}
+		}
+		dir := filepath.Join(root, commonCode, day.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name, ok := strings.CutSuffix(file.Name(), ".json.gz")
+			if !ok {
+				continue
+			}
+			stamp, kind, ok := strings.Cut(name, "-")
+			if !ok {
+				continue
+			}
+			at, err := time.Parse(timeFormat, stamp)
+			if err != nil {
+				continue
+			}
+			if !from.IsZero() && at.Before(from) || !to.IsZero() && !at.Before(to) {
+				continue
+			}
+			if byTime[at] == nil {
+				byTime[at] = &Capture{CommonCode: commonCode, At: at, Paths: make(map[string]string)}
+			}
+			byTime[at].Paths[kind] = filepath.Join(dir, file.Name())
+		}
+	}
+
+	captures := make([]Capture, 0, len(byTime))
+	for _, c := range byTime {
+		captures = append(captures, *c)
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].At.Before(captures[j].At) })
+	return captures, nil
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveAndList(t *testing.T) {
+	defer SetDir(Dir())
+	root := t.TempDir()
+	SetDir(root)
+
+	cst := time.FixedZone("CST", 8*3600)
+	// 北京时间 3 月 2 日 07:00 在 UTC 仍是 3 月 1 日，归档目录按 UTC 日期
+	first := time.Date(2026, 3, 2, 7, 0, 0, 0, cst)
+	second := time.Date(2026, 3, 2, 9, 30, 0, 0, cst)
+	saves := []struct {
+		at   time.Time
+		kind string
+		body string
+	}{
+		{first, Info, `{"first": "info"}`},
+		{first, Detail, `{"first": "detail"}`},
+		{second, Info, `{"second": "info"}`},
+	}
+	for _, s := range saves {
+		if err := Save("A", s.kind, s.at, []byte(s.body)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "A", "2026-03-01", "20260301T230000Z-info.json.gz")); err != nil {
+		t.Errorf("archive file not named by UTC time: %v", err)
+	}
+
+	captures, err := List("A", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(captures) != 2 || !captures[0].At.Equal(first) || !captures[1].At.Equal(second) {
+		t.Fatalf("List() = %+v, want captures at %v and %v", captures, first, second)
+	}
+	body, err := captures[0].Read(Detail)
+	if err != nil || string(body) != `{"first": "detail"}` {
+		t.Errorf("Read(Detail) = %q, %v", body, err)
+	}
+	if body, err := captures[1].Read(Detail); body != nil || err != nil {
+		t.Errorf("Read of a kind not archived = %q, %v, want nil", body, err)
+	}
+
+	// 区间为左闭右开
+	captures, err = List("A", second, second.Add(time.Second))
+	if err != nil || len(captures) != 1 || !captures[0].At.Equal(second) {
+		t.Errorf("List(second, second+1s) = %+v, %v, want the second capture", captures, err)
+	}
+	captures, err = List("A", first.Add(time.Second), second)
+	if err != nil || len(captures) != 0 {
+		t.Errorf("List(first+1s, second) = %+v, %v, want none", captures, err)
+	}
+	if captures, err := List("B", time.Time{}, time.Time{}); err != nil || captures != nil {
+		t.Errorf("List of a shop without archive = %+v, %v, want none", captures, err)
+	}
+}
+
+func TestSaveWithoutDir(t *testing.T) {
+	defer SetDir(Dir())
+	SetDir("")
+	if err := Save("A", Info, time.Now(), []byte("{}")); err != nil {
+		t.Errorf("Save without a directory: %v", err)
+	}
+	if _, err := List("A", time.Time{}, time.Time{}); err == nil {
+		t.Error("List without a directory succeeded")
+	}
+}
@@ -0,0 +1,189 @@
+package calendar
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DayType classifies a date for like-for-like comparisons.
+type DayType string
+
+const (
+	Workday DayType = "workday"
+	Weekend DayType = "weekend"
+	Holiday DayType = "holiday" // 法定节假日，含调休放假的工作日
+	MakeUp  DayType = "makeup"  // 调休上班的周末
+)
+
+// Types lists every day type in display order.
+var Types = []DayType{Workday, Weekend, Holiday, MakeUp}
+
+// Label is the Chinese name of the day type used in reports.
+func (t DayType) Label() string {
+	switch t {
+	case Workday:
+		return "工作日"
+	case Weekend:
+		return "周末"
+	case Holiday:
+		return "节假日"
+	case MakeUp:
+		return "调休上班"
+	}
+	return string(t)
+}
+
+// Calendar lists holidays and make-up workdays by date ("2006-01-02"), with their names.
+// Dates in neither list are workdays or weekends by their weekday.
+type Calendar struct {
+	Holidays map[string]string `json:"holidays"`
+	Workdays map[string]string `json:"workdays"`
+}
+
+// bundled holds the official arrangements published by the State Council.
+//
+//go:embed holidays.json
+var bundled []byte
+
+var (
+	mu      sync.RWMutex
+	current *Calendar
+)
+
+func init() {
+	if err := Load(""); err != nil {
+		panic(fmt.Sprintf("invalid bundled holiday calendar: %v", err))
+	}
+}
+
+// Load reads the calendar with Read and makes it the active one.
+func Load(path string) error {
+	c, err := Read(path)
+	if err != nil {
+		return err
+	}
+	Use(c)
+	return nil
+}
+
+// Read reads the bundled calendar and then the file at path, whose entries take precedence,
+// so that years not bundled yet or local changes can be added. An empty path reads the
+// bundled calendar only.
+func Read(path string) (*Calendar, error) {
+	c, err := parse(bundled)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read holiday file: %w", err)
+		}
+		override, err := parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday file %s: %w", path, err)
+		}
+		for date, name := range override.Holidays {
+			delete(c.Workdays, date)
+			c.Holidays[date] = name
+		}
+		for date, name := range override.Workdays {
+			delete(c.Holidays, date)
+			c.Workdays[date] = name
+		}
+	}
+	return c, nil
+}
+
+// Use makes c the active calendar.
+func Use(c *Calendar) {
+	mu.Lock()
+	current = c
+	mu.Unlock()
+}
+
+func parse(data []byte) (*Calendar, error) {
+	c := &Calendar{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Holidays == nil {
+		c.Holidays = make(map[string]string)
+	}
+	if c.Workdays == nil {
+		c.Workdays = make(map[string]string)
+	}
+	for _, dates := range []map[string]string{c.Holidays, c.Workdays} {
+		for date := range dates {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return nil, fmt.Errorf("invalid date %q", date)
+			}
+		}
+	}
+	return c, nil
+}
+
+// HasYear reports whether c lists any holiday or make-up workday in year. Without them every
+// date of the year is classified by its weekday alone.
+func (c *Calendar) HasYear(year int) bool {
+	prefix := fmt.Sprintf("%04d-", year)
+	for _, dates := range []map[string]string{c.Holidays, c.Workdays} {
+		for date := range dates {
+			if strings.HasPrefix(date, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasYear reports whether the active calendar has any data for year.
+func HasYear(year int) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current.HasYear(year)
+}
+
+// TypeOf classifies the calendar date of t, in t's location.
+func TypeOf(t time.Time) DayType {
+	date := t.Format("2006-01-02")
+	mu.RLock()
+	c := current
+	mu.RUnlock()
+	if _, ok := c.Holidays[date]; ok {
+		return Holiday
+	}
+	weekend := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+	if _, ok := c.Workdays[date]; ok && weekend {
+		return MakeUp
+	}
+	if weekend {
+		return Weekend
+	}
+	return Workday
+}
+
+// Name returns the holiday or make-up workday name of t's date, or "".
+func Name(t time.Time) string {
+	date := t.Format("2006-01-02")
+	mu.RLock()
+	defer mu.RUnlock()
+	if name, ok := current.Holidays[date]; ok {
+		return name
+	}
+	return current.Workdays[date]
+}
+
+// Describe returns the label of t's date with its holiday name, e.g. "节假日 (国庆节)".
+func Describe(t time.Time) string {
+	label := TypeOf(t).Label()
+	if name := Name(t); name != "" {
+		label += " (" + name + ")"
+	}
+	return label
+}
@@ -0,0 +1,120 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var cst = time.FixedZone("CST", 8*3600)
+
+func date(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, cst)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestTypeOf(t *testing.T) {
+	tests := []struct {
+		at       time.Time
+		want     DayType
+		describe string
+	}{
+		{date("2026-10-01 12:00"), Holiday, "节假日 (国庆节)"},
+		{date("2026-10-07 23:59"), Holiday, "节假日 (国庆节)"},
+		{date("2026-10-10 09:00"), MakeUp, "调休上班 (国庆节调休)"},
+		{date("2026-10-11 09:00"), Weekend, "周末"},
+		{date("2026-10-12 09:00"), Workday, "工作日"},
+		{date("2026-02-23 09:00"), Holiday, "节假日 (春节)"},
+		// 日期按 t 自身的时区判断: 北京时间 10 月 1 日凌晨在 UTC 仍是 9 月 30 日
+		{date("2026-10-01 00:30").UTC(), Workday, "工作日"},
+		{date("2026-10-01 00:30"), Holiday, "节假日 (国庆节)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.at.Format(time.RFC3339), func(t *testing.T) {
+			if got := TypeOf(tt.at); got != tt.want {
+				t.Errorf("TypeOf() = %s, want %s", got, tt.want)
+			}
+			if got := Describe(tt.at); got != tt.describe {
+				t.Errorf("Describe() = %q, want %q", got, tt.describe)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tests := []struct {
+		name    string
+		path    string
+		at      time.Time
+		want    DayType
+		wantErr bool
+	}{
+		{"bundled", "", date("2026-10-01 12:00"), Holiday, false},
+		{"added holiday", write("add.json", `{"holidays": {"2026-10-12": "店庆"}}`), date("2026-10-12 12:00"), Holiday, false},
+		{"added workday", write("work.json", `{"workdays": {"2026-10-11": "补班"}}`), date("2026-10-11 12:00"), MakeUp, false},
+		{"bundled kept", write("keep.json", `{"holidays": {"2026-10-12": "店庆"}}`), date("2026-10-01 12:00"), Holiday, false},
+		{"missing file", filepath.Join(dir, "missing.json"), time.Time{}, "", true},
+		{"invalid json", write("bad.json", `{"holidays": [`), time.Time{}, "", true},
+		{"invalid date", write("date.json", `{"holidays": {"2026-13-01": "?"}}`), time.Time{}, "", true},
+	}
+
+	mu.RLock()
+	active := current
+	mu.RUnlock()
+	defer Use(active)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Read(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read(%q) error = %v, want error %v", tt.path, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			Use(c)
+			if got := TypeOf(tt.at); got != tt.want {
+				t.Errorf("TypeOf() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasYear(t *testing.T) {
+	c, err := Read("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, year := range []int{2025, 2026} {
+		if !c.HasYear(year) {
+			t.Errorf("bundled calendar has no dates for %d", year)
+		}
+	}
+	if c.HasYear(2027) {
+		t.Error("bundled calendar has dates for 2027")
+	}
+
+	// 调休上班的日期也算作当年有数据
+	path := filepath.Join(t.TempDir(), "2027.json")
+	if err := os.WriteFile(path, []byte(`{"workdays": {"2027-02-06": "春节调休"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = Read(path); err != nil {
+		t.Fatal(err)
+	}
+	if !c.HasYear(2027) {
+		t.Error("holiday file dates for 2027 not found")
+	}
+}
@@ -0,0 +1,285 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Chart sizes are chosen to stay readable on a phone screen.
+const (
+	Width  = 720
+	Height = 360
+
+	marginLeft   = 48
+	marginRight  = 16
+	marginTop    = 32
+	marginBottom = 36
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	axisColor  = color.RGBA{0x60, 0x60, 0x60, 0xff}
+	gridColor  = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	seriesFill = color.RGBA{0x3b, 0x82, 0xf6, 0xff}
+	textColor  = color.RGBA{0x20, 0x20, 0x20, 0xff}
+
+	// palette colours the series of multi-series charts, starting with seriesFill.
+	palette = []color.RGBA{
+		seriesFill,
+		{0xef, 0x44, 0x44, 0xff},
+		{0x10, 0xb9, 0x81, 0xff},
+		{0xf5, 0x9e, 0x0b, 0xff},
+		{0x8b, 0x5c, 0xf6, 0xff},
+		{0xec, 0x48, 0x99, 0xff},
+		{0x06, 0xb6, 0xd4, 0xff},
+		{0x64, 0x74, 0x8b, 0xff},
+	}
+)
+
+// Series is a labelled list of values. Labels are drawn with a basic ASCII font,
+// so they should be short ASCII strings such as "08" or "10-15".
+type Series struct {
+	Title  string
+	Labels []string
+	Values []float64
+	Max    float64 // top of the y axis; 0 means use the largest value
+	Unit   string  // appended to y axis labels, e.g. "%"
+}
+
+// Line renders s as a line chart and returns the PNG bytes.
+func Line(s Series) ([]byte, error) {
+	return render(s, drawLine)
+}
+
+// Bar renders s as a bar chart and returns the PNG bytes.
+func Bar(s Series) ([]byte, error) {
+	return render(s, drawBars)
+}
+
+// Lines renders several series as one line chart with a legend of their titles. The chart
+// takes its title, labels, Max and Unit from title and the first series. Values that are
+// NaN are left out, e.g. hours without data.
+func Lines(title string, series []Series) ([]byte, error) {
+	if len(series) == 0 {
+		return nil, fmt.Errorf("chart %q has no series", title)
+	}
+	frame := Series{Title: title, Labels: series[0].Labels, Max: series[0].Max, Unit: series[0].Unit}
+	frame.Values = make([]float64, len(frame.Labels))
+	for _, s := range series {
+		for i, v := range s.Values {
+			if i < len(frame.Values) && v > frame.Values[i] {
+				frame.Values[i] = v
+			}
+		}
+	}
+	return render(frame, func(p *plot, frame Series) {
+		legendX := Width - marginRight
+		for i := len(series) - 1; i >= 0; i-- {
+			c := palette[i%len(palette)]
+			polyline(p, series[i].Values, len(frame.Values), c)
+			legendX -= 7*len(series[i].Title) + 20
+			draw.Draw(p.img, image.Rect(legendX, 10, legendX+8, 18), &image.Uniform{c}, image.Point{}, draw.Src)
+			drawText(p.img, series[i].Title, legendX+11, 19)
+		}
+	})
+}
+
+type plot struct {
+	img  *image.RGBA
+	area image.Rectangle
+	max  float64
+}
+
+func (p *plot) y(v float64) int {
+	if v < 0 {
+		v = 0
+	}
+	if v > p.max {
+		v = p.max
+	}
+	return p.area.Max.Y - int(v/p.max*float64(p.area.Dy()))
+}
+
+func render(s Series, drawSeries func(p *plot, s Series)) ([]byte, error) {
+	if len(s.Values) == 0 {
+		return nil, fmt.Errorf("chart %q has no values", s.Title)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, Width, Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+
+	max := s.Max
+	if max <= 0 {
+		for _, v := range s.Values {
+			max = math.Max(max, v)
+		}
+		max = niceCeil(max)
+	}
+	p := &plot{
+		img:  img,
+		area: image.Rect(marginLeft, marginTop, Width-marginRight, Height-marginBottom),
+		max:  max,
+	}
+
+	drawText(img, s.Title, marginLeft, 20)
+
+	// 横向网格线和 y 轴刻度
+	for i := 0; i <= 4; i++ {
+		v := max * float64(i) / 4
+		y := p.y(v)
+		hline(img, p.area.Min.X, p.area.Max.X, y, gridColor)
+		drawText(img, fmt.Sprintf("%.0f%s", v, s.Unit), 4, y+4)
+	}
+	hline(img, p.area.Min.X, p.area.Max.X, p.area.Max.Y, axisColor)
+	vline(img, p.area.Min.X, p.area.Min.Y, p.area.Max.Y, axisColor)
+
+	drawSeries(p, s)
+
+	// x 轴标签，标签太多时隔几个画一个
+	step := 1
+	slot := p.area.Dx() / len(s.Values)
+	for slot*step < 7*(maxLabelLen(s.Labels)+1) {
+		step++
+	}
+	for i := 0; i < len(s.Labels) && i < len(s.Values); i += step {
+		x := p.area.Min.X + slot*i + slot/2 - 7*len(s.Labels[i])/2
+		drawText(img, s.Labels[i], x, p.area.Max.Y+18)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart %q: %w", s.Title, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func drawBars(p *plot, s Series) {
+	slot := p.area.Dx() / len(s.Values)
+	gap := slot / 5
+	for i, v := range s.Values {
+		x0 := p.area.Min.X + slot*i + gap
+		rect := image.Rect(x0, p.y(v), x0+slot-2*gap, p.area.Max.Y)
+		draw.Draw(p.img, rect, &image.Uniform{seriesFill}, image.Point{}, draw.Src)
+	}
+}
+
+func drawLine(p *plot, s Series) {
+	polyline(p, s.Values, len(s.Values), seriesFill)
+}
+
+// polyline connects values placed in slots equal columns; NaN values break the line.
+func polyline(p *plot, values []float64, slots int, c color.Color) {
+	slot := p.area.Dx() / slots
+	var prevX, prevY int
+	connected := false
+	for i, v := range values {
+		if math.IsNaN(v) {
+			connected = false
+			continue
+		}
+		x := p.area.Min.X + slot*i + slot/2
+		y := p.y(v)
+		if connected {
+			line(p.img, prevX, prevY, x, y, c)
+		}
+		// 数据点
+		draw.Draw(p.img, image.Rect(x-2, y-2, x+3, y+3), &image.Uniform{c}, image.Point{}, draw.Src)
+		prevX, prevY, connected = x, y, true
+	}
+}
+
+func hline(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// line draws a two-pixel wide segment using Bresenham's algorithm.
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx := abs(x1 - x0)
+	dy := -abs(y1 - y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func drawText(img *image.RGBA, s string, x, y int) {
+	drawTextColor(img, s, x, y, textColor)
+}
+
+func drawTextColor(img *image.RGBA, s string, x, y int, c color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten, so axis labels stay round.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func maxLabelLen(labels []string) int {
+	n := 0
+	for _, l := range labels {
+		if len(l) > n {
+			n = len(l)
+		}
+	}
+	return n
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
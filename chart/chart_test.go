@@ -0,0 +1,120 @@
+package chart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func decode(t *testing.T, data []byte, err error) image.Image {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not a PNG: %v", err)
+	}
+	return img
+}
+
+func rgba(img image.Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
+
+func TestNiceCeil(t *testing.T) {
+	tests := []struct{ v, want float64 }{
+		{0, 1}, {-3, 1}, {0.3, 0.5}, {1, 1}, {1.2, 2}, {3, 5}, {7, 10}, {42, 50}, {100, 100}, {101, 200},
+	}
+	for _, tt := range tests {
+		if got := niceCeil(tt.v); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("niceCeil(%v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestBar(t *testing.T) {
+	data, err := Bar(Series{Title: "usage", Labels: []string{"a", "b"}, Values: []float64{100, 50}, Max: 100, Unit: "%"})
+	img := decode(t, data, err)
+	if img.Bounds().Dx() != Width || img.Bounds().Dy() != Height {
+		t.Fatalf("size %v, want %dx%d", img.Bounds().Size(), Width, Height)
+	}
+	// 两根柱子各占一半宽度：满值的柱子顶到绘图区上沿，半值的只到一半
+	slot := (Width - marginLeft - marginRight) / 2
+	full, half := marginLeft+slot/2, marginLeft+slot+slot/2
+	if c := rgba(img, full, marginTop+2); c != seriesFill {
+		t.Errorf("top of the full bar is %v, want %v", c, seriesFill)
+	}
+	if c := rgba(img, half, marginTop+2); c == seriesFill {
+		t.Error("half bar reaches the top")
+	}
+	if c := rgba(img, half, Height-marginBottom-2); c != seriesFill {
+		t.Errorf("bottom of the half bar is %v, want %v", c, seriesFill)
+	}
+
+	if _, err := Bar(Series{Title: "empty"}); err == nil {
+		t.Error("Bar without values succeeded")
+	}
+}
+
+func TestLines(t *testing.T) {
+	series := []Series{
+		{Title: "#1", Labels: []string{"00", "01", "02"}, Values: []float64{10, math.NaN(), 30}, Max: 100},
+		{Title: "#2", Values: []float64{50, 60, 70}},
+	}
+	data, err := Lines("by hour", series)
+	decode(t, data, err)
+	if _, err := Lines("none", nil); err == nil {
+		t.Error("Lines without series succeeded")
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	g := Grid{
+		Title:   "weekday x hour",
+		Rows:    []string{"Mon", "Tue"},
+		Columns: []string{"08", "09"},
+		Values:  [][]float64{{100, 0}, {math.NaN(), 50}},
+		Max:     100,
+	}
+	data, err := Heatmap(g)
+	img := decode(t, data, err)
+	if want := marginTop + 2*cellHeight + marginBottom; img.Bounds().Dy() != want {
+		t.Errorf("height %d, want %d", img.Bounds().Dy(), want)
+	}
+
+	left := 7*maxLabelLen(g.Rows) + 12
+	cellWidth := (Width - marginRight - left) / len(g.Columns)
+	// 取格子左上角附近，避开格子中间的数字
+	at := func(r, c int) color.RGBA { return rgba(img, left+cellWidth*c+2, marginTop+cellHeight*r+2) }
+	tests := []struct {
+		r, c int
+		want color.RGBA
+	}{
+		{0, 0, shade(1)},
+		{0, 1, shade(0)},
+		{1, 0, missingFill},
+		{1, 1, shade(0.5)},
+	}
+	for _, tt := range tests {
+		if got := at(tt.r, tt.c); got != tt.want {
+			t.Errorf("cell %d,%d is %v, want %v", tt.r, tt.c, got, tt.want)
+		}
+	}
+
+	if _, err := Heatmap(Grid{Title: "empty"}); err == nil {
+		t.Error("Heatmap without cells succeeded")
+	}
+}
+
+func TestShade(t *testing.T) {
+	if got := shade(0); got != background {
+		t.Errorf("shade(0) = %v, want white", got)
+	}
+	if got := shade(1); got != seriesFill {
+		t.Errorf("shade(1) = %v, want %v", got, seriesFill)
+	}
+}
@@ -0,0 +1,114 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// Grid is a table of values for a heatmap, one row per label in Rows and one column per
+// label in Columns. Labels have the same ASCII limits as Series labels.
+type Grid struct {
+	Title   string
+	Rows    []string
+	Columns []string
+	Values  [][]float64 // Values[row][column]; NaN for cells without data
+	Max     float64     // value of the darkest cell; 0 means use the largest value
+	Unit    string      // appended to the scale labels, e.g. "%"
+}
+
+const cellHeight = 40
+
+var missingFill = color.RGBA{0xf3, 0xf4, 0xf6, 0xff}
+
+// Heatmap renders g as a grid of cells shaded from white to the series colour by value,
+// with the values printed in the cells, and returns the PNG bytes.
+func Heatmap(g Grid) ([]byte, error) {
+	if len(g.Rows) == 0 || len(g.Columns) == 0 {
+		return nil, fmt.Errorf("chart %q has no values", g.Title)
+	}
+	max := g.Max
+	if max <= 0 {
+		for _, row := range g.Values {
+			for _, v := range row {
+				if !math.IsNaN(v) {
+					max = math.Max(max, v)
+				}
+			}
+		}
+		max = niceCeil(max)
+	}
+
+	left := 7*maxLabelLen(g.Rows) + 12
+	height := marginTop + cellHeight*len(g.Rows) + marginBottom
+	img := image.NewRGBA(image.Rect(0, 0, Width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+	drawText(img, g.Title, left, 20)
+
+	// 右上角的色阶说明
+	maxLabel := fmt.Sprintf("%.0f%s", max, g.Unit)
+	scaleX := Width - marginRight - 7*len(maxLabel) - 104
+	for i := 0; i < 100; i++ {
+		vline(img, scaleX+i, 10, 18, shade(float64(i)/99))
+	}
+	drawText(img, "0"+g.Unit, scaleX-7*(len(g.Unit)+2), 19)
+	drawText(img, maxLabel, scaleX+104, 19)
+
+	// 格子之间留出网格线，值为 0 的白色格子也看得出来
+	cellWidth := (Width - marginRight - left) / len(g.Columns)
+	grid := image.Rect(left-1, marginTop-1, left+cellWidth*len(g.Columns), marginTop+cellHeight*len(g.Rows))
+	draw.Draw(img, grid, &image.Uniform{gridColor}, image.Point{}, draw.Src)
+	for r, label := range g.Rows {
+		y := marginTop + cellHeight*r
+		drawText(img, label, 4, y+cellHeight/2+4)
+		for c := range g.Columns {
+			v := math.NaN()
+			if r < len(g.Values) && c < len(g.Values[r]) {
+				v = g.Values[r][c]
+			}
+			x := left + cellWidth*c
+			cell := image.Rect(x, y, x+cellWidth-1, y+cellHeight-1)
+			if math.IsNaN(v) {
+				draw.Draw(img, cell, &image.Uniform{missingFill}, image.Point{}, draw.Src)
+				continue
+			}
+			level := math.Min(math.Max(v/max, 0), 1)
+			draw.Draw(img, cell, &image.Uniform{shade(level)}, image.Point{}, draw.Src)
+			if text := fmt.Sprintf("%.0f", v); 7*len(text)+2 <= cellWidth-1 {
+				ink := textColor
+				if level > 0.6 {
+					ink = background
+				}
+				drawTextColor(img, text, x+(cellWidth-7*len(text))/2, y+cellHeight/2+4, ink)
+			}
+		}
+	}
+
+	// 列标签，标签太多时隔几个画一个
+	step := 1
+	for cellWidth*step < 7*(maxLabelLen(g.Columns)+1) {
+		step++
+	}
+	for c := 0; c < len(g.Columns); c += step {
+		x := left + cellWidth*c + cellWidth/2 - 7*len(g.Columns[c])/2
+		drawText(img, g.Columns[c], x, marginTop+cellHeight*len(g.Rows)+18)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart %q: %w", g.Title, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// shade blends from white at level 0 to seriesFill at level 1.
+func shade(level float64) color.RGBA {
+	blend := func(from, to uint8) uint8 {
+		return uint8(float64(from) + (float64(to)-float64(from))*level)
+	}
+	return color.RGBA{blend(0xff, seriesFill.R), blend(0xff, seriesFill.G), blend(0xff, seriesFill.B), 0xff}
+}
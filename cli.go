@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/archive"
+	"wywk/calendar"
+	"wywk/config"
+	"wywk/daily"
+	"wywk/db"
+	"wywk/drift"
+	"wywk/gateway"
+	"wywk/geo"
+	"wywk/layout"
+	"wywk/models"
+	"wywk/notification"
+	"wywk/report"
+	"wywk/rollup"
+)
+
+const (
+	defaultDBPath   = db.DefaultPath
+	defaultChartDir = "charts"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"crawl", "抓取所有店铺的实时数据并保存", runCrawl},
+	{"report", "发送报告: report daily|weekly|leaderboard|catchup [--date DATE | --from DATE --to DATE] [--weekly] [--dry-run] [--xlsx DIR]", runReport},
+	{"status", "立即查询单个店铺的状态: status <commonCode>", runStatus},
+	{"shops", "店铺管理: shops list | locations | nearest [--from PLACE | --near LAT,LON] [--notify]", runShops},
+	{"discover", "搜索店铺并加入配置: discover [cities] [--city CITY] [--keyword WORD] [--near LAT,LON] [--add CODES|all]", runDiscover},
+	{"devices", "设备清单: devices list|changes [--shop CODE] [--days N]", runDevices},
+	{"export", "导出数据: export [shops|rooms|snapshots|room_snapshots|all] [--format csv|jsonl|parquet] [--shop CODE] [--from DATE] [--to DATE] [--out FILE]", runExport},
+	{"replay", "用归档的原始响应重建数据: replay [--shop CODE] [--from DATE] [--to DATE] [--replace]", runReplay},
+	{"outbox", "通知发送记录: outbox list [--status pending|sent|failed] | resend ID... | resend --failed", runOutbox},
+	{"serve", "常驻运行: 定时抓取、发送日报，配置文件变更时自动重载", runServe},
+	{"db", "数据库维护: db migrate [up|down|status] [--to N] | rollup | prune [--days N] | vacuum | backup <dest>", runDB},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [args]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nEvery command accepts --config (default %s) and --db (SQLite path, postgres:// or mysql:// DSN, default %s).\n", config.DefaultPath, defaultDBPath)
+}
+
+// options holds the flags shared by every command.
+type options struct {
+	configPath string
+	dbPath     string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	opts := &options{}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&opts.configPath, "config", config.DefaultPath, "path to config file")
+	fs.StringVar(&opts.dbPath, "db", "", "SQLite path or postgres:// / mysql:// DSN (default: config database, then "+defaultDBPath+")")
+	return fs, opts
+}
+
+// parseArgs parses flags and returns the positional arguments. Unlike fs.Parse it
+// also accepts flags after positional arguments, e.g. "status CODE --db x.db".
+func parseArgs(fs *flag.FlagSet, opts *options, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	opts.resolve()
+	return positional
+}
+
+// resolve makes explicit relative paths absolute before switching to the executable's directory,
+// so that default paths keep resolving next to the binary.
+func (o *options) resolve() {
+	if o.configPath != config.DefaultPath {
+		o.configPath, _ = filepath.Abs(o.configPath)
+	}
+	if o.dbPath != "" && db.IsFilePath(o.dbPath) {
+		o.dbPath, _ = filepath.Abs(o.dbPath)
+	}
+	ChangeWorkingDir()
+}
+
+func (o *options) loadConfig() *config.Config {
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := applyConfig(cfg); err != nil {
+		log.Fatalf("%v", err)
+	}
+	return cfg
+}
+
+// The alert hooks don't depend on the config, so they are set once before any goroutine
+// reads them instead of on every reload.
+func init() {
+	drift.OnChange = func(commonCode, endpoint string, changes, unknown []string) {
+		message := fmt.Sprintf("%s 的 %s 接口结构发生变化:\n%s", commonCode, endpoint, strings.Join(changes, "\n"))
+		if len(unknown) > 0 {
+			message += "\n未被解析的新字段: " + strings.Join(unknown, ", ")
+		}
+		notification.SendAlert(notification.Alert{
+			Key:  "drift:" + commonCode + ":" + endpoint + ":" + strings.Join(changes, ";"),
+			Body: message,
+		})
+	}
+	layout.OnChange = func(shop *models.Shop, seats, rooms int, changes []string) {
+		message := fmt.Sprintf("门店布局变化 (现有 %d 个座位, %d 个包间):\n%s", seats, rooms, strings.Join(changes, "\n"))
+		notification.SendAlert(notification.Alert{
+			Key:   "layout:" + shop.CommonCode + ":" + strings.Join(changes, ";"),
+			Group: shop.Name,
+			Body:  message,
+		})
+	}
+}
+
+// applyConfig pushes the settings that live outside of config.Config into their packages.
+// Everything that can fail is checked first, so that an error leaves every setting as it was.
+func applyConfig(cfg *config.Config) error {
+	templates, err := report.ParseTemplates(cfg.TemplateDir)
+	if err != nil {
+		return fmt.Errorf("failed to load report templates: %w", err)
+	}
+	holidays, err := calendar.Read(cfg.HolidayFile)
+	if err != nil {
+		return err
+	}
+
+	if year := time.Now().In(cfg.Location()).Year(); !holidays.HasYear(year) {
+		log.Printf("Holiday calendar has no dates for %d; add them to the holidayFile in the config", year)
+	}
+
+	report.UseTemplates(templates)
+	calendar.Use(holidays)
+	archive.SetDir(cfg.ArchiveDir)
+	gateway.Use(gateway.New(cfg.GatewayURL))
+	var places []geo.Place
+	for _, place := range cfg.Places {
+		places = append(places, geo.Place{Name: place.Name, Point: geo.Point{Lat: place.Lat, Lon: place.Lon}})
+	}
+	shopPoints := make(map[string]geo.Point)
+	for code, location := range cfg.ShopLocations {
+		shopPoints[code] = geo.Point{Lat: location.Lat, Lon: location.Lon}
+	}
+	geo.Configure(places, shopPoints)
+	rollup.SetCrawlInterval(time.Duration(cfg.CrawlInterval()) * time.Minute)
+	daily.SetMinCoverage(cfg.MinCoverage())
+	notification.Configure(cfg)
+	chartDir := cfg.ChartDir
+	if chartDir == "" {
+		chartDir = defaultChartDir
+	}
+	notification.UseImages(chartDir, cfg.ChartBaseURL)
+	return nil
+}
+
+// dsn returns the database to use: --db, then the config's database, then the default file.
+func (o *options) dsn() string {
+	if o.dbPath != "" {
+		return o.dbPath
+	}
+	if cfg, err := config.Load(o.configPath); err == nil && cfg.Database != "" {
+		return cfg.Database
+	}
+	return defaultDBPath
+}
+
+// location returns the configured time zone, or the default zone without a valid config file.
+func (o *options) location() *time.Location {
+	cfg, err := config.Load(o.configPath)
+	if err != nil {
+		cfg = &config.Config{}
+	}
+	return cfg.Location()
+}
+
+func (o *options) openDB() *gorm.DB {
+	database := db.InitDB(o.dsn())
+	notification.UseOutbox(database)
+	return database
+}
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/api"
+	"wywk/archive"
+	"wywk/config"
+	"wywk/daily"
+	"wywk/db"
+	"wywk/discovery"
+	"wywk/export"
+	"wywk/gateway"
+	"wywk/geo"
+	"wywk/inventory"
+	"wywk/models"
+	"wywk/notification"
+	"wywk/report"
+	"wywk/rollup"
+)
+
+func runCrawl(args []string) error {
+	fs, opts := newFlagSet("crawl")
+	parseArgs(fs, opts, args)
+	crawlData(opts.openDB(), opts.loadConfig())
+	return nil
+}
+
+func runReport(args []string) error {
+	fs, opts := newFlagSet("report")
+	date := fs.String("date", "", "report date YYYY-MM-DD (default yesterday); for weekly, the last day of the week")
+	from := fs.String("from", "", "daily only: first date of a range to backfill")
+	to := fs.String("to", "", "daily only: last date of a range to backfill (default yesterday)")
+	days := fs.Int("days", catchUpDays, "catchup only: how many days to look back")
+	tz := fs.String("tz", "", "IANA time zone for day boundaries, e.g. Asia/Shanghai (default: config timeZone)")
+	shop := fs.String("shop", "", "only report this commonCode")
+	dryRun := fs.Bool("dry-run", false, "print the report instead of sending it")
+	format := fs.String("format", report.FormatText, "dry-run output format: "+strings.Join(report.Formats(), ", "))
+	force := fs.Bool("force", false, "send even if the report was already sent")
+	xlsx := fs.String("xlsx", "", "write each report as an Excel workbook into this directory instead of sending it")
+	weekly := fs.Bool("weekly", false, "leaderboard only: rank the shops over the week ending on --date")
+	positional := parseArgs(fs, opts, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: report daily|weekly|leaderboard|catchup [--date YYYY-MM-DD | --from DATE --to DATE] [--tz ZONE] [--shop CODE] [--weekly] [--dry-run] [--force] [--xlsx DIR]")
+	}
+
+	cfg := opts.loadConfig()
+	loc := cfg.Location()
+	if *tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(*tz); err != nil {
+			return fmt.Errorf("invalid --tz: %w", err)
+		}
+	}
+	parseDate := func(name, value string) (time.Time, error) {
+		if value == "" {
+			return time.Now().In(loc).AddDate(0, 0, -1), nil
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, loc)
+		if err != nil {
+			return t, fmt.Errorf("invalid --%s: %w", name, err)
+		}
+		return t, nil
+	}
+
+	var periods []daily.Period
+	switch positional[0] {
+	case "daily":
+		if *from == "" {
+			day, err := parseDate("date", *date)
+			if err != nil {
+				return err
+			}
+			periods = append(periods, daily.DailyPeriod(day, loc))
+			break
+		}
+		start, err := parseDate("from", *from)
+		if err != nil {
+			return err
+		}
+		end, err := parseDate("to", *to)
+		if err != nil {
+			return err
+		}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			periods = append(periods, daily.DailyPeriod(day, loc))
+		}
+	case "weekly":
+		day, err := parseDate("date", *date)
+		if err != nil {
+			return err
+		}
+		periods = append(periods, daily.WeeklyPeriod(day, loc))
+	case "leaderboard":
+		day, err := parseDate("date", *date)
+		if err != nil {
+			return err
+		}
+		if *weekly {
+			periods = append(periods, daily.WeeklyPeriod(day, loc))
+		} else {
+			periods = append(periods, daily.DailyPeriod(day, loc))
+		}
+	case "catchup":
+	default:
+		return fmt.Errorf("unknown report type %q, want daily, weekly, leaderboard or catchup", positional[0])
+	}
+
+	db := opts.openDB()
+	channels := notification.ChannelsFromConfig(cfg)
+	codes := cfg.CommonCodes
+	if *shop != "" {
+		codes = []string{*shop}
+	}
+	if positional[0] == "leaderboard" {
+		// --shop 只看部分店铺，不能记为已发送，否则定时的全部店铺排行会被跳过
+		options := daily.ReportOptions{DryRun: *dryRun, Format: *format, Force: *force, NoHistory: *shop != ""}
+		err := daily.SendLeaderboard(db, codes, channels, periods[0], options)
+		if err != nil {
+			return fmt.Errorf("%s leaderboard not sent: %w", periods[0].Label, err)
+		}
+		return nil
+	}
+	if positional[0] == "catchup" && cfg.Leaderboard && len(codes) > 1 {
+		daily.CatchUpLeaderboards(db, codes, channels, *days, loc)
+		return nil
+	}
+	for _, commonCode := range codes {
+		if positional[0] == "catchup" {
+			daily.CatchUpDailyReports(db, commonCode, channels, *days, loc)
+			continue
+		}
+		for _, period := range periods {
+			if *xlsx != "" {
+				path, err := daily.SaveWorkbook(db, commonCode, period, *xlsx)
+				if err != nil {
+					log.Printf("%s workbook for %s not written: %v", period.Label, commonCode, err)
+					continue
+				}
+				fmt.Println("工作簿:", path)
+				continue
+			}
+			err := daily.GenerateAndSendReport(db, commonCode, channels, period, daily.ReportOptions{DryRun: *dryRun, Format: *format, Force: *force})
+			if err != nil {
+				log.Printf("%s report for %s not sent: %v", period.Label, commonCode, err)
+			}
+		}
+	}
+	return nil
+}
+
+func runStatus(args []string) error {
+	fs, opts := newFlagSet("status")
+	format := fs.String("format", report.FormatText, "output format: "+strings.Join(report.Formats(), ", "))
+	positional := parseArgs(fs, opts, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: status <commonCode>")
+	}
+
+	stats, _, err := api.GetShopStats(opts.openDB(), positional[0])
+	if err != nil {
+		return err
+	}
+	text, err := report.Render(*format, stats)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
+func runShops(args []string) error {
+	fs, opts := newFlagSet("shops")
+	from := fs.String("from", "", "nearest only: a configured place name (default: the first place)")
+	near := fs.String("near", "", "nearest only: measure from LAT,LON instead of a place")
+	limit := fs.Int("limit", 5, "nearest only: at most this many shops")
+	notify := fs.Bool("notify", false, "nearest only: send the result to the configured channels")
+	format := fs.String("format", report.FormatText, "locations and nearest output format: "+strings.Join(report.Formats(), ", "))
+	positional := parseArgs(fs, opts, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: shops list|locations|nearest [--from PLACE | --near LAT,LON] [--limit N] [--notify]")
+	}
+
+	var r *report.Report
+	switch positional[0] {
+	case "list":
+		var shops []models.Shop
+		if err := opts.openDB().Order("id").Find(&shops).Error; err != nil {
+			return fmt.Errorf("failed to list shops: %w", err)
+		}
+		for _, shop := range shops {
+			fmt.Printf("%s\t%s\t%s\n", shop.CommonCode, shop.Name, shop.Address)
+		}
+		return nil
+	case "locations":
+		opts.loadConfig()
+		shops, err := geo.Latest(opts.openDB())
+		if err != nil {
+			return err
+		}
+		r = geo.ShopsReport(shops)
+	case "nearest":
+		cfg := opts.loadConfig()
+		var point geo.Point
+		name := *from
+		places := geo.Places()
+		switch {
+		case *near != "":
+			var err error
+			if point, err = geo.ParsePoint(*near); err != nil {
+				return fmt.Errorf("invalid --near: %w", err)
+			}
+			name = point.String()
+		case *from != "":
+			place, ok := geo.FindPlace(*from)
+			if !ok {
+				return fmt.Errorf("unknown place %q, configure it under places", *from)
+			}
+			point = place.Point
+		case len(places) > 0:
+			point, name = places[0].Point, places[0].Name
+		default:
+			return fmt.Errorf("no places configured, pass --near LAT,LON")
+		}
+		shops, err := geo.Nearest(opts.openDB(), point, *limit)
+		if err != nil {
+			return err
+		}
+		r = geo.NearestReport(name, shops, cfg.Location())
+		if *notify {
+			notification.SendReport(notification.ChannelsFromConfig(cfg), r)
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown shops command %q, want list, locations or nearest", positional[0])
+	}
+
+	text, err := report.Render(*format, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
+func runDiscover(args []string) error {
+	fs, opts := newFlagSet("discover")
+	city := fs.String("city", "", "only shops in this city, e.g. 上海")
+	keyword := fs.String("keyword", "", "only shops whose name or address contains this")
+	near := fs.String("near", "", "sort by distance from LAT,LON")
+	limit := fs.Int("limit", discovery.DefaultLimit, "at most this many shops")
+	add := fs.String("add", "", "add these comma-separated commonCodes from the results to the config, or \"all\"")
+	format := fs.String("format", report.FormatText, "output format: "+strings.Join(report.Formats(), ", "))
+	positional := parseArgs(fs, opts, args)
+	if len(positional) > 1 || (len(positional) == 1 && positional[0] != "cities") {
+		return fmt.Errorf("usage: discover [cities] [--city CITY] [--keyword WORD] [--near LAT,LON] [--limit N] [--add CODES|all]")
+	}
+
+	// 首次使用时还没有配置文件，此时用默认网关
+	var configured []string
+	if cfg, err := config.Load(opts.configPath); err == nil {
+		if err := applyConfig(cfg); err != nil {
+			return err
+		}
+		configured = cfg.CommonCodes
+	}
+
+	var r *report.Report
+	if len(positional) == 1 {
+		cities, err := discovery.Cities(gateway.Default())
+		if err != nil {
+			return err
+		}
+		r = discovery.CitiesReport(cities)
+	} else {
+		query := discovery.Query{City: *city, Keyword: *keyword, Limit: *limit}
+		if *near != "" {
+			point, err := geo.ParsePoint(*near)
+			if err != nil {
+				return fmt.Errorf("invalid --near: %w", err)
+			}
+			query.Near, query.Lat, query.Lon = true, point.Lat, point.Lon
+		}
+		stores, err := discovery.Search(gateway.Default(), query)
+		if err != nil {
+			return err
+		}
+		if *add != "" {
+			return addDiscovered(opts.configPath, stores, *add)
+		}
+		r = discovery.SearchReport(stores, configured)
+	}
+
+	text, err := report.Render(*format, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
+// addDiscovered adds the stores selected by add ("all" or comma-separated codes) to the config.
+func addDiscovered(configPath string, stores []discovery.Store, add string) error {
+	found := make(map[string]bool)
+	for _, store := range stores {
+		found[store.CommonCode] = true
+	}
+	var codes []string
+	if add == "all" {
+		for _, store := range stores {
+			codes = append(codes, store.CommonCode)
+		}
+	} else {
+		for _, code := range strings.Split(add, ",") {
+			code = strings.TrimSpace(code)
+			if !found[code] {
+				return fmt.Errorf("%s is not among the search results", code)
+			}
+			codes = append(codes, code)
+		}
+	}
+
+	added, err := config.AddCommonCodes(configPath, codes)
+	if err != nil {
+		return err
+	}
+	if len(added) == 0 {
+		fmt.Println("所选店铺均已在配置中")
+		return nil
+	}
+	for _, store := range stores {
+		for _, code := range added {
+			if store.CommonCode == code {
+				fmt.Printf("已添加: %s\t%s\t%s\n", store.CommonCode, store.Name, store.Address)
+			}
+		}
+	}
+	return nil
+}
+
+func runOutbox(args []string) error {
+	fs, opts := newFlagSet("outbox")
+	status := fs.String("status", "", "list only: pending, sent or failed (default all)")
+	limit := fs.Int("limit", 50, "list only: at most this many notifications")
+	allFailed := fs.Bool("failed", false, "resend only: resend every failed notification")
+	format := fs.String("format", report.FormatText, "list output format: "+strings.Join(report.Formats(), ", "))
+	positional := parseArgs(fs, opts, args)
+	if len(positional) == 0 {
+		return fmt.Errorf("usage: outbox list [--status STATUS] [--limit N] | resend ID... | resend --failed")
+	}
+
+	cfg := opts.loadConfig()
+	database := opts.openDB()
+	switch positional[0] {
+	case "list":
+		switch *status {
+		case "", notification.OutboxPending, notification.OutboxSent, notification.OutboxFailed:
+		default:
+			return fmt.Errorf("invalid --status %q, want pending, sent or failed", *status)
+		}
+		messages, err := notification.ListOutbox(database, *status, *limit)
+		if err != nil {
+			return err
+		}
+		text, err := report.Render(*format, notification.OutboxReport(messages, cfg.Location()))
+		if err != nil {
+			return err
+		}
+		fmt.Println(text)
+		return nil
+	case "resend":
+		var ids []uint
+		if *allFailed {
+			if err := database.Model(&models.OutboxMessage{}).Where("status = ?", notification.OutboxFailed).Pluck("id", &ids).Error; err != nil {
+				return fmt.Errorf("failed to list failed notifications: %w", err)
+			}
+		}
+		for _, arg := range positional[1:] {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid notification id %q", arg)
+			}
+			ids = append(ids, uint(id))
+		}
+		if len(ids) == 0 {
+			fmt.Println("没有需要重发的通知")
+			return nil
+		}
+		if err := notification.Resend(ids); err != nil {
+			return err
+		}
+		fmt.Printf("已重发 %d 条通知\n", len(ids))
+		return nil
+	default:
+		return fmt.Errorf("unknown outbox command %q, want list or resend", positional[0])
+	}
+}
+
+func runDevices(args []string) error {
+	fs, opts := newFlagSet("devices")
+	shop := fs.String("shop", "", "only this commonCode")
+	days := fs.Int("days", 7, "changes: how many days to look back")
+	format := fs.String("format", report.FormatText, "output format: "+strings.Join(report.Formats(), ", "))
+	positional := parseArgs(fs, opts, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: devices list|changes [--shop CODE] [--days N] [--format FORMAT]")
+	}
+
+	var r *report.Report
+	switch positional[0] {
+	case "list":
+		devices, err := inventory.List(opts.openDB(), *shop)
+		if err != nil {
+			return err
+		}
+		r = inventory.DevicesReport(devices, opts.location())
+	case "changes":
+		changes, err := inventory.Changes(opts.openDB(), *shop, time.Now().AddDate(0, 0, -*days))
+		if err != nil {
+			return err
+		}
+		r = inventory.ChangesReport(changes, opts.location())
+	default:
+		return fmt.Errorf("unknown devices command %q, want list or changes", positional[0])
+	}
+	text, err := report.Render(*format, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
+func runExport(args []string) error {
+	fs, opts := newFlagSet("export")
+	shop := fs.String("shop", "", "only export this commonCode")
+	from := fs.String("from", "", "start date YYYY-MM-DD (inclusive)")
+	to := fs.String("to", "", "end date YYYY-MM-DD (inclusive)")
+	format := fs.String("format", "", "csv, jsonl or parquet (default from --out extension, then csv)")
+	out := fs.String("out", "", "output file (default stdout); a directory when exporting all datasets")
+	positional := parseArgs(fs, opts, args)
+
+	name := "snapshots"
+	if len(positional) > 0 {
+		name = positional[0]
+	}
+	filter, err := export.ParseFilter(*shop, *from, *to, opts.location())
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = export.FormatFromPath(*out)
+	}
+	if !export.ValidFormat(*format) {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+	database := opts.openDB()
+
+	if name == "all" {
+		if *out == "" {
+			return fmt.Errorf("exporting all datasets needs --out DIR")
+		}
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			return err
+		}
+		for _, ds := range export.Datasets {
+			if err := exportToFile(database, ds, filter, *format, filepath.Join(*out, ds.Name+"."+*format)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ds, err := export.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return export.Export(database, ds, filter, *format, os.Stdout)
+	}
+	return exportToFile(database, ds, filter, *format, *out)
+}
+
+func exportToFile(database *gorm.DB, ds export.Dataset, filter export.Filter, format, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := export.Export(database, ds, filter, format, f); err != nil {
+		f.Close()
+		return err
+	}
+	log.Printf("Exported %s to %s", ds.Name, path)
+	return f.Close()
+}
+
+// runReplay re-derives snapshots from archived raw responses, e.g. after a parsing fix.
+func runReplay(args []string) error {
+	fs, opts := newFlagSet("replay")
+	shop := fs.String("shop", "", "only replay this commonCode (default all configured shops)")
+	from := fs.String("from", "", "start date YYYY-MM-DD (inclusive)")
+	to := fs.String("to", "", "end date YYYY-MM-DD (inclusive)")
+	replace := fs.Bool("replace", false, "delete existing snapshots in the archived range and derive them again")
+	parseArgs(fs, opts, args)
+
+	filter, err := export.ParseFilter(*shop, *from, *to, opts.location())
+	if err != nil {
+		return err
+	}
+	cfg := opts.loadConfig()
+	if archive.Dir() == "" {
+		return fmt.Errorf("archiveDir is not set in %s", opts.configPath)
+	}
+	codes := cfg.CommonCodes
+	if *shop != "" {
+		codes = []string{*shop}
+	}
+
+	database := opts.openDB()
+	for _, commonCode := range codes {
+		result, err := api.Replay(database, commonCode, filter.From, filter.To, *replace)
+		if err != nil {
+			return fmt.Errorf("replay of %s failed: %w", commonCode, err)
+		}
+		log.Printf("Replayed %s: %d saved, %d already present, %d failed", commonCode, result.Saved, result.Skipped, result.Failed)
+		if result.Saved == 0 {
+			continue
+		}
+		if err := rollup.Rebuild(database, result.ShopID, result.From, result.To, opts.location()); err != nil {
+			return fmt.Errorf("failed to rebuild rollups of %s: %w", commonCode, err)
+		}
+	}
+	return nil
+}
+
+// runServe crawls on an interval and reloads the config when it changes or on SIGHUP.
+func runServe(args []string) error {
+	fs, opts := newFlagSet("serve")
+	addr := fs.String("addr", "", "HTTP listen address for published charts, /api/export and the /map page, e.g. :8080 (disabled if empty)")
+	parseArgs(fs, opts, args)
+
+	watcher, err := config.NewWatcher(opts.configPath, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(watcher.Current()); err != nil {
+		return err
+	}
+	watcher.OnReload = applyConfig
+	watcher.OnChange = func(old, new *config.Config, changes []string) {
+		notification.SendAlert(notification.Alert{Body: "配置已更新:\n" + strings.Join(changes, "\n")})
+	}
+	watcher.OnError = func(err error) {
+		notification.SendAlert(notification.Alert{Key: "config-invalid:" + err.Error(), Body: fmt.Sprintf("配置文件无效，继续使用旧配置: %v", err)})
+	}
+
+	// 先打开数据库，告警队列从中恢复
+	db := opts.openDB()
+	// serve 一直运行到进程退出，这些后台任务不需要停止
+	stop := make(chan struct{})
+	go watcher.Run(stop)
+	go notification.RunAlerts(stop)
+	go notification.RunOutbox(stop)
+
+	if *addr != "" {
+		mux := http.NewServeMux()
+		// 每次请求重新取目录，重载配置修改 chartDir 后链接仍然有效
+		mux.Handle("/charts/", http.StripPrefix("/charts/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.FileServer(http.Dir(notification.ImageDir())).ServeHTTP(w, r)
+		})))
+		mux.Handle("/api/export", export.Handler(db, func() *time.Location { return watcher.Current().Location() }))
+		devices := inventory.Handler(db)
+		mux.Handle("/api/devices", devices)
+		mux.Handle("/api/devices/", devices)
+		shopMap := geo.Handler(db)
+		mux.Handle("/map", shopMap)
+		mux.Handle("/map/", shopMap)
+		go func() {
+			log.Printf("Serving charts, API and map on %s", *addr)
+			if err := http.ListenAndServe(*addr, mux); err != nil {
+				log.Printf("HTTP server stopped: %v", err)
+			}
+		}()
+	}
+
+	lastReportDay := ""
+	for {
+		cfg := watcher.Current()
+		crawlData(db, cfg)
+
+		// 每天 00:00 - 01:00 之间发送一次日报
+		now := time.Now().In(cfg.Location())
+		if today := now.Format("2006-01-02"); now.Hour() == 0 && lastReportDay != today {
+			sendDailyReports(db, cfg)
+			lastReportDay = today
+		}
+
+		time.Sleep(time.Duration(cfg.CrawlInterval()) * time.Minute)
+	}
+}
+
+func runDB(args []string) error {
+	fs, opts := newFlagSet("db")
+	to := fs.Int("to", -1, "migrate up/down: target schema version (default latest for up, previous for down)")
+	days := fs.Int("days", -1, "prune: keep raw snapshots for this many days (default config retentionDays)")
+	positional := parseArgs(fs, opts, args)
+	if len(positional) == 0 {
+		return fmt.Errorf("usage: db migrate [up|down|status] [--to N] | rollup | prune [--days N] | vacuum | backup <dest>")
+	}
+
+	if positional[0] == "rollup" || positional[0] == "prune" {
+		database := opts.openDB()
+		if positional[0] == "rollup" {
+			return rollup.Run(database, opts.location())
+		}
+		retention := *days
+		if retention < 0 {
+			retention = opts.loadConfig().RetentionDays
+		}
+		if retention == 0 {
+			return fmt.Errorf("no retention configured, pass --days N")
+		}
+		_, err := rollup.Prune(database, retention, opts.location())
+		return err
+	}
+
+	database := db.Connect(opts.dsn())
+	switch positional[0] {
+	case "migrate":
+		action := "up"
+		if len(positional) > 1 {
+			action = positional[1]
+		}
+		return runMigrate(database, action, *to, opts.location())
+	case "vacuum":
+		return db.Vacuum(database)
+	case "backup":
+		if len(positional) != 2 {
+			return fmt.Errorf("usage: db backup <dest>")
+		}
+		if err := db.Backup(database, positional[1]); err != nil {
+			return err
+		}
+		log.Printf("Database backed up to %s", positional[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown db command %q", positional[0])
+	}
+}
+
+func runMigrate(database *gorm.DB, action string, to int, loc *time.Location) error {
+	statuses, err := db.Status(database)
+	if err != nil {
+		return err
+	}
+	current := 0
+	for _, status := range statuses {
+		if status.Applied {
+			current = status.Version
+		}
+	}
+
+	switch action {
+	case "status":
+		fmt.Printf("Current version: %d, latest: %d\n", current, db.LatestVersion())
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.In(loc).Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	case "up":
+		if to < 0 {
+			to = db.LatestVersion()
+		}
+		if to < current {
+			return fmt.Errorf("--to %d is older than the current version %d, use db migrate down", to, current)
+		}
+	case "down":
+		if to < 0 {
+			// 默认回退一个版本
+			to = 0
+			for _, status := range statuses {
+				if status.Applied && status.Version < current {
+					to = status.Version
+				}
+			}
+		}
+		if to > current {
+			return fmt.Errorf("--to %d is newer than the current version %d, use db migrate up", to, current)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action %q, want up, down or status", action)
+	}
+
+	if err := db.MigrateTo(database, to); err != nil {
+		return err
+	}
+	log.Printf("Database schema is at version %d.", to)
+	return nil
+}
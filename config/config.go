@@ -0,0 +1,447 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const DefaultPath = "config.json"
+
+// DefaultCrawlIntervalMinutes is used by the daemon when crawlIntervalMinutes is not set.
+const DefaultCrawlIntervalMinutes = 10
+
+// DefaultTimeZone is used when timeZone is not set.
+const DefaultTimeZone = "Asia/Shanghai"
+
+// DefaultMinCoveragePercent is used when minCoveragePercent is not set.
+const DefaultMinCoveragePercent = 90
+
+type Config struct {
+	CommonCodes          []string `json:"commonCodes"`
+	BarkTokens           []string `json:"barkTokens"`
+	CrawlIntervalMinutes int      `json:"crawlIntervalMinutes,omitempty"`
+	// RetentionDays keeps raw snapshots for this many days; older ones are pruned after
+	// being rolled up into hourly and daily aggregates. 0 keeps raw snapshots forever.
+	RetentionDays int `json:"retentionDays,omitempty"`
+	// Database is an SQLite path or a postgres:// or mysql:// DSN; the --db flag takes precedence.
+	Database string `json:"database,omitempty"`
+	// TemplateDir holds report templates (<name>.<format>.tmpl) overriding the built-in ones.
+	TemplateDir string `json:"templateDir,omitempty"`
+	// Channels are notification channels besides the Bark tokens above.
+	Channels []ChannelConfig `json:"channels,omitempty"`
+	// ChartDir and ChartBaseURL publish report charts for channels that can only link to
+	// images, such as Bark. ChartBaseURL must reach `serve --addr`, e.g. http://host:8080/charts.
+	ChartDir     string `json:"chartDir,omitempty"`
+	ChartBaseURL string `json:"chartBaseURL,omitempty"`
+	// ArchiveDir keeps every raw upstream response gzipped, for `replay`. Empty disables archival.
+	ArchiveDir string `json:"archiveDir,omitempty"`
+	// MinCoveragePercent is the share of expected polls below which reports carry a data-quality warning.
+	MinCoveragePercent float64 `json:"minCoveragePercent,omitempty"`
+	// TimeZone is the IANA zone used for day boundaries, hourly buckets and display.
+	// Timestamps are stored in UTC regardless.
+	TimeZone string `json:"timeZone,omitempty"`
+	// HolidayFile adds to or overrides the bundled holiday calendar, in the same format:
+	// {"holidays": {"2027-01-01": "元旦"}, "workdays": {"2027-02-06": "春节调休"}}.
+	// The bundled calendar covers 2025 and 2026; add later years here as they are published.
+	HolidayFile string `json:"holidayFile,omitempty"`
+	// Leaderboard sends one report ranking all shops instead of a daily report per shop,
+	// when more than one commonCode is configured.
+	Leaderboard bool `json:"leaderboard,omitempty"`
+	// GatewayURL points crawls and discovery at another gateway, such as a local stand-in
+	// serving recorded responses. Empty uses the real one.
+	GatewayURL string `json:"gatewayURL,omitempty"`
+	// Places are named points, such as home or the office, that shop distances are measured from.
+	Places []PlaceConfig `json:"places,omitempty"`
+	// ShopLocations sets the coordinates of shops by commonCode, for shops upstream reports none
+	// or wrong ones for. Coordinates are GCJ-02, as shown by Chinese map apps.
+	ShopLocations map[string]LatLon `json:"shopLocations,omitempty"`
+	// Alerts throttles real-time alerts, such as failed crawls or layout changes. Reports
+	// are not affected.
+	Alerts AlertConfig `json:"alerts,omitempty"`
+}
+
+const (
+	DefaultAlertRateLimitPerHour = 10
+	DefaultAlertDedupMinutes     = 60
+)
+
+// AlertConfig sets how alerts are deduplicated and paced. RateLimitPerHour and QuietHours
+// apply to each recipient and can be overridden per channel.
+type AlertConfig struct {
+	// RateLimitPerHour caps the messages a recipient gets per hour; alerts beyond it wait and
+	// are then sent together. Negative disables the limit.
+	RateLimitPerHour int `json:"rateLimitPerHour,omitempty"`
+	// DedupMinutes drops an alert when one with the same key was sent this recently.
+	DedupMinutes int `json:"dedupMinutes,omitempty"`
+	// QuietHours holds alerts between two local times, e.g. "23:00-08:00".
+	QuietHours string `json:"quietHours,omitempty"`
+	// QuietDigest delivers the alerts held during quiet hours as one message instead of one by one.
+	QuietDigest bool `json:"quietDigest,omitempty"`
+	// DigestMinutes batches the alerts of this many minutes, from every shop, into one message.
+	// 0 sends each alert as soon as possible.
+	DigestMinutes int `json:"digestMinutes,omitempty"`
+}
+
+// RateLimit returns the hourly limit per recipient, 0 for none.
+func (a AlertConfig) RateLimit() int {
+	switch {
+	case a.RateLimitPerHour < 0:
+		return 0
+	case a.RateLimitPerHour == 0:
+		return DefaultAlertRateLimitPerHour
+	}
+	return a.RateLimitPerHour
+}
+
+// DedupTTL returns how long an alert key suppresses repeats.
+func (a AlertConfig) DedupTTL() time.Duration {
+	if a.DedupMinutes > 0 {
+		return time.Duration(a.DedupMinutes) * time.Minute
+	}
+	return DefaultAlertDedupMinutes * time.Minute
+}
+
+// ParseQuietHours reads "HH:MM-HH:MM" into minutes after midnight; the span may wrap
+// past midnight. An empty string means no quiet hours and returns start == end.
+func ParseQuietHours(s string) (start, end int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q, want HH:MM-HH:MM", s)
+	}
+	if start, err = parseClock(from); err == nil {
+		end, err = parseClock(to)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q: %w", s, err)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// LatLon is a position in the config.
+type LatLon struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (p LatLon) validate() error {
+	if p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 || (p.Lat == 0 && p.Lon == 0) {
+		return fmt.Errorf("invalid coordinates %v,%v", p.Lat, p.Lon)
+	}
+	return nil
+}
+
+// PlaceConfig is a named point shop distances are measured from.
+type PlaceConfig struct {
+	Name string `json:"name"`
+	LatLon
+}
+
+const (
+	ChannelBark     = "bark"
+	ChannelTelegram = "telegram"
+	ChannelWeCom    = "wecom"
+	ChannelFeishu   = "feishu"
+	ChannelEmail    = "email"
+)
+
+type ChannelConfig struct {
+	Type    string `json:"type"`
+	Format  string `json:"format,omitempty"`  // overrides the channel's default report format
+	Token   string `json:"token,omitempty"`   // bark device key or telegram bot token
+	ChatID  string `json:"chatId,omitempty"`  // telegram
+	Webhook string `json:"webhook,omitempty"` // wecom or feishu robot webhook URL
+
+	SMTPHost string   `json:"smtpHost,omitempty"`
+	SMTPPort int      `json:"smtpPort,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+
+	// Alerts also sends real-time alerts to this channel; Bark tokens always get them.
+	Alerts bool `json:"alerts,omitempty"`
+	// RateLimitPerHour and QuietHours override the alert settings for this recipient.
+	RateLimitPerHour int    `json:"rateLimitPerHour,omitempty"`
+	QuietHours       string `json:"quietHours,omitempty"`
+}
+
+// Name identifies the channel in logs and config diffs without exposing secrets.
+func (c ChannelConfig) Name() string {
+	switch c.Type {
+	case ChannelTelegram:
+		return c.Type + " " + c.ChatID
+	case ChannelEmail:
+		return c.Type + " " + strings.Join(c.To, ",")
+	case ChannelWeCom, ChannelFeishu:
+		return c.Type + " ..." + last4(c.Webhook)
+	default:
+		return c.Type + " ..." + last4(c.Token)
+	}
+}
+
+func (c ChannelConfig) validate() error {
+	switch c.Type {
+	case ChannelBark:
+		if c.Token == "" {
+			return fmt.Errorf("bark channel needs token")
+		}
+	case ChannelTelegram:
+		if c.Token == "" || c.ChatID == "" {
+			return fmt.Errorf("telegram channel needs token and chatId")
+		}
+	case ChannelWeCom, ChannelFeishu:
+		if c.Webhook == "" {
+			return fmt.Errorf("%s channel needs webhook", c.Type)
+		}
+	case ChannelEmail:
+		if c.SMTPHost == "" || c.From == "" || len(c.To) == 0 {
+			return fmt.Errorf("email channel needs smtpHost, from and to")
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", c.Type)
+	}
+	if _, _, err := ParseQuietHours(c.QuietHours); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Load reads and validates the config file at path.
+func Load(path string) (*Config, error) {
+	configFile, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %w", err)
+	}
+	defer configFile.Close()
+
+	var config Config
+	jsonParser := json.NewDecoder(configFile)
+	if err = jsonParser.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+	return &config, nil
+}
+
+// Validate checks the config for mistakes that would break a crawl.
+func (c *Config) Validate() error {
+	if len(c.CommonCodes) == 0 {
+		return fmt.Errorf("commonCodes is empty")
+	}
+	seen := make(map[string]bool)
+	for _, code := range c.CommonCodes {
+		if strings.TrimSpace(code) == "" {
+			return fmt.Errorf("commonCodes contains an empty entry")
+		}
+		if seen[code] {
+			return fmt.Errorf("duplicate commonCode %s", code)
+		}
+		seen[code] = true
+	}
+	for _, token := range c.BarkTokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("barkTokens contains an empty entry")
+		}
+	}
+	for i, channel := range c.Channels {
+		if err := channel.validate(); err != nil {
+			return fmt.Errorf("channels[%d]: %w", i, err)
+		}
+	}
+	if c.RetentionDays < 0 {
+		return fmt.Errorf("retentionDays must not be negative")
+	}
+	if c.CrawlIntervalMinutes < 0 {
+		return fmt.Errorf("crawlIntervalMinutes must not be negative")
+	}
+	if c.MinCoveragePercent < 0 || c.MinCoveragePercent > 100 {
+		return fmt.Errorf("minCoveragePercent must be between 0 and 100")
+	}
+	places := make(map[string]bool)
+	for i, place := range c.Places {
+		if strings.TrimSpace(place.Name) == "" {
+			return fmt.Errorf("places[%d]: name is empty", i)
+		}
+		if places[place.Name] {
+			return fmt.Errorf("duplicate place %s", place.Name)
+		}
+		places[place.Name] = true
+		if err := place.validate(); err != nil {
+			return fmt.Errorf("places[%d]: %w", i, err)
+		}
+	}
+	for code, location := range c.ShopLocations {
+		if err := location.validate(); err != nil {
+			return fmt.Errorf("shopLocations[%s]: %w", code, err)
+		}
+	}
+	if _, _, err := ParseQuietHours(c.Alerts.QuietHours); err != nil {
+		return fmt.Errorf("alerts: %w", err)
+	}
+	if c.Alerts.DedupMinutes < 0 || c.Alerts.DigestMinutes < 0 {
+		return fmt.Errorf("alerts: dedupMinutes and digestMinutes must not be negative")
+	}
+	if _, err := loadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("invalid timeZone: %w", err)
+	}
+	return nil
+}
+
+// CrawlInterval returns the configured crawl interval in minutes, falling back to the default.
+func (c *Config) CrawlInterval() int {
+	if c.CrawlIntervalMinutes > 0 {
+		return c.CrawlIntervalMinutes
+	}
+	return DefaultCrawlIntervalMinutes
+}
+
+// MinCoverage returns the configured coverage threshold in percent, falling back to the default.
+func (c *Config) MinCoverage() float64 {
+	if c.MinCoveragePercent > 0 {
+		return c.MinCoveragePercent
+	}
+	return DefaultMinCoveragePercent
+}
+
+// Location returns the configured time zone, falling back to DefaultTimeZone.
+// Validate makes sure the zone exists.
+func (c *Config) Location() *time.Location {
+	loc, err := loadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = DefaultTimeZone
+	}
+	return time.LoadLocation(name)
+}
+
+// Diff describes what changed between two configs, one line per change.
+func Diff(old, new *Config) []string {
+	var changes []string
+	added, removed := diffStrings(old.CommonCodes, new.CommonCodes)
+	for _, code := range added {
+		changes = append(changes, "新增店铺: "+code)
+	}
+	for _, code := range removed {
+		changes = append(changes, "移除店铺: "+code)
+	}
+
+	// 只显示 token 的后四位，避免在日志和通知中泄露
+	added, removed = diffStrings(old.BarkTokens, new.BarkTokens)
+	for _, token := range added {
+		changes = append(changes, "新增接收者: ..."+last4(token))
+	}
+	for _, token := range removed {
+		changes = append(changes, "移除接收者: ..."+last4(token))
+	}
+
+	added, removed = diffStrings(channelNames(old.Channels), channelNames(new.Channels))
+	for _, name := range added {
+		changes = append(changes, "新增通知渠道: "+name)
+	}
+	for _, name := range removed {
+		changes = append(changes, "移除通知渠道: "+name)
+	}
+
+	if old.ChartBaseURL != new.ChartBaseURL || old.ChartDir != new.ChartDir {
+		changes = append(changes, fmt.Sprintf("图表发布: %q -> %q", old.ChartBaseURL, new.ChartBaseURL))
+	}
+	if old.ArchiveDir != new.ArchiveDir {
+		changes = append(changes, fmt.Sprintf("原始响应归档目录: %q -> %q", old.ArchiveDir, new.ArchiveDir))
+	}
+	if old.RetentionDays != new.RetentionDays {
+		changes = append(changes, fmt.Sprintf("原始数据保留天数: %d -> %d", old.RetentionDays, new.RetentionDays))
+	}
+	if old.Database != new.Database {
+		changes = append(changes, "数据库配置已变更，需重启后生效")
+	}
+	if old.TemplateDir != new.TemplateDir {
+		changes = append(changes, fmt.Sprintf("模板目录: %q -> %q", old.TemplateDir, new.TemplateDir))
+	}
+	if old.CrawlInterval() != new.CrawlInterval() {
+		changes = append(changes, fmt.Sprintf("抓取间隔: %d分钟 -> %d分钟", old.CrawlInterval(), new.CrawlInterval()))
+	}
+	if old.Location().String() != new.Location().String() {
+		changes = append(changes, fmt.Sprintf("时区: %s -> %s", old.Location(), new.Location()))
+	}
+	if old.HolidayFile != new.HolidayFile {
+		changes = append(changes, fmt.Sprintf("节假日文件: %q -> %q", old.HolidayFile, new.HolidayFile))
+	}
+	if old.MinCoverage() != new.MinCoverage() {
+		changes = append(changes, fmt.Sprintf("数据覆盖率告警阈值: %.0f%% -> %.0f%%", old.MinCoverage(), new.MinCoverage()))
+	}
+	if !reflect.DeepEqual(old.Places, new.Places) {
+		changes = append(changes, fmt.Sprintf("地点: %d 个 -> %d 个", len(old.Places), len(new.Places)))
+	}
+	if !reflect.DeepEqual(old.ShopLocations, new.ShopLocations) {
+		changes = append(changes, fmt.Sprintf("手动门店坐标: %d 个 -> %d 个", len(old.ShopLocations), len(new.ShopLocations)))
+	}
+	if old.Alerts != new.Alerts {
+		changes = append(changes, fmt.Sprintf("告警设置: 每小时上限 %d, 去重 %s, 免打扰 %q, 汇总 %d分钟",
+			new.Alerts.RateLimit(), new.Alerts.DedupTTL(), new.Alerts.QuietHours, new.Alerts.DigestMinutes))
+	}
+	if old.GatewayURL != new.GatewayURL {
+		changes = append(changes, fmt.Sprintf("网关地址: %q -> %q", old.GatewayURL, new.GatewayURL))
+	}
+	if old.Leaderboard != new.Leaderboard {
+		changes = append(changes, fmt.Sprintf("门店排行: %t -> %t", old.Leaderboard, new.Leaderboard))
+	}
+	return changes
+}
+
+func channelNames(channels []ChannelConfig) []string {
+	var names []string
+	for _, channel := range channels {
+		names = append(names, channel.Name())
+	}
+	return names
+}
+
+func diffStrings(old, new []string) (added, removed []string) {
+	oldSet := make(map[string]bool)
+	for _, s := range old {
+		oldSet[s] = true
+	}
+	newSet := make(map[string]bool)
+	for _, s := range new {
+		newSet[s] = true
+		if !oldSet[s] {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if !newSet[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func last4(s string) string {
+	if len(s) > 4 {
+		return s[len(s)-4:]
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		wantErr    bool
+	}{
+		{"", 0, 0, false},
+		{"23:00-08:00", 23 * 60, 8 * 60, false},
+		{"12:30-13:45", 12*60 + 30, 13*60 + 45, false},
+		{" 22:00 - 06:30 ", 22 * 60, 6*60 + 30, false},
+		{"00:00-00:00", 0, 0, false},
+		{"23:00", 0, 0, true},
+		{"25:00-08:00", 0, 0, true},
+		{"23:00-8am", 0, 0, true},
+		{"-", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			start, end, err := ParseQuietHours(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuietHours(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			}
+			if start != tt.start || end != tt.end {
+				t.Errorf("ParseQuietHours(%q) = %d, %d, want %d, %d", tt.in, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestAlertConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		alerts    AlertConfig
+		rateLimit int
+		dedupTTL  time.Duration
+	}{
+		{"defaults", AlertConfig{}, DefaultAlertRateLimitPerHour, DefaultAlertDedupMinutes * time.Minute},
+		{"set", AlertConfig{RateLimitPerHour: 3, DedupMinutes: 5}, 3, 5 * time.Minute},
+		{"unlimited", AlertConfig{RateLimitPerHour: -1}, 0, DefaultAlertDedupMinutes * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alerts.RateLimit(); got != tt.rateLimit {
+				t.Errorf("RateLimit() = %d, want %d", got, tt.rateLimit)
+			}
+			if got := tt.alerts.DedupTTL(); got != tt.dedupTTL {
+				t.Errorf("DedupTTL() = %v, want %v", got, tt.dedupTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AddCommonCodes appends the codes not configured yet to commonCodes in the config file at
+// path and returns them. Only the commonCodes array is rewritten, so other settings keep their
+// order and formatting, including keys this version does not know. The file is created if
+// missing and replaced atomically otherwise, so a running `serve` reloads it once.
+func AddCommonCodes(path string, codes []string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// 首次使用时直接用搜索结果创建配置文件
+		data, err = []byte("{}\n"), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %w", err)
+	}
+	field, err := locateField(data, "commonCodes")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	var existing []string
+	if field.found {
+		if err := json.Unmarshal(data[field.start:field.end], &existing); err != nil {
+			return nil, fmt.Errorf("error parsing commonCodes: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range existing {
+		seen[code] = true
+	}
+	var added []string
+	for _, code := range codes {
+		if !seen[code] {
+			seen[code] = true
+			added = append(added, code)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	var out []byte
+	if field.found {
+		out = splice(data, field.start, field.end, appendToArray(data[field.start:field.end], added))
+	} else {
+		// 没有 commonCodes 时作为最后一个键加入
+		entry := `"commonCodes": ` + string(appendToArray([]byte("[]"), added))
+		if field.last > 0 {
+			out = splice(data, field.last, field.last, []byte(",\n  "+entry))
+		} else {
+			out = splice(data, field.close, field.close, []byte("\n  "+entry+"\n"))
+		}
+	}
+	config := Config{}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp.Name(), info.Mode())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to write config file: %w", err)
+	}
+	return added, nil
+}
+
+// fieldPosition is where a top-level key of a JSON object is in its encoding.
+type fieldPosition struct {
+	found      bool
+	start, end int // value of the key, if found
+	last       int // end of the last value in the object, 0 if it is empty
+	close      int // closing brace of the object
+}
+
+// locateField finds the value of the top-level key in the JSON object data.
+func locateField(data []byte, key string) (fieldPosition, error) {
+	var pos fieldPosition
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if token, err := dec.Token(); err != nil {
+		return pos, err
+	} else if token != json.Delim('{') {
+		return pos, fmt.Errorf("not a JSON object")
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return pos, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return pos, err
+		}
+		end := int(dec.InputOffset())
+		if token == key {
+			pos.found, pos.start, pos.end = true, end-len(value), end
+		}
+		pos.last = end
+	}
+	if _, err := dec.Token(); err != nil {
+		return pos, err
+	}
+	pos.close = int(dec.InputOffset()) - 1
+	return pos, nil
+}
+
+// appendToArray adds values to the JSON array of strings array, in the layout of its
+// existing elements: one per line if they are, separated by ", " otherwise.
+func appendToArray(array []byte, values []string) []byte {
+	body := bytes.TrimRight(array[:len(array)-1], " \t\r\n")
+	tail := array[len(body):]
+	separator := ", "
+	if i := bytes.LastIndexByte(body, '\n'); i >= 0 {
+		line := body[i+1:]
+		separator = ",\n" + string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+	}
+	out := append([]byte{}, body...)
+	for i, value := range values {
+		quoted, _ := json.Marshal(value)
+		if i > 0 || len(bytes.TrimSpace(body)) > 1 {
+			out = append(out, separator...)
+		}
+		out = append(out, quoted...)
+	}
+	return append(out, tail...)
+}
+
+// splice replaces data[start:end] with insert.
+func splice(data []byte, start, end int, insert []byte) []byte {
+	out := append([]byte{}, data[:start]...)
+	out = append(out, insert...)
+	return append(out, data[end:]...)
+}
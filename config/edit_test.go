@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAddCommonCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string // "" for a missing file
+		codes []string
+		added []string
+		want  string
+	}{
+		{
+			name:  "multi-line array",
+			file:  "{\n    \"timeZone\": \"Asia/Shanghai\",\n    \"commonCodes\": [\n        \"A\"\n    ],\n    \"unknownKey\": {\"b\": 1, \"a\": 2}\n}\n",
+			codes: []string{"A", "B", "C"},
+			added: []string{"B", "C"},
+			want:  "{\n    \"timeZone\": \"Asia/Shanghai\",\n    \"commonCodes\": [\n        \"A\",\n        \"B\",\n        \"C\"\n    ],\n    \"unknownKey\": {\"b\": 1, \"a\": 2}\n}\n",
+		},
+		{
+			name:  "single-line array",
+			file:  `{"zeta": true, "commonCodes": ["A"], "alpha": 1}`,
+			codes: []string{"B"},
+			added: []string{"B"},
+			want:  `{"zeta": true, "commonCodes": ["A", "B"], "alpha": 1}`,
+		},
+		{
+			name:  "empty array",
+			file:  `{"commonCodes": [], "zeta": true}`,
+			codes: []string{"A", "B"},
+			added: []string{"A", "B"},
+			want:  `{"commonCodes": ["A", "B"], "zeta": true}`,
+		},
+		{
+			name:  "no commonCodes",
+			file:  "{\n  \"zeta\": true,\n  \"alpha\": 1\n}\n",
+			codes: []string{"A"},
+			added: []string{"A"},
+			want:  "{\n  \"zeta\": true,\n  \"alpha\": 1,\n  \"commonCodes\": [\"A\"]\n}\n",
+		},
+		{
+			name:  "missing file",
+			codes: []string{"A", "A"},
+			added: []string{"A"},
+			want:  "{\n  \"commonCodes\": [\"A\"]\n}\n",
+		},
+		{
+			name:  "nothing new",
+			file:  `{"commonCodes": ["A"]}`,
+			codes: []string{"A"},
+			want:  `{"commonCodes": ["A"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			added, err := AddCommonCodes(path, tt.codes)
+			if err != nil {
+				t.Fatalf("AddCommonCodes: %v", err)
+			}
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added %q, want %q", added, tt.added)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("config file =\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddCommonCodesRejectsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := `{"commonCodes": ["A"], "timeZone": "Nowhere/Invalid"}`
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddCommonCodes(path, []string{"B"}); err == nil {
+		t.Fatal("AddCommonCodes accepted an invalid config")
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("config file changed to %s", data)
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Watcher keeps the current config and reloads it when the file changes or on SIGHUP.
+// An invalid new config is rejected and the previous one stays active.
+type Watcher struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	current *Config
+	modTime time.Time
+
+	// OnChange is called after a new config has been applied.
+	OnChange func(old, new *Config, changes []string)
+	// OnReload is called with every new config that loads, even without changes, before it
+	// becomes current, so that files referenced by the config can be re-read. An error
+	// rejects the config like an invalid file; OnReload must then leave the previous
+	// settings in place.
+	OnReload func(config *Config) error
+	// OnError is called when a reload fails; the previous config is kept.
+	OnError func(err error)
+}
+
+func NewWatcher(path string, interval time.Duration) (*Watcher, error) {
+	config, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{path: path, interval: interval, current: config}
+	if info, err := os.Stat(path); err == nil {
+		w.modTime = info.ModTime()
+	}
+	return w, nil
+}
+
+// Current returns the active config.
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Reload re-reads the config file and applies it if valid.
+func (w *Watcher) Reload() error {
+	if info, err := os.Stat(w.path); err == nil {
+		w.mu.Lock()
+		w.modTime = info.ModTime()
+		w.mu.Unlock()
+	}
+
+	config, err := Load(w.path)
+	if err == nil && w.OnReload != nil {
+		err = w.OnReload(config)
+	}
+	if err != nil {
+		log.Printf("Config reload failed, keeping previous config: %v", err)
+		if w.OnError != nil {
+			w.OnError(err)
+		}
+		return err
+	}
+
+	w.mu.Lock()
+	old := w.current
+	w.current = config
+	w.mu.Unlock()
+
+	changes := Diff(old, config)
+	if len(changes) == 0 {
+		log.Println("Config reloaded, no changes.")
+		return nil
+	}
+	for _, change := range changes {
+		log.Printf("Config changed: %s", change)
+	}
+	if w.OnChange != nil {
+		w.OnChange(old, config, changes)
+	}
+	return nil
+}
+
+// Run watches for file modifications and SIGHUP until stop is closed.
+func (w *Watcher) Run(stop <-chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			log.Println("Received SIGHUP, reloading config...")
+			_ = w.Reload()
+		case <-ticker.C:
+			info, err := os.Stat(w.path)
+			if err != nil {
+				continue
+			}
+			w.mu.RLock()
+			changed := !info.ModTime().Equal(w.modTime)
+			w.mu.RUnlock()
+			if changed {
+				log.Println("Config file modified, reloading...")
+				_ = w.Reload()
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package daily
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"wywk/chart"
+	"wywk/report"
+)
+
+// addCharts attaches the hourly, room, day type and week trend charts to r. Chart labels are
+// ASCII only since the chart font has no CJK glyphs.
+func addCharts(r *report.Report, data *ReportData) {
+	if len(data.Hourly) > 0 {
+		series := chart.Series{Title: "Hourly usage (%)", Max: 100, Unit: "%"}
+		for _, hs := range data.Hourly {
+			series.Labels = append(series.Labels, hs.Hour)
+			series.Values = append(series.Values, hs.AvgRate)
+		}
+		addChart(r, "hourly.png", "分时段使用率", chart.Line, series)
+	}
+
+	if len(data.Rooms) > 1 {
+		series := chart.Series{Title: "Room usage (%)", Max: 100, Unit: "%"}
+		for i, room := range data.Rooms {
+			series.Labels = append(series.Labels, strconv.Itoa(i+1))
+			series.Values = append(series.Values, room.AvgUsageRate)
+		}
+		addChart(r, "rooms.png", "各房间使用率 (编号对应房间列表顺序)", chart.Bar, series)
+	}
+
+	if len(data.DayTypes) > 0 {
+		grid := chart.Grid{Title: "Usage by day type and hour (%)", Max: 100, Unit: "%"}
+		for h := 0; h < 24; h++ {
+			grid.Columns = append(grid.Columns, fmt.Sprintf("%02d", h))
+		}
+		for _, p := range data.DayTypes {
+			grid.Rows = append(grid.Rows, string(p.Type))
+			row := make([]float64, len(grid.Columns))
+			for h, hour := range grid.Columns {
+				row[h] = math.NaN()
+				if rate, ok := p.Hourly[hour]; ok {
+					row[h] = rate
+				}
+			}
+			grid.Values = append(grid.Values, row)
+		}
+		// 行标签用英文类型名，图表字体没有中文
+		heatmap, err := chart.Heatmap(grid)
+		if err != nil {
+			log.Printf("Failed to render chart daytypes.png: %v", err)
+		} else {
+			r.Images = append(r.Images, report.Image{Name: "daytypes.png", Title: "按日期类型的分时段使用率热力图", PNG: heatmap})
+		}
+	}
+
+	if len(data.Trend) > 1 {
+		series := chart.Series{Title: "Daily average usage (%)", Max: 100, Unit: "%"}
+		for _, day := range data.Trend {
+			series.Labels = append(series.Labels, day.Day[5:])
+			series.Values = append(series.Values, day.AvgUsageRate)
+		}
+		addChart(r, "trend.png", "近7日趋势", chart.Line, series)
+	}
+}
+
+func addChart(r *report.Report, name, title string, render func(chart.Series) ([]byte, error), series chart.Series) {
+	data, err := render(series)
+	if err != nil {
+		log.Printf("Failed to render chart %s: %v", name, err)
+		return
+	}
+	r.Images = append(r.Images, report.Image{Name: name, Title: title, PNG: data})
+}
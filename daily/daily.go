@@ -1,129 +1,415 @@
 package daily
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"gorm.io/gorm"
 
+	"wywk/calendar"
 	"wywk/models"
 	"wywk/notification"
+	"wywk/report"
+	"wywk/rollup"
 )
 
-// DailyStats holds the result of the overall aggregation query.
+// DailyStats holds the overall statistics of a period. Averages are weighted by the time
+// each snapshot stands for, so that missing or extra polls don't skew them.
 type DailyStats struct {
 	AvgUsageRate   float64
 	MaxUsageRate   float64
 	AvgUsedDevices float64
 	MaxUsedDevices float64 // Use float64 for easier scanning from AVG
 	RecordCount    int64
+	DeviceHours    float64 // occupied device time, in hours
+	PeakMinutes    float64 // time spent at or above rollup.PeakRate
 }
 
 // HourlyStat holds the result of the hourly aggregation query.
 type HourlyStat struct {
-	Hour           string // Comes as a string like "08", "14" from strftime
+	Hour           string // "08", "14", in the time zone of the report period
 	AvgRate        float64
 	AvgUsedDevices float64
+	Polls          int // snapshots recorded in this hour of day
+	ExpectedPolls  int // snapshots the crawl interval should have produced
 }
 
-// buildBar creates a simple text-based bar for a percentage.
-func buildBar(percentage float64, barLength int) string {
-	if percentage < 0 {
-		percentage = 0
+// RoomStat holds the aggregated usage of one room over the report period.
+type RoomStat struct {
+	Name           string
+	TotalDevices   int
+	AvgUsageRate   float64
+	MaxUsageRate   float64
+	AvgUsedDevices float64
+	DeviceHours    float64
+	PeakMinutes    float64
+}
+
+func roomStat(name string, a *rollup.Aggregate) RoomStat {
+	return RoomStat{
+		Name:           name,
+		TotalDevices:   a.TotalDevices,
+		AvgUsageRate:   a.AvgUsageRate(),
+		MaxUsageRate:   a.MaxUsageRate,
+		AvgUsedDevices: a.AvgUsedDevices(),
+		DeviceHours:    a.DeviceHours(),
+		PeakMinutes:    a.PeakMinutes,
 	}
-	if percentage > 100 {
-		percentage = 100
+}
+
+// DayStat holds the average usage of one day, for the week trend.
+type DayStat struct {
+	Day          string // "2006-01-02"
+	Type         calendar.DayType
+	AvgUsageRate float64
+}
+
+// ReportData is everything a report is built from; report templates access it as .Data.
+type ReportData struct {
+	Shop         models.Shop
+	Period       Period
+	TotalDevices int
+	Stats        DailyStats
+	Hourly       []HourlyStat
+	Rooms        []RoomStat
+	Trend        []DayStat   // daily averages of the seven days ending with the period
+	Previous     *DailyStats // the same-length period just before, nil if it has no data
+	Coverage     Coverage
+
+	// Daily reports: the day type, recent days of that type and a forecast of the next day.
+	DayType  calendar.DayType
+	DayLabel string // e.g. "节假日 (国庆节)"
+	Like     *LikeStats
+	Forecast *Forecast
+	// Weekly reports: usage by day type.
+	DayTypes []DayTypeProfile
+}
+
+// Period is the time range a report covers, [Start, End).
+type Period struct {
+	Kind  string // "daily" or "weekly", recorded in the report history
+	Start time.Time
+	End   time.Time
+	Label string // 用于报告标题，如 "昨日"、"2025-08-01"
+}
+
+// DailyPeriod returns the period covering the whole day of date in loc.
+func DailyPeriod(date time.Time, loc *time.Location) Period {
+	year, month, day := date.In(loc).Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	label := start.Format("2006-01-02")
+	if y, m, d := time.Now().In(loc).AddDate(0, 0, -1).Date(); y == year && m == month && d == day {
+		label = "昨日"
 	}
-	filledLength := int(percentage / 100 * float64(barLength))
-	return strings.Repeat("█", filledLength) + strings.Repeat("░", barLength-filledLength)
+	return Period{Kind: KindDaily, Start: start, End: start.AddDate(0, 0, 1), Label: label}
+}
+
+// WeeklyPeriod returns the seven days in loc ending with (and including) date.
+func WeeklyPeriod(date time.Time, loc *time.Location) Period {
+	end := DailyPeriod(date, loc).End
+	start := end.AddDate(0, 0, -7)
+	label := fmt.Sprintf("%s ~ %s 周", start.Format("01-02"), end.AddDate(0, 0, -1).Format("01-02"))
+	return Period{Kind: KindWeekly, Start: start, End: end, Label: label}
 }
 
-// GenerateAndSendDailyReport queries the database for yesterday's statistics and sends a report.
-func GenerateAndSendDailyReport(db *gorm.DB, commonCode string, barkTokens []string) {
-	log.Printf("Generating daily report for %s", commonCode)
+// ReportOptions controls how a report is delivered.
+type ReportOptions struct {
+	DryRun bool   // print the report instead of sending it, and don't record it
+	Format string // format used by DryRun, defaults to plain text
+	Force  bool   // send even if the report was already sent
+	// NoHistory neither checks nor records the report history, for leaderboards of some of
+	// the shops that must not stand in for the scheduled one of all shops.
+	NoHistory bool
+}
+
+// ErrNoData is returned when there are no snapshots in the report period.
+var ErrNoData = errors.New("no snapshots in report period")
+
+// GenerateAndSendReport builds the report for period and sends it, unless it was already sent.
+func GenerateAndSendReport(db *gorm.DB, commonCode string, channels []notification.Channel, period Period, opts ReportOptions) error {
+	log.Printf("Generating %s report for %s", period.Label, commonCode)
 
 	var shop models.Shop
 	if err := db.Where("common_code = ?", commonCode).First(&shop).Error; err != nil {
-		log.Printf("Could not find shop with common_code %s: %v", commonCode, err)
-		return
+		return fmt.Errorf("could not find shop with common_code %s: %w", commonCode, err)
+	}
+
+	if !opts.DryRun && !opts.Force && alreadySent(db, shop.ID, period) {
+		log.Printf("%s report for %s was already sent, skipping.", period.Label, shop.Name)
+		return nil
+	}
+
+	r, err := BuildReport(db, &shop, period)
+	if err != nil {
+		return err
+	}
+
+	if opts.DryRun {
+		return printDryRun(r, opts)
+	}
+	notification.SendReport(channels, r)
+	return recordSent(db, shop.ID, period)
+}
+
+// printDryRun prints r in the format of opts and saves its charts instead of sending it.
+func printDryRun(r *report.Report, opts ReportOptions) error {
+	format := opts.Format
+	if format == "" {
+		format = report.FormatText
+	}
+	text, err := report.Render(format, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	for _, path := range notification.SaveImages(r, "dry-run") {
+		fmt.Println("图表:", path)
+	}
+	return nil
+}
+
+// BuildReport collects the statistics of shop for period into a report.
+func BuildReport(db *gorm.DB, shop *models.Shop, period Period) (*report.Report, error) {
+	data, err := CollectReportData(db, shop, period)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &report.Report{
+		Title:    fmt.Sprintf("【%s】%s数据报告", shop.Name, period.Label),
+		Group:    shop.Name,
+		Template: "daily",
+		Data:     data,
+	}
+	summary := r.AddSection("")
+	if data.DayLabel != "" {
+		summary.AddMetric("日期类型", data.DayLabel)
+	}
+	summary.AddMetric("设备总数", strconv.Itoa(data.TotalDevices))
+	summary.AddMetric("记录数", strconv.FormatInt(data.Stats.RecordCount, 10))
+	summary.AddMetric("平均使用率", fmt.Sprintf("%.2f%%", data.Stats.AvgUsageRate))
+	summary.AddMetric("峰值使用率", fmt.Sprintf("%.2f%%", data.Stats.MaxUsageRate))
+	summary.AddMetric("平均在用", fmt.Sprintf("%.1f台", data.Stats.AvgUsedDevices))
+	summary.AddMetric("峰值在用", fmt.Sprintf("%.0f台", data.Stats.MaxUsedDevices))
+	summary.AddMetric("使用机时", fmt.Sprintf("%.1f台时", data.Stats.DeviceHours))
+	summary.AddMetric(fmt.Sprintf("高峰时长(≥%.0f%%)", rollup.PeakRate), report.Duration(data.Stats.PeakMinutes))
+	if data.Previous != nil {
+		summary.AddMetric("较上期", fmt.Sprintf("%+.2f%%", data.Stats.AvgUsageRate-data.Previous.AvgUsageRate))
+	}
+	if data.Like != nil {
+		summary.AddMetric(fmt.Sprintf("较近%d个%s", data.Like.Days, data.Like.Type.Label()),
+			fmt.Sprintf("%+.2f%%", data.Stats.AvgUsageRate-data.Like.Stats.AvgUsageRate))
+	}
+	summary.AddMetric("数据覆盖率", fmt.Sprintf("%.1f%% (%d/%d)", data.Coverage.Percent, data.Coverage.Actual, data.Coverage.Expected))
+	if data.Coverage.Low() {
+		summary.Lines = append(summary.Lines, data.Coverage.Warning())
+		if len(data.Coverage.Gaps) > 0 {
+			r.AddSection("数据缺口").Lines = data.Coverage.GapLines(period.Start.Location())
+		}
+	}
+
+	if len(data.Hourly) > 0 {
+		table := &report.Table{Columns: []string{"时段", "使用率", "在用台数", "采样"}}
+		for _, hs := range data.Hourly {
+			// 使用整数，更紧凑
+			table.Rows = append(table.Rows, []string{
+				hs.Hour + ":00",
+				fmt.Sprintf("%.0f%%", hs.AvgRate),
+				fmt.Sprintf("%.0f", hs.AvgUsedDevices),
+				fmt.Sprintf("%d/%d", hs.Polls, hs.ExpectedPolls),
+			})
+		}
+		r.AddSection("分时段使用率").Table = table
 	}
 
-	// --- Calculate yesterday's time range ---
-	now := time.Now()
-	year, month, day := now.Date()
-	todayStart := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
-	yesterdayStart := todayStart.AddDate(0, 0, -1)
+	if len(data.DayTypes) > 0 {
+		section := r.AddSection("按日期类型")
+		table := &report.Table{Columns: []string{"时段"}}
+		for _, p := range data.DayTypes {
+			section.AddMetric(fmt.Sprintf("%s (%d天)", p.Type.Label(), p.Days), fmt.Sprintf("%.2f%%", p.AvgUsageRate))
+			table.Columns = append(table.Columns, p.Type.Label())
+		}
+		for _, hs := range data.Hourly {
+			row := []string{hs.Hour + ":00"}
+			for _, p := range data.DayTypes {
+				row = append(row, p.HourlyRate(hs.Hour))
+			}
+			table.Rows = append(table.Rows, row)
+		}
+		if len(data.DayTypes) > 1 {
+			section.Table = table
+		}
+	}
 
-	// --- Query 1: Overall Daily Stats ---
-	var stats DailyStats
-	result := db.Model(&models.Snapshot{}).
-		Select("COUNT(*) as record_count, AVG(usage_rate) as avg_usage_rate, MAX(usage_rate) as max_usage_rate, AVG(used_devices) as avg_used_devices, MAX(used_devices) as max_used_devices").
-		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shop.ID, yesterdayStart, todayStart).
-		Group("shop_id").
-		Scan(&stats)
+	if len(data.Rooms) > 0 {
+		rooms := r.AddSection("各房间使用率")
+		for _, room := range data.Rooms {
+			rooms.AddMetric(room.Name, fmt.Sprintf("%.2f%% (峰值 %.0f%%, %.1f台时, 高峰 %s)",
+				room.AvgUsageRate, room.MaxUsageRate, room.DeviceHours, report.Duration(room.PeakMinutes)))
+		}
+	}
 
-	if result.Error != nil {
-		log.Printf("Error querying daily stats for shop %s: %v", shop.Name, result.Error)
-		return
+	if f := data.Forecast; f != nil {
+		r.AddSection("次日预测").Lines = []string{f.Summary()}
 	}
 
-	if stats.RecordCount == 0 {
-		log.Printf("No snapshots found for shop %s for yesterday.", shop.Name)
-		return
+	addCharts(r, data)
+	return r, nil
+}
+
+// CollectReportData runs the aggregation queries for shop over period.
+// Periods whose raw snapshots have been pruned are read from the rollup tables.
+func CollectReportData(db *gorm.DB, shop *models.Shop, period Period) (*ReportData, error) {
+	if useRollups(db, shop.ID, period.Start) {
+		return collectFromRollups(db, shop, period)
 	}
 
+	// --- Query 1: Snapshots of the period, averaged by the time each one stands for ---
+	samples, err := loadSamples(db, shop.ID, period.Start, period.End)
+	if err != nil {
+		return nil, fmt.Errorf("error querying daily stats for shop %s: %w", shop.Name, err)
+	}
+
+	if len(samples) == 0 {
+		return nil, ErrNoData
+	}
+	loc := period.Start.Location()
+	end := pollEnd(period.End)
+	stats := statsOf(rollup.Group(samples, end, whole)[""])
+
 	// --- Query 2: Get TotalDevices from the last snapshot ---
 	var lastSnapshot models.Snapshot
 	db.Model(&models.Snapshot{}).
-		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shop.ID, yesterdayStart, todayStart).
+		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shop.ID, period.Start.UTC(), period.End.UTC()).
 		Order("timestamp DESC").
 		First(&lastSnapshot)
 
-	// --- Query 3: Hourly Breakdown ---
+	// --- Query 3: Hourly Breakdown, with expected vs. actual polls ---
+	hours := rollup.Group(samples, end, func(s rollup.Sample) string { return s.Timestamp.In(loc).Format("15") })
+	expected := expectedPolls(period.Start, period.End, loc)
 	var hourlyStats []HourlyStat
-	db.Model(&models.Snapshot{}).
-		Select("strftime('%H', timestamp) as hour, AVG(usage_rate) as avg_rate, AVG(used_devices) as avg_used_devices").
-		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shop.ID, yesterdayStart, todayStart).
-		Group("hour").
-		Order("hour").
-		Scan(&hourlyStats)
-
-	// --- Format Report ---
-	var report strings.Builder
-	report.WriteString(fmt.Sprintf(
-		"【%s】昨日数据报告\n设备总数: %d\n记录数: %d\n平均使用率: %.2f%%\n峰值使用率: %.2f%%\n平均在用: %.1f台\n峰值在用: %.0f台\n",
-		shop.Name,
-		lastSnapshot.TotalDevices,
-		stats.RecordCount,
-		stats.AvgUsageRate,
-		stats.MaxUsageRate,
-		stats.AvgUsedDevices,
-		stats.MaxUsedDevices,
-	))
-
-	if len(hourlyStats) > 0 {
-		report.WriteString("\n--- 分时段使用率 ---\n")
-		// Create a map for easy lookup
-		hourlyMap := make(map[int]HourlyStat)
-		for _, hs := range hourlyStats {
-			hour, _ := strconv.Atoi(hs.Hour)
-			hourlyMap[hour] = hs
+	for h := 0; h < 24; h++ {
+		hour := fmt.Sprintf("%02d", h)
+		w, ok := hours[hour]
+		if !ok {
+			continue
 		}
+		hourlyStats = append(hourlyStats, HourlyStat{
+			Hour:           hour,
+			AvgRate:        w.AvgUsageRate(),
+			AvgUsedDevices: w.AvgUsedDevices(),
+			Polls:          w.Samples,
+			ExpectedPolls:  expected[h],
+		})
+	}
 
-		//report.WriteString("╔══════╦══════╦══════╗\n")
-		report.WriteString("║ 时段 ║ 使用率 ║ 在用台数 ║\n")
-		//report.WriteString("╠══════╬══════╬══════╣\n")
-		for h := 0; h < 24; h++ {
-			if hs, ok := hourlyMap[h]; ok {
-				// 使用整数，更紧凑
-				report.WriteString(fmt.Sprintf("║ %02d:00 ║  %3.0f%% ║    %2.0f    ║\n", h, hs.AvgRate, hs.AvgUsedDevices))
-			}
+	// --- Query 4: Per-room Breakdown ---
+	roomStats, err := queryRooms(db, shop.ID, period.Start, period.End)
+	if err != nil {
+		return nil, fmt.Errorf("error querying room stats for shop %s: %w", shop.Name, err)
+	}
+
+	data := &ReportData{
+		Shop:         *shop,
+		Period:       period,
+		TotalDevices: lastSnapshot.TotalDevices,
+		Stats:        stats,
+		Hourly:       hourlyStats,
+		Rooms:        roomStats,
+		Coverage:     coverageOf(samples, period.Start, period.End),
+	}
+
+	// --- Query 5: Week trend ---
+	data.Trend = queryTrend(db, shop.ID, period.End.AddDate(0, 0, -7), period.End)
+
+	// --- Query 6: Previous period for comparison ---
+	data.Previous = previousStats(db, shop.ID, period)
+
+	// --- Query 7: Days of the same type ---
+	addDayTypes(db, data)
+
+	return data, nil
+}
+
+func queryTrend(db *gorm.DB, shopID uint, start, end time.Time) []DayStat {
+	if useRollups(db, shopID, start) {
+		return rollupTrend(db, shopID, start, end)
+	}
+	samples, err := loadSamples(db, shopID, start, end)
+	if err != nil {
+		return nil
+	}
+	loc := start.Location()
+	days := rollup.Group(samples, pollEnd(end), func(s rollup.Sample) string { return s.Timestamp.In(loc).Format("2006-01-02") })
+	var trend []DayStat
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		if w, ok := days[day.Format("2006-01-02")]; ok {
+			trend = append(trend, DayStat{Day: day.Format("2006-01-02"), Type: calendar.TypeOf(day), AvgUsageRate: w.AvgUsageRate()})
 		}
 	}
+	return trend
+}
 
-	//fmt.Println(report.String())
-	notification.SendBarkNotifications(barkTokens, report.String(), shop.Name)
+// previousStats returns the stats of the same-length period just before period, or nil.
+func previousStats(db *gorm.DB, shopID uint, period Period) *DailyStats {
+	start := period.Start.Add(-period.End.Sub(period.Start))
+	var previous DailyStats
+	var err error
+	if useRollups(db, shopID, start) {
+		previous, err = rollupStats(db, shopID, start, period.Start)
+	} else {
+		previous, err = queryStats(db, shopID, start, period.Start)
+	}
+	if err != nil || previous.RecordCount == 0 {
+		return nil
+	}
+	return &previous
+}
+
+func queryStats(db *gorm.DB, shopID uint, start, end time.Time) (DailyStats, error) {
+	samples, err := loadSamples(db, shopID, start, end)
+	if err != nil || len(samples) == 0 {
+		return DailyStats{}, err
+	}
+	return statsOf(rollup.Group(samples, pollEnd(end), whole)[""]), nil
+}
+
+// queryRooms averages the room snapshots of [start, end) per room, weighted by time.
+func queryRooms(db *gorm.DB, shopID uint, start, end time.Time) ([]RoomStat, error) {
+	var rows []struct {
+		RoomID uint
+		Name   string
+		rollup.Sample
+	}
+	err := db.Model(&models.RoomSnapshot{}).
+		Select("room_snapshots.room_id, rooms.name as name, snapshots.timestamp, room_snapshots.total_devices, room_snapshots.used_devices, room_snapshots.usage_rate").
+		Joins("JOIN snapshots ON snapshots.id = room_snapshots.snapshot_id").
+		Joins("JOIN rooms ON rooms.id = room_snapshots.room_id").
+		Where("snapshots.shop_id = ? AND snapshots.timestamp >= ? AND snapshots.timestamp < ?", shopID, start.UTC(), end.UTC()).
+		Order("snapshots.timestamp").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make(map[uint][]rollup.Sample)
+	names := make(map[uint]string)
+	var order []uint
+	for _, row := range rows {
+		if _, ok := names[row.RoomID]; !ok {
+			names[row.RoomID] = row.Name
+			order = append(order, row.RoomID)
+		}
+		samples[row.RoomID] = append(samples[row.RoomID], row.Sample)
+	}
+	var stats []RoomStat
+	for _, roomID := range order {
+		stats = append(stats, roomStat(names[roomID], rollup.Group(samples[roomID], pollEnd(end), whole)[""]))
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].AvgUsageRate > stats[j].AvgUsageRate })
+	return stats, nil
 }
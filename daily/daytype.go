@@ -0,0 +1,171 @@
+package daily
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/calendar"
+	"wywk/rollup"
+)
+
+const (
+	// likeDays is how many recent days of the same type a day is compared with.
+	likeDays = 4
+	// likeLookback is how far back those days are searched for; holidays are rare.
+	likeLookback = 120
+)
+
+// LikeStats is the average of recent days of the same type, for like-for-like comparisons.
+type LikeStats struct {
+	Type  calendar.DayType
+	Days  int // number of days averaged, at most likeDays
+	Stats DailyStats
+}
+
+// Forecast is the expected usage of the day after a daily report, from recent days of its type.
+type Forecast struct {
+	Date         time.Time
+	Type         calendar.DayType
+	Days         int
+	AvgUsageRate float64
+	PeakHour     string
+	PeakRate     float64
+}
+
+// Summary describes the forecast in one line.
+func (f *Forecast) Summary() string {
+	return fmt.Sprintf("%s %s，参考近%d个同类日: 预计平均使用率 %.0f%%，%s:00 最忙 (%.0f%%)",
+		f.Date.Format("01-02"), calendar.Describe(f.Date), f.Days, f.AvgUsageRate, f.PeakHour, f.PeakRate)
+}
+
+// DayTypeProfile is the usage of the days of one type within a weekly report.
+type DayTypeProfile struct {
+	Type         calendar.DayType
+	Days         int
+	AvgUsageRate float64
+	Hourly       map[string]float64 // average usage by hour "00".."23"
+}
+
+// HourlyRate formats the average usage at hour ("00".."23") for tables: 0% is shown as
+// such, "-" means there was no data.
+func (p DayTypeProfile) HourlyRate(hour string) string {
+	rate, ok := p.Hourly[hour]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", rate)
+}
+
+// dayProfile accumulates whole days of snapshots, overall and by hour of day.
+type dayProfile struct {
+	days  int
+	total rollup.Aggregate
+	hours map[int]*rollup.Aggregate
+}
+
+// addDay adds the data of day, from raw snapshots or from hourly rollups once they have
+// been pruned, and reports whether there was any.
+func (p *dayProfile) addDay(db *gorm.DB, shopID uint, day Period) bool {
+	if p.hours == nil {
+		p.hours = make(map[int]*rollup.Aggregate)
+	}
+	hour := func(h int) *rollup.Aggregate {
+		if p.hours[h] == nil {
+			p.hours[h] = &rollup.Aggregate{}
+		}
+		return p.hours[h]
+	}
+	loc := day.Start.Location()
+
+	if useRollups(db, shopID, day.Start) {
+		rollups, err := hourlyRollups(db, shopID, day.Start, day.End)
+		if err != nil || len(rollups) == 0 {
+			return false
+		}
+		for _, r := range rollups {
+			p.total.AddShopRollup(r)
+			hour(r.PeriodStart.In(loc).Hour()).AddShopRollup(r)
+		}
+		p.days++
+		return true
+	}
+
+	samples, err := loadSamples(db, shopID, day.Start, day.End)
+	if err != nil || len(samples) == 0 {
+		return false
+	}
+	for i, minutes := range rollup.Spans(samples, pollEnd(day.End)) {
+		p.total.AddSample(samples[i], minutes)
+		hour(samples[i].Timestamp.In(loc).Hour()).AddSample(samples[i], minutes)
+	}
+	p.days++
+	return true
+}
+
+// recentLike profiles up to likeDays days of type t with data, going back from the day before before.
+func recentLike(db *gorm.DB, shopID uint, t calendar.DayType, before time.Time) *dayProfile {
+	p := &dayProfile{}
+	for i := 1; i <= likeLookback && p.days < likeDays; i++ {
+		day := DailyPeriod(before.AddDate(0, 0, -i), before.Location())
+		if calendar.TypeOf(day.Start) == t {
+			p.addDay(db, shopID, day)
+		}
+	}
+	return p
+}
+
+// addDayTypes fills in the day-type comparisons of data: for daily reports the average of
+// recent days of the same type and, for the latest report, a forecast of the next day;
+// for longer periods the usage of each day type.
+func addDayTypes(db *gorm.DB, data *ReportData) {
+	period := data.Period
+	loc := period.Start.Location()
+	if period.Kind != KindDaily {
+		profiles := make(map[calendar.DayType]*dayProfile)
+		for day := period.Start; day.Before(period.End); day = day.AddDate(0, 0, 1) {
+			t := calendar.TypeOf(day)
+			if profiles[t] == nil {
+				profiles[t] = &dayProfile{}
+			}
+			profiles[t].addDay(db, data.Shop.ID, DailyPeriod(day, loc))
+		}
+		for _, t := range calendar.Types {
+			if p := profiles[t]; p != nil && p.days > 0 {
+				profile := DayTypeProfile{Type: t, Days: p.days, AvgUsageRate: p.total.AvgUsageRate(), Hourly: make(map[string]float64)}
+				for h, a := range p.hours {
+					profile.Hourly[fmt.Sprintf("%02d", h)] = a.AvgUsageRate()
+				}
+				data.DayTypes = append(data.DayTypes, profile)
+			}
+		}
+		return
+	}
+
+	data.DayType = calendar.TypeOf(period.Start)
+	data.DayLabel = calendar.Describe(period.Start)
+	if like := recentLike(db, data.Shop.ID, data.DayType, period.Start); like.days > 0 {
+		data.Like = &LikeStats{Type: data.DayType, Days: like.days, Stats: statsOf(&like.total)}
+	}
+
+	// 只为最新的日报预测次日，补发的历史日报没有意义
+	y, m, d := time.Now().In(loc).Date()
+	if period.End.Before(time.Date(y, m, d, 0, 0, 0, 0, loc)) {
+		return
+	}
+	next := period.End
+	t := calendar.TypeOf(next)
+	like := recentLike(db, data.Shop.ID, t, next)
+	if like.days == 0 {
+		return
+	}
+	forecast := &Forecast{Date: next, Type: t, Days: like.days, AvgUsageRate: like.total.AvgUsageRate()}
+	for h := 0; h < 24; h++ {
+		if a, ok := like.hours[h]; ok && (forecast.PeakHour == "" || a.AvgUsageRate() > forecast.PeakRate) {
+			forecast.PeakHour = fmt.Sprintf("%02d", h)
+			forecast.PeakRate = a.AvgUsageRate()
+		}
+	}
+	data.Forecast = forecast
+}
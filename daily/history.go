@@ -0,0 +1,59 @@
+package daily
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+	"wywk/notification"
+)
+
+const (
+	KindDaily  = "daily"
+	KindWeekly = "weekly"
+)
+
+// alreadySent reports whether the report for period has been recorded in the history.
+// Period bounds are stored in UTC so that lookups don't depend on the zone they were built in.
+func alreadySent(db *gorm.DB, shopID uint, period Period) bool {
+	var count int64
+	db.Model(&models.ReportHistory{}).
+		Where("shop_id = ? AND kind = ? AND period_start = ?", shopID, period.Kind, period.Start.UTC()).
+		Count(&count)
+	return count > 0
+}
+
+func recordSent(db *gorm.DB, shopID uint, period Period) error {
+	history := models.ReportHistory{
+		ShopID:      shopID,
+		Kind:        period.Kind,
+		PeriodStart: period.Start.UTC(),
+	}
+	err := db.Where(history).
+		Assign(models.ReportHistory{PeriodEnd: period.End.UTC(), SentAt: time.Now().UTC()}).
+		FirstOrCreate(&history).Error
+	if err != nil {
+		return fmt.Errorf("failed to record sent report: %w", err)
+	}
+	return nil
+}
+
+// CatchUpDailyReports sends the daily reports of the last days days (up to yesterday in loc)
+// that have not been sent yet. Days without any snapshots are skipped.
+func CatchUpDailyReports(db *gorm.DB, commonCode string, channels []notification.Channel, days int, loc *time.Location) {
+	yesterday := time.Now().In(loc).AddDate(0, 0, -1)
+	for i := days - 1; i >= 0; i-- {
+		period := DailyPeriod(yesterday.AddDate(0, 0, -i), loc)
+		err := GenerateAndSendReport(db, commonCode, channels, period, ReportOptions{})
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Daily report %s for %s not sent: %v", period.Label, commonCode, err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package daily
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/chart"
+	"wywk/models"
+	"wywk/notification"
+	"wywk/report"
+)
+
+// ShopRank is one shop in a leaderboard.
+type ShopRank struct {
+	Shop        models.Shop
+	Stats       DailyStats
+	LastWeek    *DailyStats // the same period a week earlier, nil if it has no data
+	BusiestHour string      // "00".."23", in the time zone of the period
+	BusiestRate float64
+	Hourly      map[string]float64 // average usage by hour "00".."23"
+}
+
+// Growth is the change of the average usage rate versus a week earlier, in percentage points.
+func (r ShopRank) Growth() (float64, bool) {
+	if r.LastWeek == nil {
+		return 0, false
+	}
+	return r.Stats.AvgUsageRate - r.LastWeek.AvgUsageRate, true
+}
+
+// LeaderboardData ranks shops by average usage over a period; report JSON exposes it as .data.
+type LeaderboardData struct {
+	Period Period
+	Shops  []ShopRank
+}
+
+// leaderboardKind records leaderboards in the report history under shop 0, apart from shop reports.
+func leaderboardKind(period Period) Period {
+	period.Kind = "leaderboard-" + period.Kind
+	return period
+}
+
+// CollectLeaderboard gathers the statistics of the shops with commonCodes over period.
+// Shops without data in the period are left out.
+func CollectLeaderboard(db *gorm.DB, commonCodes []string, period Period) (*LeaderboardData, error) {
+	data := &LeaderboardData{Period: period}
+	loc := period.Start.Location()
+	for _, commonCode := range commonCodes {
+		var shop models.Shop
+		if err := db.Where("common_code = ?", commonCode).First(&shop).Error; err != nil {
+			log.Printf("Leaderboard skips %s: %v", commonCode, err)
+			continue
+		}
+
+		current := &dayProfile{}
+		lastWeek := &dayProfile{}
+		for day := period.Start; day.Before(period.End); day = day.AddDate(0, 0, 1) {
+			current.addDay(db, shop.ID, DailyPeriod(day, loc))
+			lastWeek.addDay(db, shop.ID, DailyPeriod(day.AddDate(0, 0, -7), loc))
+		}
+		if current.days == 0 {
+			continue
+		}
+
+		rank := ShopRank{Shop: shop, Stats: statsOf(&current.total), Hourly: make(map[string]float64)}
+		if lastWeek.days > 0 {
+			stats := statsOf(&lastWeek.total)
+			rank.LastWeek = &stats
+		}
+		for h := 0; h < 24; h++ {
+			a, ok := current.hours[h]
+			if !ok {
+				continue
+			}
+			hour := fmt.Sprintf("%02d", h)
+			rank.Hourly[hour] = a.AvgUsageRate()
+			if rank.BusiestHour == "" || a.AvgUsageRate() > rank.BusiestRate {
+				rank.BusiestHour, rank.BusiestRate = hour, a.AvgUsageRate()
+			}
+		}
+		data.Shops = append(data.Shops, rank)
+	}
+	if len(data.Shops) == 0 {
+		return nil, ErrNoData
+	}
+	sort.SliceStable(data.Shops, func(i, j int) bool { return data.Shops[i].Stats.AvgUsageRate > data.Shops[j].Stats.AvgUsageRate })
+	return data, nil
+}
+
+// BuildLeaderboard lays out the leaderboard of the shops with commonCodes as one report.
+func BuildLeaderboard(db *gorm.DB, commonCodes []string, period Period) (*report.Report, error) {
+	data, err := CollectLeaderboard(db, commonCodes, period)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &report.Report{
+		Title: fmt.Sprintf("【门店排行】%s", period.Label),
+		Group: "门店排行",
+		Data:  data,
+	}
+	table := &report.Table{Columns: []string{"排名", "店铺", "平均使用率", "峰值", "较上周", "最忙时段"}}
+	for i, shop := range data.Shops {
+		growth := "-"
+		if g, ok := shop.Growth(); ok {
+			growth = fmt.Sprintf("%+.1f%%", g)
+		}
+		table.Rows = append(table.Rows, []string{
+			strconv.Itoa(i + 1),
+			shop.Shop.Name,
+			fmt.Sprintf("%.1f%%", shop.Stats.AvgUsageRate),
+			fmt.Sprintf("%.0f%%", shop.Stats.MaxUsageRate),
+			growth,
+			fmt.Sprintf("%s:00 (%.0f%%)", shop.BusiestHour, shop.BusiestRate),
+		})
+	}
+	r.AddSection("").Table = table
+
+	if len(data.Shops) > 1 {
+		highlights := r.AddSection("亮点")
+		peak, growth := data.Shops[0], -1
+		for i, shop := range data.Shops {
+			if shop.Stats.MaxUsageRate > peak.Stats.MaxUsageRate {
+				peak = shop
+			}
+			if g, ok := shop.Growth(); ok {
+				if best, _ := data.Shops[max(growth, 0)].Growth(); growth < 0 || g > best {
+					growth = i
+				}
+			}
+		}
+		highlights.AddMetric("平均使用率最高", fmt.Sprintf("%s (%.1f%%)", data.Shops[0].Shop.Name, data.Shops[0].Stats.AvgUsageRate))
+		highlights.AddMetric("峰值最高", fmt.Sprintf("%s (%.0f%%)", peak.Shop.Name, peak.Stats.MaxUsageRate))
+		if g, _ := data.Shops[max(growth, 0)].Growth(); growth >= 0 && g > 0 {
+			highlights.AddMetric("较上周增长最多", fmt.Sprintf("%s (%+.1f%%)", data.Shops[growth].Shop.Name, g))
+		}
+	}
+
+	addLeaderboardChart(r, data)
+	return r, nil
+}
+
+// addLeaderboardChart draws the hourly usage of every shop into one chart. The legend uses
+// the ranks since the chart font has no CJK glyphs.
+func addLeaderboardChart(r *report.Report, data *LeaderboardData) {
+	var labels []string
+	for h := 0; h < 24; h++ {
+		labels = append(labels, fmt.Sprintf("%02d", h))
+	}
+	var series []chart.Series
+	for i, shop := range data.Shops {
+		s := chart.Series{Title: "#" + strconv.Itoa(i+1), Labels: labels, Max: 100, Unit: "%"}
+		for _, hour := range labels {
+			if rate, ok := shop.Hourly[hour]; ok {
+				s.Values = append(s.Values, rate)
+			} else {
+				s.Values = append(s.Values, math.NaN())
+			}
+		}
+		series = append(series, s)
+	}
+	png, err := chart.Lines("Hourly usage by shop (%)", series)
+	if err != nil {
+		log.Printf("Failed to render leaderboard chart: %v", err)
+		return
+	}
+	r.Images = append(r.Images, report.Image{Name: "leaderboard.png", Title: "各店分时段使用率 (编号对应排名)", PNG: png})
+}
+
+// SendLeaderboard sends the leaderboard of the shops with commonCodes for period as a single
+// message, unless it was already sent.
+func SendLeaderboard(db *gorm.DB, commonCodes []string, channels []notification.Channel, period Period, opts ReportOptions) error {
+	history := leaderboardKind(period)
+	if !opts.DryRun && !opts.Force && !opts.NoHistory && alreadySent(db, 0, history) {
+		log.Printf("%s leaderboard already sent, skipping", period.Label)
+		return nil
+	}
+	r, err := BuildLeaderboard(db, commonCodes, period)
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return printDryRun(r, opts)
+	}
+	notification.SendReport(channels, r)
+	if opts.NoHistory {
+		return nil
+	}
+	return recordSent(db, 0, history)
+}
+
+// CatchUpLeaderboards sends the daily leaderboards of the last days days (up to yesterday in
+// loc) that have not been sent yet.
+func CatchUpLeaderboards(db *gorm.DB, commonCodes []string, channels []notification.Channel, days int, loc *time.Location) {
+	yesterday := time.Now().In(loc).AddDate(0, 0, -1)
+	for i := days - 1; i >= 0; i-- {
+		period := DailyPeriod(yesterday.AddDate(0, 0, -i), loc)
+		err := SendLeaderboard(db, commonCodes, channels, period, ReportOptions{})
+		if err != nil && !errors.Is(err, ErrNoData) {
+			log.Printf("%s leaderboard not sent: %v", period.Label, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package daily
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/db/dbtest"
+	"wywk/models"
+	"wywk/notification"
+	"wywk/report"
+)
+
+// seedShop stores a shop with a snapshot every 10 minutes of day at usage used/total.
+func seedShop(t *testing.T, database *gorm.DB, commonCode string, used, total int) models.Shop {
+	t.Helper()
+	shop := models.Shop{CommonCode: commonCode, Name: commonCode}
+	if err := database.Create(&shop).Error; err != nil {
+		t.Fatalf("create shop: %v", err)
+	}
+	for m := 0; m < 24*60; m += 10 {
+		snapshot := models.Snapshot{
+			ShopID: shop.ID, Timestamp: minute(m), ShopStatus: "open",
+			TotalDevices: total, UsedDevices: used, UsageRate: float64(used) / float64(total) * 100,
+		}
+		if err := database.Create(&snapshot).Error; err != nil {
+			t.Fatalf("create snapshot: %v", err)
+		}
+	}
+	return shop
+}
+
+// recordingChannel keeps the titles of the reports sent through it.
+type recordingChannel struct{ titles []string }
+
+func (c *recordingChannel) Name() string   { return "recording" }
+func (c *recordingChannel) Format() string { return report.FormatText }
+func (c *recordingChannel) Send(title, body, group string, images []report.Image) error {
+	c.titles = append(c.titles, title)
+	return nil
+}
+
+func TestSendLeaderboardNarrowedKeepsScheduled(t *testing.T) {
+	database := dbtest.Open(t)
+	seedShop(t, database, "A", 2, 10)
+	seedShop(t, database, "B", 5, 10)
+	channel := &recordingChannel{}
+	channels := []notification.Channel{channel}
+	period := DailyPeriod(day, time.UTC)
+
+	// report --leaderboard --shop A
+	if err := SendLeaderboard(database, []string{"A"}, channels, period, ReportOptions{NoHistory: true}); err != nil {
+		t.Fatalf("narrowed leaderboard: %v", err)
+	}
+	if alreadySent(database, 0, leaderboardKind(period)) {
+		t.Fatal("narrowed leaderboard was recorded as sent")
+	}
+
+	// 定时发送的全部店铺排行不应被跳过，且只发送一次
+	for i := 0; i < 2; i++ {
+		if err := SendLeaderboard(database, []string{"A", "B"}, channels, period, ReportOptions{}); err != nil {
+			t.Fatalf("full leaderboard: %v", err)
+		}
+	}
+	if len(channel.titles) != 2 {
+		t.Fatalf("sent %d leaderboards, want 2: %q", len(channel.titles), channel.titles)
+	}
+	if !alreadySent(database, 0, leaderboardKind(period)) {
+		t.Error("full leaderboard was not recorded as sent")
+	}
+}
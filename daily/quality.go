@@ -0,0 +1,196 @@
+package daily
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+	"wywk/rollup"
+)
+
+var (
+	mu          sync.RWMutex
+	minCoverage = 90.0
+)
+
+// SetMinCoverage sets the coverage percentage below which reports carry a data-quality
+// warning; set from the config.
+func SetMinCoverage(percent float64) {
+	mu.Lock()
+	minCoverage = percent
+	mu.Unlock()
+}
+
+// MinCoverage returns the threshold set by SetMinCoverage.
+func MinCoverage() float64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	return minCoverage
+}
+
+// Gap is a stretch of time without snapshots, longer than two crawl intervals.
+type Gap struct {
+	Start time.Time
+	End   time.Time
+}
+
+// maxListedGaps keeps the gap list of a report short.
+const maxListedGaps = 5
+
+// In returns the gap with its times in loc.
+func (g Gap) In(loc *time.Location) Gap {
+	return Gap{Start: g.Start.In(loc), End: g.End.In(loc)}
+}
+
+func (g Gap) String() string {
+	layout := "15:04"
+	if g.End.Sub(g.Start) >= 24*time.Hour || g.Start.YearDay() != g.End.YearDay() {
+		layout = "01-02 15:04"
+	}
+	return fmt.Sprintf("%s ~ %s", g.Start.Format(layout), g.End.Format(layout))
+}
+
+// Coverage compares the polls a period should have had with the ones that were recorded.
+type Coverage struct {
+	Expected int
+	Actual   int
+	Percent  float64
+	Gaps     []Gap
+}
+
+// Low reports whether the coverage is below MinCoverage.
+func (c Coverage) Low() bool {
+	return c.Expected > 0 && c.Percent < MinCoverage()
+}
+
+// Warning is the line reports carry when the coverage is low.
+func (c Coverage) Warning() string {
+	return fmt.Sprintf("⚠️ 数据覆盖率仅 %.1f%%，低于 %.0f%%，统计可能不准确", c.Percent, MinCoverage())
+}
+
+// GapLines lists the gaps in loc for reports, at most maxListedGaps of them and then the total.
+func (c Coverage) GapLines(loc *time.Location) []string {
+	var lines []string
+	for i, gap := range c.Gaps {
+		if i == maxListedGaps {
+			lines = append(lines, fmt.Sprintf("等共 %d 处", len(c.Gaps)))
+			break
+		}
+		lines = append(lines, gap.In(loc).String())
+	}
+	return lines
+}
+
+func loadSamples(db *gorm.DB, shopID uint, start, end time.Time) ([]rollup.Sample, error) {
+	var samples []rollup.Sample
+	err := db.Model(&models.Snapshot{}).
+		Select("timestamp, total_devices, used_devices, usage_rate").
+		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shopID, start.UTC(), end.UTC()).
+		Order("timestamp").
+		Scan(&samples).Error
+	return samples, err
+}
+
+// statsOf turns an aggregate into the statistics shown in reports.
+func statsOf(a *rollup.Aggregate) DailyStats {
+	return DailyStats{
+		AvgUsageRate:   a.AvgUsageRate(),
+		MaxUsageRate:   a.MaxUsageRate,
+		AvgUsedDevices: a.AvgUsedDevices(),
+		MaxUsedDevices: float64(a.MaxUsedDevices),
+		RecordCount:    int64(a.Samples),
+		DeviceHours:    a.DeviceHours(),
+		PeakMinutes:    a.PeakMinutes,
+	}
+}
+
+// whole is a grouping key putting every sample into one group.
+func whole(rollup.Sample) string { return "" }
+
+// pollEnd is where expected polls stop: the end of the period, or now for the current period.
+func pollEnd(end time.Time) time.Time {
+	if now := time.Now(); now.Before(end) {
+		return now
+	}
+	return end
+}
+
+// expectedPolls counts the polls per hour of day (in loc) that [start, end) should have had.
+func expectedPolls(start, end time.Time, loc *time.Location) map[int]int {
+	expected := make(map[int]int)
+	end = pollEnd(end)
+	interval := rollup.CrawlInterval()
+	for hour := start; hour.Before(end); hour = hour.Add(time.Hour) {
+		span := min(end.Sub(hour), time.Hour)
+		expected[hour.In(loc).Hour()] += int(span / interval)
+	}
+	return expected
+}
+
+// coverageOf measures the polls of [start, end) from sample timestamps. Several snapshots
+// within the same crawl interval count once.
+func coverageOf(samples []rollup.Sample, start, end time.Time) Coverage {
+	end = pollEnd(end)
+	var c Coverage
+	if !start.Before(end) {
+		return c
+	}
+	interval := rollup.CrawlInterval()
+	c.Expected = int(end.Sub(start) / interval)
+	slots := make(map[int64]bool)
+	previous := start
+	for _, s := range samples {
+		slots[int64(s.Timestamp.Sub(start)/interval)] = true
+		if s.Timestamp.Sub(previous) > 2*interval {
+			c.Gaps = append(c.Gaps, Gap{Start: previous, End: s.Timestamp})
+		}
+		previous = s.Timestamp
+	}
+	if end.Sub(previous) > 2*interval {
+		c.Gaps = append(c.Gaps, Gap{Start: previous, End: end})
+	}
+	c.Actual = min(len(slots), c.Expected)
+	if c.Expected > 0 {
+		c.Percent = float64(c.Actual) / float64(c.Expected) * 100
+	}
+	return c
+}
+
+// rollupCoverage measures coverage from hourly rollups once raw snapshots have been pruned;
+// gaps are whole hours without a rollup.
+func rollupCoverage(rollups []models.ShopRollup, start, end time.Time) Coverage {
+	end = pollEnd(end)
+	var c Coverage
+	interval := rollup.CrawlInterval()
+	perHour := int(time.Hour / interval)
+	byHour := make(map[time.Time]int)
+	for _, r := range rollups {
+		byHour[r.PeriodStart.UTC()] = r.Samples
+	}
+	var gap *Gap
+	for hour := start; hour.Before(end); hour = hour.Add(time.Hour) {
+		expected := int(min(end.Sub(hour), time.Hour) / interval)
+		c.Expected += expected
+		samples, ok := byHour[hour.UTC()]
+		c.Actual += min(samples, expected, perHour)
+		if ok {
+			gap = nil
+			continue
+		}
+		if gap == nil {
+			c.Gaps = append(c.Gaps, Gap{Start: hour})
+			gap = &c.Gaps[len(c.Gaps)-1]
+		}
+		gap.End = hour.Add(time.Hour)
+		if gap.End.After(end) {
+			gap.End = end
+		}
+	}
+	if c.Expected > 0 {
+		c.Percent = float64(c.Actual) / float64(c.Expected) * 100
+	}
+	return c
+}
@@ -0,0 +1,169 @@
+package daily
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"wywk/models"
+	"wywk/rollup"
+)
+
+var day = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func minute(m int) time.Time {
+	return day.Add(time.Duration(m) * time.Minute)
+}
+
+func samplesAt(minutes ...int) []rollup.Sample {
+	samples := make([]rollup.Sample, len(minutes))
+	for i, m := range minutes {
+		samples[i] = rollup.Sample{Timestamp: minute(m)}
+	}
+	return samples
+}
+
+// percent computes like the code under test, so results compare exactly.
+func percent(actual, expected int) float64 {
+	return float64(actual) / float64(expected) * 100
+}
+
+func TestCoverageOf(t *testing.T) {
+	defer rollup.SetCrawlInterval(rollup.CrawlInterval())
+	rollup.SetCrawlInterval(10 * time.Minute)
+
+	tests := []struct {
+		name       string
+		samples    []rollup.Sample
+		start, end time.Time
+		want       Coverage
+	}{
+		{
+			name:  "empty period",
+			start: minute(60), end: minute(60),
+			want: Coverage{},
+		},
+		{
+			name:    "full",
+			samples: samplesAt(0, 10, 20, 30, 40, 50),
+			start:   minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Actual: 6, Percent: 100},
+		},
+		{
+			name:    "same interval counts once",
+			samples: samplesAt(0, 1, 2, 10, 20, 30, 40, 50),
+			start:   minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Actual: 6, Percent: 100},
+		},
+		{
+			name:    "gap in the middle",
+			samples: samplesAt(0, 10, 40, 50),
+			start:   minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Actual: 4, Percent: percent(4, 6), Gaps: []Gap{{minute(10), minute(40)}}},
+		},
+		{
+			name:    "gap at the end",
+			samples: samplesAt(0, 10),
+			start:   minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Actual: 2, Percent: percent(2, 6), Gaps: []Gap{{minute(10), minute(60)}}},
+		},
+		{
+			name:  "no samples",
+			start: minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Gaps: []Gap{{minute(0), minute(60)}}},
+		},
+		{
+			name:    "short delays are no gap",
+			samples: samplesAt(5, 25, 45),
+			start:   minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Actual: 3, Percent: 50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coverageOf(tt.samples, tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coverageOf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollupCoverage(t *testing.T) {
+	defer rollup.SetCrawlInterval(rollup.CrawlInterval())
+	rollup.SetCrawlInterval(10 * time.Minute)
+
+	hour := func(h, samples int) models.ShopRollup {
+		return models.ShopRollup{PeriodStart: minute(60 * h), Samples: samples}
+	}
+	tests := []struct {
+		name       string
+		rollups    []models.ShopRollup
+		start, end time.Time
+		want       Coverage
+	}{
+		{
+			name:    "full",
+			rollups: []models.ShopRollup{hour(0, 6), hour(1, 6)},
+			start:   minute(0), end: minute(120),
+			want: Coverage{Expected: 12, Actual: 12, Percent: 100},
+		},
+		{
+			name:    "extra samples capped per hour",
+			rollups: []models.ShopRollup{hour(0, 9), hour(1, 3)},
+			start:   minute(0), end: minute(120),
+			want: Coverage{Expected: 12, Actual: 9, Percent: 75},
+		},
+		{
+			name:    "missing hours merge into one gap",
+			rollups: []models.ShopRollup{hour(0, 6), hour(3, 6)},
+			start:   minute(0), end: minute(240),
+			want: Coverage{Expected: 24, Actual: 12, Percent: 50, Gaps: []Gap{{minute(60), minute(180)}}},
+		},
+		{
+			name:    "partial last hour",
+			rollups: []models.ShopRollup{hour(0, 6)},
+			start:   minute(0), end: minute(90),
+			want: Coverage{Expected: 9, Actual: 6, Percent: percent(6, 9), Gaps: []Gap{{minute(60), minute(90)}}},
+		},
+		{
+			name:  "no rollups",
+			start: minute(0), end: minute(60),
+			want: Coverage{Expected: 6, Gaps: []Gap{{minute(0), minute(60)}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollupCoverage(tt.rollups, tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rollupCoverage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGapLines(t *testing.T) {
+	gaps := func(n int) Coverage {
+		var c Coverage
+		for i := 0; i < n; i++ {
+			c.Gaps = append(c.Gaps, Gap{minute(60 * i), minute(60*i + 30)})
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		coverage Coverage
+		want     []string
+	}{
+		{"none", gaps(0), nil},
+		{"one", gaps(1), []string{"08:00 ~ 08:30"}},
+		{"truncated", gaps(7), []string{"08:00 ~ 08:30", "09:00 ~ 09:30", "10:00 ~ 10:30", "11:00 ~ 11:30", "12:00 ~ 12:30", "等共 7 处"}},
+		{"across days", Coverage{Gaps: []Gap{{minute(15 * 60), minute(17 * 60)}}}, []string{"03-02 23:00 ~ 03-03 01:00"}},
+	}
+	loc := time.FixedZone("CST", 8*3600)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.coverage.GapLines(loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GapLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
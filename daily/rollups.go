@@ -0,0 +1,136 @@
+package daily
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/calendar"
+	"wywk/models"
+	"wywk/rollup"
+)
+
+// useRollups reports whether data starting at start has to come from the rollup tables,
+// i.e. raw snapshots from start on have been pruned. Pruning shows as hourly rollups that
+// end before the first raw snapshot left; a shop that was first crawled after start has none.
+func useRollups(db *gorm.DB, shopID uint, start time.Time) bool {
+	var first models.Snapshot
+	db.Where("shop_id = ?", shopID).Order("timestamp").Limit(1).Find(&first)
+	if first.ID != 0 && !first.Timestamp.After(start) {
+		return false
+	}
+	query := db.Model(&models.ShopRollup{}).
+		Where("shop_id = ? AND granularity = ? AND period_start >= ?", shopID, rollup.Hour, start.UTC())
+	if first.ID != 0 {
+		query = query.Where("period_start <= ?", first.Timestamp.Add(-time.Hour).UTC())
+	}
+	var count int64
+	query.Count(&count)
+	return count > 0
+}
+
+func hourlyRollups(db *gorm.DB, shopID uint, start, end time.Time) ([]models.ShopRollup, error) {
+	var rollups []models.ShopRollup
+	err := db.Where("shop_id = ? AND granularity = ? AND period_start >= ? AND period_start < ?", shopID, rollup.Hour, start.UTC(), end.UTC()).
+		Order("period_start").
+		Find(&rollups).Error
+	return rollups, err
+}
+
+func rollupStats(db *gorm.DB, shopID uint, start, end time.Time) (DailyStats, error) {
+	rollups, err := hourlyRollups(db, shopID, start, end)
+	if err != nil {
+		return DailyStats{}, err
+	}
+	var total rollup.Aggregate
+	for _, r := range rollups {
+		total.AddShopRollup(r)
+	}
+	return statsOf(&total), nil
+}
+
+// collectFromRollups builds the same data as CollectReportData from hourly and daily rollups.
+func collectFromRollups(db *gorm.DB, shop *models.Shop, period Period) (*ReportData, error) {
+	rollups, err := hourlyRollups(db, shop.ID, period.Start, period.End)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rollups for shop %s: %w", shop.Name, err)
+	}
+	if len(rollups) == 0 {
+		return nil, ErrNoData
+	}
+
+	stats, _ := rollupStats(db, shop.ID, period.Start, period.End)
+	data := &ReportData{
+		Shop:         *shop,
+		Period:       period,
+		TotalDevices: rollups[len(rollups)-1].TotalDevices,
+		Stats:        stats,
+		Coverage:     rollupCoverage(rollups, period.Start, period.End),
+	}
+
+	// 按小时（报告时区）汇总
+	hours := make(map[int]*rollup.Aggregate)
+	for _, r := range rollups {
+		hour := r.PeriodStart.In(period.Start.Location()).Hour()
+		if hours[hour] == nil {
+			hours[hour] = &rollup.Aggregate{}
+		}
+		hours[hour].AddShopRollup(r)
+	}
+	expected := expectedPolls(period.Start, period.End, period.Start.Location())
+	for h := 0; h < 24; h++ {
+		if w, ok := hours[h]; ok {
+			data.Hourly = append(data.Hourly, HourlyStat{
+				Hour:           fmt.Sprintf("%02d", h),
+				AvgRate:        w.AvgUsageRate(),
+				AvgUsedDevices: w.AvgUsedDevices(),
+				Polls:          w.Samples,
+				ExpectedPolls:  expected[h],
+			})
+		}
+	}
+
+	var roomRollups []struct {
+		models.RoomRollup
+		Name string
+	}
+	db.Table("room_rollups").
+		Select("room_rollups.*, rooms.name AS name").
+		Joins("JOIN rooms ON rooms.id = room_rollups.room_id").
+		Where("rooms.shop_id = ? AND room_rollups.granularity = ? AND room_rollups.period_start >= ? AND room_rollups.period_start < ?",
+			shop.ID, rollup.Hour, period.Start.UTC(), period.End.UTC()).
+		Scan(&roomRollups)
+	names := make(map[uint]string)
+	rooms := make(map[uint]*rollup.Aggregate)
+	for _, r := range roomRollups {
+		if rooms[r.RoomID] == nil {
+			names[r.RoomID] = r.Name
+			rooms[r.RoomID] = &rollup.Aggregate{}
+		}
+		rooms[r.RoomID].AddRoomRollup(r.RoomRollup)
+	}
+	for roomID, a := range rooms {
+		data.Rooms = append(data.Rooms, roomStat(names[roomID], a))
+	}
+	sort.Slice(data.Rooms, func(i, j int) bool { return data.Rooms[i].AvgUsageRate > data.Rooms[j].AvgUsageRate })
+
+	data.Trend = rollupTrend(db, shop.ID, period.End.AddDate(0, 0, -7), period.End)
+	data.Previous = previousStats(db, shop.ID, period)
+	addDayTypes(db, data)
+	return data, nil
+}
+
+func rollupTrend(db *gorm.DB, shopID uint, start, end time.Time) []DayStat {
+	var days []models.ShopRollup
+	db.Where("shop_id = ? AND granularity = ? AND period_start >= ? AND period_start < ?", shopID, rollup.Day, start.UTC(), end.UTC()).
+		Order("period_start").
+		Find(&days)
+	var trend []DayStat
+	for _, d := range days {
+		day := d.PeriodStart.In(start.Location())
+		trend = append(trend, DayStat{Day: day.Format("2006-01-02"), Type: calendar.TypeOf(day), AvgUsageRate: d.AvgUsageRate})
+	}
+	return trend
+}
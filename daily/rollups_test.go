@@ -0,0 +1,124 @@
+package daily
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/db/dbtest"
+	"wywk/models"
+	"wywk/rollup"
+)
+
+var cst = time.FixedZone("CST", 8*3600)
+
+// seedRooms stores a shop with rooms of 4 and 6 devices polled every ten minutes of the
+// day at start, except between 12:00 and 14:00, with usage changing by the hour.
+func seedRooms(t *testing.T, database *gorm.DB, start time.Time) models.Shop {
+	t.Helper()
+	shop := models.Shop{CommonCode: "A", Name: "A"}
+	if err := database.Create(&shop).Error; err != nil {
+		t.Fatal(err)
+	}
+	rooms := []models.Room{{ShopID: shop.ID, Code: "R1", Name: "包间", TotalDevices: 4}, {ShopID: shop.ID, Code: "R2", Name: "大厅", TotalDevices: 6}}
+	if err := database.Create(&rooms).Error; err != nil {
+		t.Fatal(err)
+	}
+	for m := 0; m < 24*60; m += 10 {
+		h := m / 60
+		if h == 12 || h == 13 {
+			continue
+		}
+		small, large := h%5, min(h%7, 6)
+		used := small + large
+		snapshot := models.Snapshot{
+			ShopID: shop.ID, Timestamp: start.Add(time.Duration(m) * time.Minute).UTC(), ShopStatus: "营业中",
+			TotalDevices: 10, UsedDevices: used, UsageRate: float64(used) * 10,
+			RoomSnapshots: []models.RoomSnapshot{
+				{RoomID: rooms[0].ID, TotalDevices: 4, UsedDevices: min(small, 4), UsageRate: float64(min(small, 4)) * 25},
+				{RoomID: rooms[1].ID, TotalDevices: 6, UsedDevices: large, UsageRate: float64(large) / 6 * 100},
+			},
+		}
+		if err := database.Create(&snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return shop
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestReportFromRollupsMatchesSnapshots(t *testing.T) {
+	defer rollup.SetCrawlInterval(rollup.CrawlInterval())
+	rollup.SetCrawlInterval(10 * time.Minute)
+
+	dbtest.Each(t, func(t *testing.T, database *gorm.DB) {
+		period := DailyPeriod(time.Date(2026, 3, 2, 12, 0, 0, 0, cst), cst)
+		shop := seedRooms(t, database, period.Start)
+		if err := rollup.Rebuild(database, shop.ID, period.Start, period.End, cst); err != nil {
+			t.Fatalf("Rebuild: %v", err)
+		}
+		fromSnapshots, err := CollectReportData(database, &shop, period)
+		if err != nil {
+			t.Fatalf("CollectReportData from snapshots: %v", err)
+		}
+
+		// 清理原始快照后，报告改从汇总数据生成，结果应当一致
+		database.Exec("DELETE FROM room_snapshots")
+		database.Exec("DELETE FROM snapshots")
+		fromRollups, err := CollectReportData(database, &shop, period)
+		if err != nil {
+			t.Fatalf("CollectReportData from rollups: %v", err)
+		}
+
+		a, b := fromSnapshots, fromRollups
+		if a.TotalDevices != b.TotalDevices || a.Stats.RecordCount != b.Stats.RecordCount || a.Stats.RecordCount != 132 {
+			t.Errorf("devices %d vs %d, records %d vs %d, want 132 records", a.TotalDevices, b.TotalDevices, a.Stats.RecordCount, b.Stats.RecordCount)
+		}
+		stats := []struct {
+			name string
+			a, b float64
+		}{
+			{"avg usage", a.Stats.AvgUsageRate, b.Stats.AvgUsageRate},
+			{"max usage", a.Stats.MaxUsageRate, b.Stats.MaxUsageRate},
+			{"avg used", a.Stats.AvgUsedDevices, b.Stats.AvgUsedDevices},
+			{"max used", a.Stats.MaxUsedDevices, b.Stats.MaxUsedDevices},
+			{"device hours", a.Stats.DeviceHours, b.Stats.DeviceHours},
+			{"peak minutes", a.Stats.PeakMinutes, b.Stats.PeakMinutes},
+		}
+		for _, s := range stats {
+			if !near(s.a, s.b) {
+				t.Errorf("%s: %v from snapshots, %v from rollups", s.name, s.a, s.b)
+			}
+		}
+
+		if len(a.Hourly) != 22 || len(b.Hourly) != 22 {
+			t.Fatalf("got %d hours from snapshots and %d from rollups, want 22", len(a.Hourly), len(b.Hourly))
+		}
+		byHour := make(map[string]HourlyStat)
+		for _, h := range a.Hourly {
+			byHour[h.Hour] = h
+		}
+		for _, h := range b.Hourly {
+			s := byHour[h.Hour]
+			if !near(s.AvgRate, h.AvgRate) || !near(s.AvgUsedDevices, h.AvgUsedDevices) || s.Polls != h.Polls {
+				t.Errorf("hour %s: %+v from snapshots, %+v from rollups", h.Hour, s, h)
+			}
+		}
+
+		if len(a.Rooms) != 2 || len(b.Rooms) != 2 {
+			t.Fatalf("got %d rooms from snapshots and %d from rollups, want 2", len(a.Rooms), len(b.Rooms))
+		}
+		for i := range a.Rooms {
+			ra, rb := a.Rooms[i], b.Rooms[i]
+			if ra.Name != rb.Name || ra.TotalDevices != rb.TotalDevices || !near(ra.AvgUsageRate, rb.AvgUsageRate) ||
+				!near(ra.MaxUsageRate, rb.MaxUsageRate) || !near(ra.DeviceHours, rb.DeviceHours) || !near(ra.PeakMinutes, rb.PeakMinutes) {
+				t.Errorf("room %d: %+v from snapshots, %+v from rollups", i, ra, rb)
+			}
+		}
+	})
+}
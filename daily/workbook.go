@@ -0,0 +1,322 @@
+package daily
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+const (
+	sheetSummary  = "概览"
+	sheetHourly   = "分时段"
+	sheetRooms    = "房间"
+	sheetDayTypes = "日期类型"
+	sheetRaw      = "原始数据"
+)
+
+// SaveWorkbook writes the report of commonCode for period as an .xlsx file in dir and returns its path.
+func SaveWorkbook(db *gorm.DB, commonCode string, period Period, dir string) (string, error) {
+	var shop models.Shop
+	if err := db.Where("common_code = ?", commonCode).First(&shop).Error; err != nil {
+		return "", fmt.Errorf("could not find shop with common_code %s: %w", commonCode, err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s-%s.xlsx", commonCode, period.Kind, period.Start.Format("20060102")))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteWorkbook(db, &shop, period, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// WriteWorkbook writes the report of shop for period as an Excel workbook with summary, hourly,
+// room and raw snapshot sheets, and for weekly reports a day type heatmap. It uses the same
+// data as the sent report, plus native Excel charts.
+func WriteWorkbook(db *gorm.DB, shop *models.Shop, period Period, w io.Writer) error {
+	data, err := CollectReportData(db, shop, period)
+	if err != nil {
+		return err
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName("Sheet1", sheetSummary); err != nil {
+		return err
+	}
+	sheets := []string{sheetHourly, sheetRooms, sheetRaw}
+	if len(data.DayTypes) > 0 {
+		sheets = []string{sheetHourly, sheetRooms, sheetDayTypes, sheetRaw}
+	}
+	for _, name := range sheets {
+		if _, err := f.NewSheet(name); err != nil {
+			return err
+		}
+	}
+	percent, _ := f.NewStyle(&excelize.Style{NumFmt: 2}) // 0.00, rates are already in percent
+	header, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+
+	if err := writeSummarySheet(f, data, header, percent); err != nil {
+		return err
+	}
+	if err := writeHourlySheet(f, data, header, percent); err != nil {
+		return err
+	}
+	if err := writeRoomsSheet(f, data, header, percent); err != nil {
+		return err
+	}
+	if err := writeDayTypesSheet(f, data, header, percent); err != nil {
+		return err
+	}
+	if err := writeRawSheet(f, db, shop.ID, period, header); err != nil {
+		return err
+	}
+	return f.Write(w)
+}
+
+func writeSummarySheet(f *excelize.File, data *ReportData, header, percent int) error {
+	s := sheetSummary
+	rows := [][]any{
+		{"店铺", data.Shop.Name},
+		{"编码", data.Shop.CommonCode},
+		{"报告", data.Period.Label},
+		{"开始", excelTime(data.Period.Start)},
+		{"结束", excelTime(data.Period.End)},
+		{"设备总数", data.TotalDevices},
+		{"记录数", data.Stats.RecordCount},
+		{"平均使用率(%)", data.Stats.AvgUsageRate},
+		{"峰值使用率(%)", data.Stats.MaxUsageRate},
+		{"平均在用(台)", data.Stats.AvgUsedDevices},
+		{"峰值在用(台)", data.Stats.MaxUsedDevices},
+		{"使用机时(台时)", data.Stats.DeviceHours},
+		{"高峰时长(分)", data.Stats.PeakMinutes},
+	}
+	if data.Previous != nil {
+		rows = append(rows, []any{"较上期(%)", data.Stats.AvgUsageRate - data.Previous.AvgUsageRate})
+	}
+	if data.DayLabel != "" {
+		rows = append(rows, []any{"日期类型", data.DayLabel})
+	}
+	if data.Like != nil {
+		rows = append(rows, []any{fmt.Sprintf("较近%d个%s(%%)", data.Like.Days, data.Like.Type.Label()), data.Stats.AvgUsageRate - data.Like.Stats.AvgUsageRate})
+	}
+	if data.Forecast != nil {
+		rows = append(rows, []any{"次日预测", data.Forecast.Summary()})
+	}
+	rows = append(rows, []any{"数据覆盖率(%)", data.Coverage.Percent})
+	coverageRow := len(rows)
+	rows = append(rows, []any{"采样/应采", fmt.Sprintf("%d/%d", data.Coverage.Actual, data.Coverage.Expected)})
+	if data.Coverage.Low() {
+		rows = append(rows, []any{"数据质量", data.Coverage.Warning()})
+	}
+	for i, row := range rows {
+		if err := f.SetSheetRow(s, fmt.Sprintf("A%d", i+1), &row); err != nil {
+			return err
+		}
+	}
+	dateTime, _ := f.NewStyle(&excelize.Style{CustomNumFmt: ptr("yyyy-mm-dd hh:mm")})
+	_ = f.SetCellStyle(s, "A1", fmt.Sprintf("A%d", len(rows)), header)
+	_ = f.SetCellStyle(s, "B4", "B5", dateTime)
+	_ = f.SetCellStyle(s, "B8", "B10", percent)
+	_ = f.SetCellStyle(s, fmt.Sprintf("B%d", coverageRow), fmt.Sprintf("B%d", coverageRow), percent)
+	_ = f.SetColWidth(s, "A", "A", 16)
+	_ = f.SetColWidth(s, "B", "B", 20)
+
+	if len(data.Trend) == 0 {
+		return nil
+	}
+	// 近7日趋势放在右侧，并画柱状图
+	_ = f.SetSheetRow(s, "D1", &[]any{"日期", "平均使用率(%)", "类型"})
+	_ = f.SetCellStyle(s, "D1", "F1", header)
+	for i, day := range data.Trend {
+		_ = f.SetSheetRow(s, fmt.Sprintf("D%d", i+2), &[]any{day.Day, day.AvgUsageRate, day.Type.Label()})
+	}
+	_ = f.SetCellStyle(s, "E2", fmt.Sprintf("E%d", len(data.Trend)+1), percent)
+	_ = f.SetColWidth(s, "D", "E", 14)
+	last := len(data.Trend) + 1
+	return f.AddChart(s, "G1", &excelize.Chart{
+		Type:   excelize.Col,
+		Series: []excelize.ChartSeries{series(s, "E", 2, last, "D")},
+		Title:  []excelize.RichTextRun{{Text: "近7日趋势"}},
+		Legend: excelize.ChartLegend{Position: "none"},
+		YAxis:  excelize.ChartAxis{Minimum: ptr(0.0), Maximum: ptr(100.0), MajorGridLines: true},
+	})
+}
+
+func writeHourlySheet(f *excelize.File, data *ReportData, header, percent int) error {
+	s := sheetHourly
+	_ = f.SetSheetRow(s, "A1", &[]any{"时段", "平均使用率(%)", "平均在用(台)", "采样", "应采"})
+	_ = f.SetCellStyle(s, "A1", "E1", header)
+	for i, hs := range data.Hourly {
+		_ = f.SetSheetRow(s, fmt.Sprintf("A%d", i+2), &[]any{hs.Hour + ":00", hs.AvgRate, hs.AvgUsedDevices, hs.Polls, hs.ExpectedPolls})
+	}
+	_ = f.SetColWidth(s, "A", "E", 14)
+	if len(data.Hourly) == 0 {
+		return nil
+	}
+	last := len(data.Hourly) + 1
+	_ = f.SetCellStyle(s, "B2", fmt.Sprintf("C%d", last), percent)
+	return f.AddChart(s, "G1", &excelize.Chart{
+		Type:      excelize.Line,
+		Series:    []excelize.ChartSeries{series(s, "B", 2, last, "A")},
+		Title:     []excelize.RichTextRun{{Text: "分时段使用率"}},
+		Legend:    excelize.ChartLegend{Position: "none"},
+		YAxis:     excelize.ChartAxis{Minimum: ptr(0.0), Maximum: ptr(100.0), MajorGridLines: true},
+		Dimension: excelize.ChartDimension{Width: 720, Height: 360},
+	})
+}
+
+func writeRoomsSheet(f *excelize.File, data *ReportData, header, percent int) error {
+	s := sheetRooms
+	_ = f.SetSheetRow(s, "A1", &[]any{"房间", "设备数", "平均使用率(%)", "峰值使用率(%)", "平均在用(台)", "使用机时(台时)", "高峰时长(分)"})
+	_ = f.SetCellStyle(s, "A1", "G1", header)
+	for i, room := range data.Rooms {
+		_ = f.SetSheetRow(s, fmt.Sprintf("A%d", i+2), &[]any{
+			room.Name, room.TotalDevices, room.AvgUsageRate, room.MaxUsageRate, room.AvgUsedDevices, room.DeviceHours, room.PeakMinutes,
+		})
+	}
+	_ = f.SetColWidth(s, "A", "A", 20)
+	_ = f.SetColWidth(s, "B", "G", 14)
+	if len(data.Rooms) == 0 {
+		return nil
+	}
+	last := len(data.Rooms) + 1
+	_ = f.SetCellStyle(s, "C2", fmt.Sprintf("G%d", last), percent)
+	return f.AddChart(s, "I1", &excelize.Chart{
+		Type:      excelize.Bar,
+		Series:    []excelize.ChartSeries{series(s, "C", 2, last, "A")},
+		Title:     []excelize.RichTextRun{{Text: "各房间平均使用率"}},
+		Legend:    excelize.ChartLegend{Position: "none"},
+		XAxis:     excelize.ChartAxis{ReverseOrder: true},
+		YAxis:     excelize.ChartAxis{Minimum: ptr(0.0), Maximum: ptr(100.0), MajorGridLines: true},
+		Dimension: excelize.ChartDimension{Width: 720, Height: uint(120 + 24*len(data.Rooms))},
+	})
+}
+
+// writeDayTypesSheet lays out the hourly usage of each day type as a heatmap, shaded by a
+// colour scale from 0% to 100%.
+func writeDayTypesSheet(f *excelize.File, data *ReportData, header, percent int) error {
+	if len(data.DayTypes) == 0 {
+		return nil
+	}
+	s := sheetDayTypes
+	titles := []any{"类型", "天数", "平均使用率(%)"}
+	for h := 0; h < 24; h++ {
+		titles = append(titles, fmt.Sprintf("%02d", h))
+	}
+	_ = f.SetSheetRow(s, "A1", &titles)
+	lastColumn, _ := excelize.ColumnNumberToName(len(titles))
+	_ = f.SetCellStyle(s, "A1", lastColumn+"1", header)
+	for i, p := range data.DayTypes {
+		row := []any{p.Type.Label(), p.Days, p.AvgUsageRate}
+		for h := 0; h < 24; h++ {
+			if rate, ok := p.Hourly[fmt.Sprintf("%02d", h)]; ok {
+				row = append(row, rate)
+			} else {
+				row = append(row, nil) // 没有数据的时段留空，不着色
+			}
+		}
+		_ = f.SetSheetRow(s, fmt.Sprintf("A%d", i+2), &row)
+	}
+	last := len(data.DayTypes) + 1
+	whole, _ := f.NewStyle(&excelize.Style{NumFmt: 1}) // 0
+	_ = f.SetCellStyle(s, "C2", fmt.Sprintf("C%d", last), percent)
+	_ = f.SetCellStyle(s, "D2", fmt.Sprintf("%s%d", lastColumn, last), whole)
+	_ = f.SetColWidth(s, "A", "A", 10)
+	_ = f.SetColWidth(s, "C", "C", 14)
+	_ = f.SetColWidth(s, "D", lastColumn, 5)
+	return f.SetConditionalFormat(s, fmt.Sprintf("D2:%s%d", lastColumn, last), []excelize.ConditionalFormatOptions{{
+		Type:     "2_color_scale",
+		Criteria: "=",
+		MinType:  "num",
+		MinValue: "0",
+		MinColor: "#FFFFFF",
+		MaxType:  "num",
+		MaxValue: "100",
+		MaxColor: "#3B82F6",
+	}})
+}
+
+// writeRawSheet streams the snapshots of the period so that weekly workbooks don't hold them all in memory.
+func writeRawSheet(f *excelize.File, db *gorm.DB, shopID uint, period Period, header int) error {
+	sw, err := f.NewStreamWriter(sheetRaw)
+	if err != nil {
+		return err
+	}
+	_ = sw.SetColWidth(1, 1, 20)
+	_ = sw.SetColWidth(2, 5, 12)
+	dateTime, _ := f.NewStyle(&excelize.Style{CustomNumFmt: ptr("yyyy-mm-dd hh:mm:ss")})
+	titles := []any{}
+	for _, title := range []string{"时间", "状态", "设备总数", "在用", "使用率(%)"} {
+		titles = append(titles, excelize.Cell{StyleID: header, Value: title})
+	}
+	if err := sw.SetRow("A1", titles); err != nil {
+		return err
+	}
+
+	rows, err := db.Model(&models.Snapshot{}).
+		Select("timestamp, shop_status, total_devices, used_devices, usage_rate").
+		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shopID, period.Start.UTC(), period.End.UTC()).
+		Order("timestamp").
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	row := 2
+	for rows.Next() {
+		var snapshot models.Snapshot
+		if err := rows.Scan(&snapshot.Timestamp, &snapshot.ShopStatus, &snapshot.TotalDevices, &snapshot.UsedDevices, &snapshot.UsageRate); err != nil {
+			return fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		err := sw.SetRow(cell, []any{
+			excelize.Cell{StyleID: dateTime, Value: excelTime(snapshot.Timestamp.In(period.Start.Location()))},
+			snapshot.ShopStatus, snapshot.TotalDevices, snapshot.UsedDevices, snapshot.UsageRate,
+		})
+		if err != nil {
+			return err
+		}
+		row++
+	}
+	if row == 2 {
+		// 原始快照已按保留天数清理，报告数据来自汇总表
+		_ = sw.SetRow("A2", []any{"原始快照已清理，仅保留汇总数据"})
+	}
+	return sw.Flush()
+}
+
+// series references rows first..last of column values, labelled by column categories, on sheet.
+func series(sheet, values string, first, last int, categories string) excelize.ChartSeries {
+	ref := func(column string) string {
+		return fmt.Sprintf("'%s'!$%s$%d:$%s$%d", sheet, column, first, column, last)
+	}
+	return excelize.ChartSeries{
+		Name:       fmt.Sprintf("'%s'!$%s$1", sheet, values),
+		Categories: ref(categories),
+		Values:     ref(values),
+	}
+}
+
+// excelTime keeps the wall clock of t, since Excel times have no zone and excelize converts via UTC.
+func excelTime(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -1,31 +1,77 @@
 package db
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"time"
 
-	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	. "wywk/models" // Import models from the models package
 )
 
-func InitDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open("wywk.db"), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent), // 全局不打印 SQL
+const DefaultPath = "wywk.db"
+
+// InitDB connects to the database described by dsn (see Open) and applies pending migrations.
+func InitDB(dsn string) *gorm.DB {
+	db := Connect(dsn)
+	log.Println("Migrating database schema...")
+	if err := Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+	log.Println("Database migration completed.")
+	return db
+}
+
+// Connect connects to the database described by dsn without touching the schema.
+func Connect(dsn string) *gorm.DB {
+	dialector, err := Open(dsn)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// 调试日志写到 stderr，stdout 留给 export 等命令的输出
+		Logger: logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+			SlowThreshold: 200 * time.Millisecond,
+			LogLevel:      logger.Silent, // 全局不打印 SQL
+			Colorful:      true,
+		}),
 	})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	db = db.Debug() // Enable GORM debug mode
+	return db
+}
 
-	// Auto-migrate the schema
-	log.Println("Auto-migrating database schema...")
-	err = db.AutoMigrate(&Shop{}, &Room{}, &Snapshot{}, &RoomSnapshot{})
+// Vacuum reclaims free space left by deleted rows.
+func Vacuum(db *gorm.DB) error {
+	var err error
+	switch db.Dialector.Name() {
+	case DialectMySQL:
+		tables, _ := db.Migrator().GetTables()
+		for _, table := range tables {
+			if err = db.Exec("OPTIMIZE TABLE " + db.Statement.Quote(table)).Error; err != nil {
+				break
+			}
+		}
+	default: // SQLite and PostgreSQL
+		err = db.Exec("VACUUM").Error
+	}
 	if err != nil {
-		log.Fatalf("Failed to auto-migrate database: %v", err)
+		return fmt.Errorf("failed to vacuum database: %w", err)
 	}
-	log.Println("Database migration completed.")
+	return nil
+}
 
-	return db
+// Backup writes a consistent copy of an SQLite database to dest, which must not exist yet.
+// Server databases should be backed up with their own tools.
+func Backup(db *gorm.DB, dest string) error {
+	if db.Dialector.Name() != DialectSQLite {
+		return fmt.Errorf("backup is only supported for SQLite, use pg_dump or mysqldump for %s", db.Dialector.Name())
+	}
+	if err := db.Exec("VACUUM INTO ?", dest).Error; err != nil {
+		return fmt.Errorf("failed to back up database to %s: %w", dest, err)
+	}
+	return nil
 }
@@ -0,0 +1,24 @@
+package dbtest
+
+import "testing"
+
+func TestSQLiteOnly(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT strftime('%H', timestamp) FROM snapshots", true},
+		{"SELECT * FROM snapshots WHERE DATE(timestamp) = ?", true},
+		{"SELECT IFNULL(name, '') FROM rooms", true},
+		{"INSERT OR IGNORE INTO rooms (code) VALUES (?)", true},
+		{"SELECT * FROM rooms WHERE code GLOB 'A*'", true},
+		{"UPDATE `rooms` SET `name`=? WHERE `id` = ?", false},
+		{"SELECT timestamp, total_devices FROM snapshots WHERE updated_at < ?", false},
+		{"SELECT COALESCE(name, '') FROM rooms", false},
+	}
+	for _, tt := range tests {
+		if got := sqliteOnly.MatchString(tt.sql); got != tt.want {
+			t.Errorf("sqliteOnly.MatchString(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+// openTestDB opens a fresh SQLite file without applying any migration.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return Connect(filepath.Join(t.TempDir(), "test.db"))
+}
+
+// checkSchema fails unless every column of every model exists, the way the code reads them.
+func checkSchema(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	tests := []interface{}{
+		&models.Shop{}, &models.Room{}, &models.Snapshot{}, &models.RoomSnapshot{},
+		&models.ShopRollup{}, &models.RoomRollup{}, &models.RoomNameChange{}, &models.ReportHistory{},
+		&models.LayoutVersion{}, &models.Device{}, &models.DeviceChange{}, &models.OutboxMessage{},
+		&models.QueuedAlert{}, &models.AlertKey{}, &models.AlertSend{}, &models.SchemaFingerprint{},
+	}
+	for _, model := range tests {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("failed to parse %T: %v", model, err)
+		}
+		if !db.Migrator().HasTable(model) {
+			t.Errorf("table %s is missing", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	checkSchema(t, db)
+
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != LatestVersion() {
+		t.Errorf("Status lists %d migrations, want %d", len(statuses), LatestVersion())
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d (%s) not applied", s.Version, s.Name)
+		}
+	}
+
+	// 再次迁移不应有任何变化
+	if err := Migrate(db); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	// 逐个回滚再重新应用，每个 Down 都必须让 Up 能再次执行
+	for version := LatestVersion() - 1; version >= 0; version-- {
+		if err := MigrateTo(db, version); err != nil {
+			t.Fatalf("MigrateTo(%d): %v", version, err)
+		}
+		if err := MigrateTo(db, LatestVersion()); err != nil {
+			t.Fatalf("MigrateTo(latest) after rolling back to %d: %v", version, err)
+		}
+		checkSchema(t, db)
+	}
+}
+
+func TestLatestVersion(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d (%s) at position %d, want consecutive versions from 1", m.Version, m.Name, i)
+		}
+		if m.Up == nil {
+			t.Errorf("migration %d (%s) has no Up", m.Version, m.Name)
+		}
+	}
+	if got := LatestVersion(); got != len(migrations) {
+		t.Errorf("LatestVersion() = %d, want %d", got, len(migrations))
+	}
+}
+
+func TestMigration7BackfillsMinutesFromSnapshots(t *testing.T) {
+	db := openTestDB(t)
+	if err := MigrateTo(db, 6); err != nil {
+		t.Fatalf("MigrateTo(6): %v", err)
+	}
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	exec := func(query string, args ...any) {
+		t.Helper()
+		if err := db.Exec(query, args...).Error; err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	// 门店 1 每 5 分钟抓取一次，中间有一晚闭店；门店 2 没有快照
+	exec(`INSERT INTO shops (id, common_code, name) VALUES (1, 'A', 'A'), (2, 'B', 'B')`)
+	exec(`INSERT INTO rooms (id, shop_id, code, name) VALUES (1, 1, 'R1', 'R1')`)
+	for i := 0; i < 20; i++ {
+		at := start.Add(time.Duration(i) * 5 * time.Minute)
+		if i >= 10 {
+			at = at.Add(12 * time.Hour)
+		}
+		exec(`INSERT INTO snapshots (shop_id, timestamp) VALUES (1, ?)`, at)
+	}
+	exec(`INSERT INTO shop_rollups (shop_id, granularity, period_start, samples, avg_used_devices) VALUES
+		(1, 'hour', ?, 6, 2), (1, 'day', ?, 20, 2), (2, 'hour', ?, 3, 2), (2, 'hour', ?, 12, 2)`,
+		start, start.Truncate(24*time.Hour), start, start.Add(time.Hour))
+	exec(`INSERT INTO room_rollups (room_id, granularity, period_start, samples) VALUES (1, 'hour', ?, 6)`, start)
+
+	if err := MigrateTo(db, 7); err != nil {
+		t.Fatalf("MigrateTo(7): %v", err)
+	}
+	var shopMinutes, roomMinutes, deviceHours []float64
+	db.Table("shop_rollups").Order("id").Pluck("minutes", &shopMinutes)
+	db.Table("shop_rollups").Order("id").Pluck("device_hours", &deviceHours)
+	db.Table("room_rollups").Order("id").Pluck("minutes", &roomMinutes)
+	if want := []float64{30, 100, 30, 60}; !reflect.DeepEqual(shopMinutes, want) {
+		t.Errorf("shop rollup minutes = %v, want %v", shopMinutes, want)
+	}
+	if want := []float64{1, 100.0 / 30, 1, 2}; !reflect.DeepEqual(deviceHours, want) {
+		t.Errorf("shop rollup device hours = %v, want %v", deviceHours, want)
+	}
+	if want := []float64{30}; !reflect.DeepEqual(roomMinutes, want) {
+		t.Errorf("room rollup minutes = %v, want %v", roomMinutes, want)
+	}
+}
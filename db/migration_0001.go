@@ -0,0 +1,94 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 1 is the schema as it was created by AutoMigrate before versioned migrations.
+// The structs are frozen copies of the models at that point, so that later model changes
+// don't alter what this migration does. Existing tables are left untouched.
+
+type shopV1 struct {
+	ID         uint   `gorm:"primaryKey"`
+	CommonCode string `gorm:"uniqueIndex:idx_shops_common_code"`
+	Name       string
+	Address    string
+}
+
+func (shopV1) TableName() string { return "shops" }
+
+type roomV1 struct {
+	ID           uint `gorm:"primaryKey"`
+	ShopID       uint
+	Code         string `gorm:"uniqueIndex:idx_rooms_code"`
+	Name         string
+	TotalDevices int
+	NoSmoking    int
+	Width        float64
+	Height       float64
+}
+
+func (roomV1) TableName() string { return "rooms" }
+
+type snapshotV1 struct {
+	ID           uint      `gorm:"primaryKey"`
+	ShopID       uint      `gorm:"index:idx_snapshots_shop_id"`
+	Timestamp    time.Time `gorm:"index:idx_snapshots_timestamp"`
+	ShopStatus   string
+	TotalDevices int
+	UsedDevices  int
+	UsageRate    float64
+}
+
+func (snapshotV1) TableName() string { return "snapshots" }
+
+type roomSnapshotV1 struct {
+	ID           uint `gorm:"primaryKey"`
+	SnapshotID   uint `gorm:"index:idx_room_snapshots_snapshot_id"`
+	RoomID       uint `gorm:"index:idx_room_snapshots_room_id"`
+	TotalDevices int
+	UsedDevices  int
+	UsageRate    float64
+}
+
+func (roomSnapshotV1) TableName() string { return "room_snapshots" }
+
+type reportHistoryV1 struct {
+	ID          uint      `gorm:"primaryKey"`
+	ShopID      uint      `gorm:"uniqueIndex:idx_report_history_period"`
+	Kind        string    `gorm:"uniqueIndex:idx_report_history_period"`
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_report_history_period"`
+	PeriodEnd   time.Time
+	SentAt      time.Time
+}
+
+func (reportHistoryV1) TableName() string { return "report_histories" }
+
+func init() {
+	tables := []interface{}{&shopV1{}, &roomV1{}, &snapshotV1{}, &roomSnapshotV1{}, &reportHistoryV1{}}
+	register(Migration{
+		Version: 1,
+		Name:    "initial schema",
+		Up: func(tx *gorm.DB) error {
+			for _, table := range tables {
+				if tx.Migrator().HasTable(table) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
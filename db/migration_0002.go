@@ -0,0 +1,115 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 2 scopes rooms to their shop. Room codes used to be globally unique, so when
+// two shops shared a code the second shop took over the first one's room row. Such rows
+// are split again using the shop of each room snapshot, and renames are tracked from now on.
+
+type roomV2 struct {
+	ID     uint   `gorm:"primaryKey"`
+	ShopID uint   `gorm:"uniqueIndex:idx_rooms_shop_code"`
+	Code   string `gorm:"uniqueIndex:idx_rooms_shop_code"`
+}
+
+func (roomV2) TableName() string { return "rooms" }
+
+type roomNameChangeV2 struct {
+	ID        uint `gorm:"primaryKey"`
+	RoomID    uint `gorm:"index"`
+	OldName   string
+	NewName   string
+	ChangedAt time.Time
+}
+
+func (roomNameChangeV2) TableName() string { return "room_name_changes" }
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "scope rooms to shop",
+		Up: func(tx *gorm.DB) error {
+			// 先删除旧的唯一索引，拆分出来的房间才能使用相同的编号
+			if err := tx.Migrator().DropIndex(&roomV1{}, "idx_rooms_code"); err != nil {
+				return err
+			}
+			if err := splitMergedRooms(tx); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(&roomV2{}, "idx_rooms_shop_code"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&roomNameChangeV2{})
+		},
+		Down: func(tx *gorm.DB) error {
+			var shared int64
+			tx.Raw("SELECT COUNT(*) FROM (SELECT code FROM rooms GROUP BY code HAVING COUNT(*) > 1) shared").Scan(&shared)
+			if shared > 0 {
+				return fmt.Errorf("%d room codes are used by more than one shop, cannot restore the global unique index", shared)
+			}
+			if err := tx.Migrator().DropTable(&roomNameChangeV2{}); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropIndex(&roomV2{}, "idx_rooms_shop_code"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&roomV1{}, "idx_rooms_code")
+		},
+	})
+}
+
+// splitMergedRooms gives every shop that has room snapshots pointing at another shop's
+// room row its own row with the same code, and moves those snapshots over.
+func splitMergedRooms(tx *gorm.DB) error {
+	var pairs []struct {
+		RoomID uint
+		ShopID uint
+	}
+	err := tx.Table("room_snapshots").
+		Select("room_snapshots.room_id AS room_id, snapshots.shop_id AS shop_id").
+		Joins("JOIN snapshots ON snapshots.id = room_snapshots.snapshot_id").
+		Joins("JOIN rooms ON rooms.id = room_snapshots.room_id").
+		Where("snapshots.shop_id <> rooms.shop_id").
+		Group("room_snapshots.room_id, snapshots.shop_id").
+		Scan(&pairs).Error
+	if err != nil {
+		return fmt.Errorf("failed to find merged rooms: %w", err)
+	}
+
+	for _, pair := range pairs {
+		var merged roomV1
+		if err := tx.First(&merged, pair.RoomID).Error; err != nil {
+			return err
+		}
+
+		// 最近一次快照的设备数作为拆分出来的房间的设备数
+		var lastTotal int
+		tx.Table("room_snapshots").
+			Select("room_snapshots.total_devices").
+			Joins("JOIN snapshots ON snapshots.id = room_snapshots.snapshot_id").
+			Where("room_snapshots.room_id = ? AND snapshots.shop_id = ?", pair.RoomID, pair.ShopID).
+			Order("snapshots.timestamp DESC").
+			Limit(1).
+			Scan(&lastTotal)
+
+		// The room name seen by the other shop is not stored, so the split row keeps the
+		// merged row's name until the next crawl of that shop updates it.
+		split := roomV1{ShopID: pair.ShopID, Code: merged.Code, Name: merged.Name, TotalDevices: lastTotal}
+		if err := tx.Create(&split).Error; err != nil {
+			return fmt.Errorf("failed to split room %s for shop %d: %w", merged.Code, pair.ShopID, err)
+		}
+		err := tx.Exec("UPDATE room_snapshots SET room_id = ? WHERE room_id = ? AND snapshot_id IN (SELECT id FROM snapshots WHERE shop_id = ?)",
+			split.ID, pair.RoomID, pair.ShopID).Error
+		if err != nil {
+			return fmt.Errorf("failed to move snapshots of room %s to shop %d: %w", merged.Code, pair.ShopID, err)
+		}
+		log.Printf("Split room %s (id %d): shop %d now uses room id %d", merged.Code, merged.ID, pair.ShopID, split.ID)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 3 adds hourly and daily rollups of shop and room snapshots.
+
+type shopRollupV3 struct {
+	ID             uint      `gorm:"primaryKey"`
+	ShopID         uint      `gorm:"uniqueIndex:idx_shop_rollups_period"`
+	Granularity    string    `gorm:"uniqueIndex:idx_shop_rollups_period"`
+	PeriodStart    time.Time `gorm:"uniqueIndex:idx_shop_rollups_period"`
+	Samples        int
+	TotalDevices   int
+	AvgUsageRate   float64
+	MaxUsageRate   float64
+	AvgUsedDevices float64
+	MaxUsedDevices int
+}
+
+func (shopRollupV3) TableName() string { return "shop_rollups" }
+
+type roomRollupV3 struct {
+	ID             uint      `gorm:"primaryKey"`
+	RoomID         uint      `gorm:"uniqueIndex:idx_room_rollups_period"`
+	Granularity    string    `gorm:"uniqueIndex:idx_room_rollups_period"`
+	PeriodStart    time.Time `gorm:"uniqueIndex:idx_room_rollups_period"`
+	Samples        int
+	TotalDevices   int
+	AvgUsageRate   float64
+	MaxUsageRate   float64
+	AvgUsedDevices float64
+	MaxUsedDevices int
+}
+
+func (roomRollupV3) TableName() string { return "room_rollups" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "snapshot rollups",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&shopRollupV3{}, &roomRollupV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&roomRollupV3{}, &shopRollupV3{})
+		},
+	})
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 4 stores the last seen shape of each upstream response, to detect schema drift.
+
+type schemaFingerprintV4 struct {
+	ID         uint   `gorm:"primaryKey"`
+	CommonCode string `gorm:"uniqueIndex:idx_schema_fingerprints_endpoint"`
+	Endpoint   string `gorm:"uniqueIndex:idx_schema_fingerprints_endpoint"`
+	Hash       string
+	Shape      string
+	UpdatedAt  time.Time
+}
+
+func (schemaFingerprintV4) TableName() string { return "schema_fingerprints" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "schema fingerprints",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&schemaFingerprintV4{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&schemaFingerprintV4{})
+		},
+	})
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 5 records every distinct seat layout of a shop.
+
+type layoutVersionV5 struct {
+	ID         uint `gorm:"primaryKey"`
+	ShopID     uint `gorm:"index"`
+	Hash       string
+	Seats      int
+	Rooms      int
+	Layout     string
+	Changes    string
+	DetectedAt time.Time
+}
+
+func (layoutVersionV5) TableName() string { return "layout_versions" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "layout versions",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&layoutVersionV5{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&layoutVersionV5{})
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 6 adds the device inventory and its change log.
+
+type deviceV6 struct {
+	ID          uint   `gorm:"primaryKey"`
+	ShopID      uint   `gorm:"uniqueIndex:idx_devices_shop_client"`
+	ClientNo    string `gorm:"uniqueIndex:idx_devices_shop_client"`
+	DisplayName string
+	ClientIP    string
+	RoomCode    string
+	ElementID   int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+func (deviceV6) TableName() string { return "devices" }
+
+type deviceChangeV6 struct {
+	ID        uint `gorm:"primaryKey"`
+	DeviceID  uint `gorm:"index"`
+	Field     string
+	OldValue  string
+	NewValue  string
+	ChangedAt time.Time
+}
+
+func (deviceChangeV6) TableName() string { return "device_changes" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "device inventory",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&deviceV6{}, &deviceChangeV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&deviceChangeV6{}, &deviceV6{})
+		},
+	})
+}
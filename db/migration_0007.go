@@ -0,0 +1,139 @@
+package db
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 7 adds time-weighted totals to the rollups: the time the snapshots cover, the
+// occupied device-hours and the time spent at or above 90% usage. Existing rollups are
+// backfilled with the crawl interval each shop's snapshots show, or the default ten minutes
+// for shops without snapshots; their peak time is unknown.
+
+type shopRollupV7 struct {
+	Minutes     float64
+	DeviceHours float64
+	PeakMinutes float64
+}
+
+func (shopRollupV7) TableName() string { return "shop_rollups" }
+
+type roomRollupV7 struct {
+	Minutes     float64
+	DeviceHours float64
+	PeakMinutes float64
+}
+
+func (roomRollupV7) TableName() string { return "room_rollups" }
+
+var rollupColumnsV7 = []string{"Minutes", "DeviceHours", "PeakMinutes"}
+
+const (
+	defaultIntervalV7 = 10 * time.Minute
+	// intervalSamplesV7 is how many of a shop's latest snapshots its interval is estimated from.
+	intervalSamplesV7 = 500
+)
+
+// crawlIntervalV7 estimates the crawl interval of shopID as the median gap between its latest
+// snapshots. Gaps of an hour or more, such as nights the shop was closed, are ignored.
+func crawlIntervalV7(tx *gorm.DB, shopID uint) (time.Duration, error) {
+	var stamps []time.Time
+	err := tx.Table("snapshots").Where("shop_id = ?", shopID).
+		Order("timestamp DESC").Limit(intervalSamplesV7).Pluck("timestamp", &stamps).Error
+	if err != nil {
+		return 0, err
+	}
+	var gaps []time.Duration
+	for i := 1; i < len(stamps); i++ {
+		if gap := stamps[i-1].Sub(stamps[i]); gap > 0 && gap < time.Hour {
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return defaultIntervalV7, nil
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	return gaps[len(gaps)/2], nil
+}
+
+// backfillMinutesV7 sets the minutes of the rollups in table matching where, or of all of
+// them if it is empty, as samples taken every interval, capped at the length of the period.
+func backfillMinutesV7(tx *gorm.DB, table string, interval time.Duration, where string, args ...any) error {
+	minutes := interval.Minutes()
+	query := `UPDATE ` + table + ` SET minutes = CASE
+			WHEN granularity = 'hour' AND samples * ? > 60 THEN 60
+			WHEN granularity = 'day' AND samples * ? > 1440 THEN 1440
+			ELSE samples * ? END`
+	if where != "" {
+		query += " WHERE " + where
+	}
+	return tx.Exec(query, append([]any{minutes, minutes, minutes}, args...)...).Error
+}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "time-weighted rollups",
+		Up: func(tx *gorm.DB) error {
+			for _, model := range []any{&shopRollupV7{}, &roomRollupV7{}} {
+				for _, column := range rollupColumnsV7 {
+					if err := tx.Migrator().AddColumn(model, column); err != nil {
+						return err
+					}
+				}
+			}
+			for _, table := range []string{"shop_rollups", "room_rollups"} {
+				if err := backfillMinutesV7(tx, table, defaultIntervalV7, ""); err != nil {
+					return err
+				}
+			}
+			var shopIDs []uint
+			if err := tx.Table("shops").Pluck("id", &shopIDs).Error; err != nil {
+				return err
+			}
+			for _, shopID := range shopIDs {
+				interval, err := crawlIntervalV7(tx, shopID)
+				if err != nil {
+					return err
+				}
+				if interval == defaultIntervalV7 {
+					continue
+				}
+				if err := backfillMinutesV7(tx, "shop_rollups", interval, "shop_id = ?", shopID); err != nil {
+					return err
+				}
+				err = backfillMinutesV7(tx, "room_rollups", interval, "room_id IN (SELECT id FROM rooms WHERE shop_id = ?)", shopID)
+				if err != nil {
+					return err
+				}
+			}
+			for _, table := range []string{"shop_rollups", "room_rollups"} {
+				if err := tx.Exec(`UPDATE ` + table + ` SET device_hours = avg_used_devices * minutes / 60`).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, model := range []any{&shopRollupV7{}, &roomRollupV7{}} {
+				for _, column := range rollupColumnsV7 {
+					if err := tx.Migrator().DropColumn(model, column); err != nil {
+						return err
+					}
+				}
+			}
+			// SQLite drops columns by rebuilding the table, which loses its indexes
+			if !tx.Migrator().HasIndex(&shopRollupV3{}, "idx_shop_rollups_period") {
+				if err := tx.Migrator().CreateIndex(&shopRollupV3{}, "idx_shop_rollups_period"); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasIndex(&roomRollupV3{}, "idx_room_rollups_period") {
+				return tx.Migrator().CreateIndex(&roomRollupV3{}, "idx_room_rollups_period")
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 8 converts timestamps to UTC. They used to be saved in the zone of the host,
+// and SQLite keeps them as text with that offset, so range queries compared strings with
+// different offsets. Other databases store absolute times and are left alone. Rollups and
+// report history were already stored in UTC.
+
+var localTimeColumnsV8 = map[string][]string{
+	"snapshots":           {"timestamp"},
+	"room_name_changes":   {"changed_at"},
+	"layout_versions":     {"detected_at"},
+	"devices":             {"first_seen", "last_seen"},
+	"device_changes":      {"changed_at"},
+	"schema_fingerprints": {"updated_at"},
+}
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "store timestamps in UTC",
+		Up: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() != DialectSQLite {
+				return nil
+			}
+			for table, columns := range localTimeColumnsV8 {
+				for _, column := range columns {
+					if err := columnToUTC(tx, table, column); err != nil {
+						return fmt.Errorf("failed to convert %s.%s: %w", table, column, err)
+					}
+				}
+			}
+			return nil
+		},
+		// UTC timestamps read back fine in any zone, there is nothing to undo
+		Down: func(tx *gorm.DB) error { return nil },
+	})
+}
+
+// columnToUTC rewrites every distinct non-UTC value of column; the driver formats the
+// parsed value with its original offset, so it matches the stored text exactly.
+func columnToUTC(tx *gorm.DB, table, column string) error {
+	var times []time.Time
+	err := tx.Table(table).Distinct(column).Where(column+" NOT LIKE ?", "%+00:00").Pluck(column, &times).Error
+	if err != nil {
+		return err
+	}
+	for _, t := range times {
+		if err := tx.Table(table).Where(column+" = ?", t).Update(column, t.UTC()).Error; err != nil {
+			return err
+		}
+	}
+	if len(times) > 0 {
+		log.Printf("Converted %d distinct %s.%s values to UTC", len(times), table, column)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// Migration 9 adds the coordinates of shops, as reported upstream. Zero means unknown.
+
+type shopV9 struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (shopV9) TableName() string { return "shops" }
+
+var shopColumnsV9 = []string{"Latitude", "Longitude"}
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "shop coordinates",
+		Up: func(tx *gorm.DB) error {
+			for _, column := range shopColumnsV9 {
+				if err := tx.Migrator().AddColumn(&shopV9{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range shopColumnsV9 {
+				if err := tx.Migrator().DropColumn(&shopV9{}, column); err != nil {
+					return err
+				}
+			}
+			// SQLite drops columns by rebuilding the table, which loses its indexes
+			if !tx.Migrator().HasIndex(&shopV1{}, "idx_shops_common_code") {
+				return tx.Migrator().CreateIndex(&shopV1{}, "idx_shops_common_code")
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 10 adds the notification outbox, from which failed notifications are retried.
+
+type outboxMessageV10 struct {
+	ID            uint `gorm:"primaryKey"`
+	Recipient     string
+	ChannelName   string
+	Title         string
+	Body          string
+	GroupName     string
+	Images        string
+	Status        string `gorm:"index:idx_outbox_messages_due"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_messages_due"`
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+func (outboxMessageV10) TableName() string { return "outbox_messages" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "notification outbox",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&outboxMessageV10{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&outboxMessageV10{})
+		},
+	})
+}
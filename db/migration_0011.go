@@ -0,0 +1,51 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 11 keeps the state of the alert dispatcher, so that queued alerts, dedup keys
+// and rate limits carry over between runs.
+
+type queuedAlertV11 struct {
+	ID        uint `gorm:"primaryKey"`
+	Recipient string
+	DedupKey  string
+	GroupName string
+	Body      string
+	At        time.Time
+	HeldQuiet bool
+}
+
+func (queuedAlertV11) TableName() string { return "queued_alerts" }
+
+type alertKeyV11 struct {
+	ID         uint `gorm:"primaryKey"`
+	DedupKey   string
+	AcceptedAt time.Time
+}
+
+func (alertKeyV11) TableName() string { return "alert_keys" }
+
+type alertSendV11 struct {
+	ID        uint `gorm:"primaryKey"`
+	Recipient string
+	SentAt    time.Time
+}
+
+func (alertSendV11) TableName() string { return "alert_sends" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "alert dispatcher state",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&queuedAlertV11{}, &alertKeyV11{}, &alertSendV11{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&queuedAlertV11{}, &alertKeyV11{}, &alertSendV11{})
+		},
+	})
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// Migration 12 records how many parts of a notification sent as several messages were
+// delivered, so that a retry does not repeat them.
+
+type outboxMessageV12 struct {
+	PartsSent int
+}
+
+func (outboxMessageV12) TableName() string { return "outbox_messages" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "outbox partial sends",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&outboxMessageV12{}, "PartsSent")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&outboxMessageV12{}, "PartsSent"); err != nil {
+				return err
+			}
+			// SQLite drops columns by rebuilding the table, which loses its indexes
+			if !tx.Migrator().HasIndex(&outboxMessageV10{}, "idx_outbox_messages_due") {
+				return tx.Migrator().CreateIndex(&outboxMessageV10{}, "idx_outbox_messages_due")
+			}
+			return nil
+		},
+	})
+}
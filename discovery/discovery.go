@@ -0,0 +1,134 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"wywk/gateway"
+	"wywk/models"
+)
+
+const (
+	listPath   = "/asset-svc/shop/store/portal/list"
+	citiesPath = "/asset-svc/shop/store/portal/cityList"
+	pageSize   = 20
+	// DefaultLimit caps how many shops a search returns when Query.Limit is not set.
+	DefaultLimit = 50
+)
+
+// Query selects shops by city, keyword and/or distance from a point. Empty fields match
+// every shop.
+type Query struct {
+	City    string
+	Keyword string
+	// Near sorts by distance from Lat, Lon, as the mini program does with the user's location.
+	Near     bool
+	Lat, Lon float64
+	Limit    int
+}
+
+// Store is a shop as listed by the gateway.
+type Store struct {
+	CommonCode string            `json:"commonCode"`
+	Name       string            `json:"storeName"`
+	Address    string            `json:"storeAddress"`
+	City       string            `json:"cityName"`
+	Status     string            `json:"shopStatus"`
+	Lat        models.Coordinate `json:"latitude"`
+	Lon        models.Coordinate `json:"longitude"`
+	Distance   models.Coordinate `json:"distance"` // meters from the query point, only when searching near one
+}
+
+// City is a city with shops, as listed by the gateway.
+type City struct {
+	Code       string `json:"cityCode"`
+	Name       string `json:"cityName"`
+	StoreCount int    `json:"storeCount"`
+}
+
+type listResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Total int     `json:"total"`
+		List  []Store `json:"list"`
+	} `json:"data"`
+}
+
+type citiesResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    []City `json:"data"`
+}
+
+// Search pages through the store list until q.Limit shops are found. City and keyword are
+// also checked locally, so the results stay right if the gateway ignores a filter.
+func Search(client gateway.Client, q Query) ([]Store, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	payload := map[string]any{"cityName": q.City, "keyword": q.Keyword, "pageSize": pageSize}
+	if q.Near {
+		payload["latitude"], payload["longitude"] = q.Lat, q.Lon
+	}
+
+	var stores []Store
+	seen := make(map[string]bool)
+	for page := 1; len(stores) < limit; page++ {
+		payload["pageNum"] = page
+		body, err := client.Post(listPath, payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list stores: %w", err)
+		}
+		var resp listResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse store list JSON: %w", err)
+		}
+		if resp.Code != 0 {
+			return nil, fmt.Errorf("API returned error code %d: %v", resp.Code, resp.Message)
+		}
+		for _, store := range resp.Data.List {
+			if store.CommonCode == "" || seen[store.CommonCode] || !q.matches(store) {
+				continue
+			}
+			seen[store.CommonCode] = true
+			stores = append(stores, store)
+		}
+		if len(resp.Data.List) < pageSize || page*pageSize >= resp.Data.Total {
+			break
+		}
+	}
+	if len(stores) > limit {
+		stores = stores[:limit]
+	}
+	return stores, nil
+}
+
+func (q Query) matches(store Store) bool {
+	if q.City != "" && !strings.Contains(store.City, strings.TrimSuffix(q.City, "市")) {
+		return false
+	}
+	if q.Keyword != "" && !strings.Contains(store.Name, q.Keyword) && !strings.Contains(store.Address, q.Keyword) {
+		return false
+	}
+	return true
+}
+
+// Cities lists the cities that have shops.
+func Cities(client gateway.Client) ([]City, error) {
+	body, err := client.Get(citiesPath, url.Values{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cities: %w", err)
+	}
+	var resp citiesResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse city list JSON: %w", err)
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("API returned error code %d: %v", resp.Code, resp.Message)
+	}
+	return resp.Data, nil
+}
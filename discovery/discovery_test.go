@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// fakeGateway serves the store list in pages of pageSize, ignoring the city and keyword
+// filters like a gateway that does not support them.
+type fakeGateway struct {
+	stores   []Store
+	total    int // reported total; len(stores) when 0
+	code     int
+	err      error
+	payloads []map[string]any // copies of the payloads posted, one per page
+}
+
+func (g *fakeGateway) Get(path string, query url.Values) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected GET %s", path)
+}
+
+func (g *fakeGateway) Post(path string, payload any) ([]byte, error) {
+	if path != listPath {
+		return nil, fmt.Errorf("unexpected POST %s", path)
+	}
+	sent := make(map[string]any)
+	for k, v := range payload.(map[string]any) {
+		sent[k] = v
+	}
+	g.payloads = append(g.payloads, sent)
+	if g.err != nil {
+		return nil, g.err
+	}
+
+	var resp listResponse
+	resp.Code = g.code
+	resp.Data.Total = g.total
+	if resp.Data.Total == 0 {
+		resp.Data.Total = len(g.stores)
+	}
+	start := (sent["pageNum"].(int) - 1) * pageSize
+	if start < len(g.stores) {
+		resp.Data.List = g.stores[start:min(start+pageSize, len(g.stores))]
+	}
+	return json.Marshal(resp)
+}
+
+func numbered(n int, city string) []Store {
+	stores := make([]Store, n)
+	for i := range stores {
+		stores[i] = Store{CommonCode: fmt.Sprintf("%s%03d", city, i), Name: fmt.Sprintf("%s店%d", city, i), City: city}
+	}
+	return stores
+}
+
+func codes(stores []Store) []string {
+	var codes []string
+	for _, s := range stores {
+		codes = append(codes, s.CommonCode)
+	}
+	return codes
+}
+
+func TestSearch(t *testing.T) {
+	mixed := append(numbered(15, "上海"), numbered(15, "北京")...)
+	mixed[3].Address = "人民广场旁"
+	tests := []struct {
+		name    string
+		stores  []Store
+		total   int
+		query   Query
+		pages   int      // pages requested
+		want    int      // shops returned
+		first   []string // codes of the first shops returned, if checked
+		wantErr bool
+	}{
+		{name: "default limit", stores: numbered(120, "上海"), pages: 3, want: DefaultLimit},
+		{name: "stops at the limit", stores: numbered(120, "上海"), query: Query{Limit: 25}, pages: 2, want: 25},
+		{name: "stops on a short page", stores: numbered(7, "上海"), pages: 1, want: 7},
+		{name: "stops at the total", stores: numbered(40, "上海"), pages: 2, want: 40},
+		{name: "stops when the total is reached early", stores: numbered(40, "上海"), total: 20, pages: 1, want: 20},
+		{name: "city checked locally", stores: mixed, query: Query{City: "北京市"}, pages: 2, want: 15,
+			first: []string{"北京000", "北京001"}},
+		{name: "keyword in name", stores: mixed, query: Query{Keyword: "店12"}, pages: 2, want: 2,
+			first: []string{"上海012", "北京012"}},
+		{name: "keyword in address", stores: mixed, query: Query{Keyword: "人民广场"}, pages: 2, want: 1,
+			first: []string{"上海003"}},
+		{name: "duplicates and stores without code skipped",
+			stores: append([]Store{{Name: "无编号"}}, append(numbered(3, "上海"), numbered(2, "上海")...)...),
+			pages:  1, want: 3, first: []string{"上海000", "上海001", "上海002"}},
+		{name: "nothing found", pages: 1, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &fakeGateway{stores: tt.stores, total: tt.total}
+			got, err := Search(g, tt.query)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(g.payloads) != tt.pages {
+				t.Errorf("requested %d pages, want %d", len(g.payloads), tt.pages)
+			}
+			for i, payload := range g.payloads {
+				if payload["pageNum"] != i+1 || payload["pageSize"] != pageSize {
+					t.Errorf("page %d requested with %v", i+1, payload)
+				}
+			}
+			if len(got) != tt.want {
+				t.Errorf("Search() returned %d shops, want %d", len(got), tt.want)
+			}
+			if tt.first != nil && !reflect.DeepEqual(codes(got)[:min(len(tt.first), len(got))], tt.first) {
+				t.Errorf("Search() = %v, want it to start with %v", codes(got), tt.first)
+			}
+		})
+	}
+}
+
+func TestSearchPayload(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  map[string]any
+	}{
+		{"filters", Query{City: "上海", Keyword: "网咖"},
+			map[string]any{"cityName": "上海", "keyword": "网咖", "pageSize": pageSize, "pageNum": 1}},
+		{"near", Query{Near: true, Lat: 31.2, Lon: 121.4},
+			map[string]any{"cityName": "", "keyword": "", "pageSize": pageSize, "pageNum": 1, "latitude": 31.2, "longitude": 121.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &fakeGateway{}
+			if _, err := Search(g, tt.query); err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(g.payloads) != 1 || !reflect.DeepEqual(g.payloads[0], tt.want) {
+				t.Errorf("posted %v, want %v", g.payloads, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		gateway *fakeGateway
+	}{
+		{"request failed", &fakeGateway{err: errors.New("connection refused")}},
+		{"error code", &fakeGateway{code: 500, stores: numbered(3, "上海")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if stores, err := Search(tt.gateway, Query{}); err == nil {
+				t.Errorf("Search() = %v, want error", codes(stores))
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package discovery
+
+import (
+	"fmt"
+	"strconv"
+
+	"wywk/report"
+)
+
+// SearchReport lists the stores found as a table, marking those already in configured.
+func SearchReport(stores []Store, configured []string) *report.Report {
+	inConfig := make(map[string]bool)
+	for _, code := range configured {
+		inConfig[code] = true
+	}
+
+	r := &report.Report{Title: fmt.Sprintf("店铺搜索 (%d 家)", len(stores)), Data: stores}
+	table := &report.Table{Columns: []string{"编号", "店名", "城市", "地址", "距离", "状态", "已配置"}}
+	for _, s := range stores {
+		distance := "-"
+		if s.Distance > 0 {
+			distance = fmt.Sprintf("%.1fkm", float64(s.Distance)/1000)
+		}
+		configuredMark := ""
+		if inConfig[s.CommonCode] {
+			configuredMark = "✓"
+		}
+		table.Rows = append(table.Rows, []string{s.CommonCode, s.Name, s.City, s.Address, distance, s.Status, configuredMark})
+	}
+	r.AddSection("").Table = table
+	return r
+}
+
+// CitiesReport lists the cities with shops as a table.
+func CitiesReport(cities []City) *report.Report {
+	r := &report.Report{Title: fmt.Sprintf("城市列表 (%d 个)", len(cities)), Data: cities}
+	table := &report.Table{Columns: []string{"城市", "编码", "门店数"}}
+	for _, c := range cities {
+		table.Rows = append(table.Rows, []string{c.Name, c.Code, strconv.Itoa(c.StoreCount)})
+	}
+	r.AddSection("").Table = table
+	return r
+}
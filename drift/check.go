@@ -0,0 +1,70 @@
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+// OnChange is called when the shape of a response differs from the stored one. unknown
+// lists the new fields that the model struct does not decode.
+var OnChange func(commonCode, endpoint string, changes, unknown []string)
+
+// Check compares the shape of body with the one stored for commonCode and endpoint, reports
+// differences through OnChange and stores the new shape. The first response only sets the baseline.
+func Check(db *gorm.DB, commonCode, endpoint string, body []byte, model any) error {
+	shape, empty, err := shapeOf(body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s response shape: %w", endpoint, err)
+	}
+
+	var stored models.SchemaFingerprint
+	db.Where("common_code = ? AND endpoint = ?", commonCode, endpoint).Limit(1).Find(&stored)
+	old := Shape{}
+	if stored.ID != 0 {
+		_ = json.Unmarshal([]byte(stored.Shape), &old)
+		shape.carryOver(old, empty)
+	}
+	hash := shape.Fingerprint()
+	if stored.ID != 0 && stored.Hash == hash {
+		return nil
+	}
+
+	if stored.ID == 0 {
+		if unknown := Unknown(shape, model); len(unknown) > 0 {
+			log.Printf("%s response of %s has %d fields the model ignores: %v", endpoint, commonCode, len(unknown), unknown)
+		}
+	} else {
+		// 只有 null 与具体类型之间的变化不算漂移，直接更新指纹
+		if changes := Diff(old, shape); len(changes) > 0 {
+			var unknown []string
+			for _, path := range Unknown(shape, model) {
+				if _, ok := old[path]; !ok {
+					unknown = append(unknown, path)
+				}
+			}
+			for _, change := range changes {
+				log.Printf("Schema drift in %s response of %s: %s", endpoint, commonCode, change)
+			}
+			if OnChange != nil {
+				OnChange(commonCode, endpoint, changes, unknown)
+			}
+		}
+	}
+
+	data, _ := json.Marshal(shape)
+	stored.CommonCode = commonCode
+	stored.Endpoint = endpoint
+	stored.Hash = hash
+	stored.Shape = string(data)
+	stored.UpdatedAt = time.Now().UTC()
+	if err := db.Save(&stored).Error; err != nil {
+		return fmt.Errorf("failed to save schema fingerprint: %w", err)
+	}
+	return nil
+}
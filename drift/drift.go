@@ -0,0 +1,221 @@
+package drift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Shape maps every field path of a JSON document to its JSON type. Array elements are
+// merged under "[]", e.g. "data.areas[].elements[].clientInfo.status": "number".
+type Shape map[string]string
+
+const typeNull = "null"
+
+// ShapeOf walks a JSON document and records the type of every field.
+func ShapeOf(body []byte) (Shape, error) {
+	shape, _, err := shapeOf(body)
+	return shape, err
+}
+
+// shapeOf also returns the paths of empty arrays, whose element fields are unknown rather than removed.
+func shapeOf(body []byte) (Shape, map[string]bool, error) {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, nil, err
+	}
+	shape := make(Shape)
+	empty := make(map[string]bool)
+	shape.walk("", v, empty)
+	for path := range empty {
+		if _, ok := shape[path+"[]"]; ok {
+			delete(empty, path) // 其他元素中的同名数组非空
+		}
+	}
+	return shape, empty, nil
+}
+
+func (s Shape) walk(path string, v any, empty map[string]bool) {
+	if path != "" {
+		s.add(path, jsonType(v))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if path == "" {
+				s.walk(key, child, empty)
+			} else {
+				s.walk(path+"."+key, child, empty)
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			empty[path] = true
+		}
+		for _, child := range v {
+			s.walk(path+"[]", child, empty)
+		}
+	}
+}
+
+// carryOver keeps what old knows and new cannot tell: the type of fields that are only null
+// in new, and the fields below empty arrays and null objects in new.
+func (s Shape) carryOver(old Shape, empty map[string]bool) {
+	var prefixes []string
+	for array := range empty {
+		prefixes = append(prefixes, array+"[]")
+	}
+	for path, typ := range s {
+		if typ == typeNull {
+			prefixes = append(prefixes, path+".", path+"[]")
+		}
+	}
+	for path, typ := range old {
+		if current, ok := s[path]; ok {
+			if current == typeNull {
+				s[path] = typ
+			}
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				s[path] = typ
+				break
+			}
+		}
+	}
+}
+
+// add records typ for path. A null only counts when no other type has been seen, since
+// most upstream fields are null in some elements and set in others.
+func (s Shape) add(path, typ string) {
+	if old, ok := s[path]; ok && (typ == typeNull || old == typ) {
+		return
+	}
+	s[path] = typ
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return typeNull
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Fingerprint hashes the shape so it can be compared cheaply.
+func (s Shape) Fingerprint() string {
+	h := sha256.New()
+	for _, path := range s.paths() {
+		fmt.Fprintf(h, "%s:%s\n", path, s[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func (s Shape) paths() []string {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Diff describes how new differs from old, one line per field. A field becoming null or
+// stopping being null is not reported.
+func Diff(old, new Shape) []string {
+	var changes []string
+	for _, path := range new.paths() {
+		oldType, ok := old[path]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("新增字段 %s (%s)", path, new[path]))
+		case oldType != new[path] && oldType != typeNull && new[path] != typeNull:
+			changes = append(changes, fmt.Sprintf("类型变化 %s: %s -> %s", path, oldType, new[path]))
+		}
+	}
+	for _, path := range old.paths() {
+		if _, ok := new[path]; !ok {
+			changes = append(changes, fmt.Sprintf("移除字段 %s (%s)", path, old[path]))
+		}
+	}
+	return changes
+}
+
+// Unknown returns the fields of shape that model does not decode, i.e. that encoding/json
+// would silently drop. Fields under interface{} fields of model count as decoded.
+func Unknown(shape Shape, model any) []string {
+	var unknown []string
+	for _, path := range shape.paths() {
+		if !decodes(reflect.TypeOf(model), strings.Split(path, ".")) {
+			unknown = append(unknown, path)
+		}
+	}
+	return unknown
+}
+
+func decodes(t reflect.Type, parts []string) bool {
+	for _, part := range parts {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		name, isArray := strings.CutSuffix(part, "[]")
+		if t.Kind() == reflect.Interface {
+			return true
+		}
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		field, ok := jsonField(t, name)
+		if !ok {
+			return false
+		}
+		t = field
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if isArray {
+			if t.Kind() == reflect.Interface {
+				return true
+			}
+			if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+				return false
+			}
+			t = t.Elem()
+		}
+	}
+	return true
+}
+
+// jsonField finds the field that encoding/json would decode key into, matching case-insensitively like it does.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
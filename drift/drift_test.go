@@ -0,0 +1,94 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"wywk/models"
+)
+
+func TestShapeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Shape
+	}{
+		{"flat", `{"code": 0, "message": null, "ok": true}`, Shape{"code": "number", "message": "null", "ok": "bool"}},
+		{"nested", `{"data": {"storeName": "店", "latitude": "31.2"}}`,
+			Shape{"data": "object", "data.storeName": "string", "data.latitude": "string"}},
+		{"array elements merged", `{"a": [{"x": 1}, {"y": "s"}]}`,
+			Shape{"a": "array", "a[]": "object", "a[].x": "number", "a[].y": "string"}},
+		{"null then set", `{"a": [{"x": null}, {"x": 1}]}`, Shape{"a": "array", "a[]": "object", "a[].x": "number"}},
+		{"set then null", `{"a": [{"x": 1}, {"x": null}]}`, Shape{"a": "array", "a[]": "object", "a[].x": "number"}},
+		{"nested arrays", `{"a": [[1, 2]]}`, Shape{"a": "array", "a[]": "array", "a[][]": "number"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ShapeOf([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("ShapeOf: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ShapeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ShapeOf([]byte(`{"a": `)); err == nil {
+		t.Error("ShapeOf() of invalid JSON returned no error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new Shape
+		want     []string
+	}{
+		{"same", Shape{"a": "number"}, Shape{"a": "number"}, nil},
+		{"added", Shape{"a": "number"}, Shape{"a": "number", "b": "string"}, []string{"新增字段 b (string)"}},
+		{"removed", Shape{"a": "number", "b": "string"}, Shape{"a": "number"}, []string{"移除字段 b (string)"}},
+		{"type changed", Shape{"a": "number"}, Shape{"a": "string"}, []string{"类型变化 a: number -> string"}},
+		{"became null", Shape{"a": "number"}, Shape{"a": "null"}, nil},
+		{"no longer null", Shape{"a": "null"}, Shape{"a": "object"}, nil},
+		{"sorted, added before removed", Shape{"c": "bool", "a": "bool"}, Shape{"d": "bool", "b": "bool"},
+			[]string{"新增字段 b (bool)", "新增字段 d (bool)", "移除字段 a (bool)", "移除字段 c (bool)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		model any
+		want  []string
+	}{
+		{"all decoded", `{"data": {"storeName": "店", "shopStatus": "营业中"}}`, models.ShopInfoResponse{}, nil},
+		{"case-insensitive like encoding/json", `{"data": {"StoreName": "店"}}`, models.ShopInfoResponse{}, nil},
+		{"new field", `{"data": {"storeName": "店", "openTime": "10:00"}, "traceId": "x"}`, models.ShopInfoResponse{},
+			[]string{"data.openTime", "traceId"}},
+		{"inside arrays", `{"data": {"areas": [{"areaCode": "A", "elements": [{"id": 1, "price": 5}]}]}}`, models.DetailResponse{},
+			[]string{"data.areas[].elements[].price"}},
+		{"under pointers", `{"data": {"areas": [{"elements": [{"clientInfo": {"roomCode": "A", "mac": "x"}}]}]}}`, &models.DetailResponse{},
+			[]string{"data.areas[].elements[].clientInfo.mac"}},
+		{"under interface{} fields", `{"message": {"text": "ok", "codes": [1]}, "data": {"shopName": {"zh": "店"}}}`, models.DetailResponse{}, nil},
+		{"array where a scalar is decoded", `{"data": {"storeName": ["店"]}}`, models.ShopInfoResponse{}, []string{"data.storeName[]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shape, err := ShapeOf([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("ShapeOf: %v", err)
+			}
+			if got := Unknown(shape, tt.model); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unknown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package export
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+// Kind is the type of an exported column.
+type Kind int
+
+const (
+	Int Kind = iota
+	Float
+	String
+	Time
+)
+
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// Filter restricts an export to one shop and to [From, To). Zero values mean no limit.
+type Filter struct {
+	Shop string
+	From time.Time
+	To   time.Time
+}
+
+// Dataset is one exportable table. Its query selects exactly Columns, in order.
+type Dataset struct {
+	Name    string
+	Columns []Column
+	query   func(db *gorm.DB, f Filter) *gorm.DB
+}
+
+// Datasets lists everything that can be exported, in dependency order.
+var Datasets = []Dataset{
+	{
+		Name: "shops",
+		Columns: []Column{
+			{"id", Int}, {"common_code", String}, {"name", String}, {"address", String},
+		},
+		query: func(db *gorm.DB, f Filter) *gorm.DB {
+			q := db.Model(&models.Shop{}).
+				Select("shops.id, shops.common_code, shops.name, shops.address").
+				Order("shops.id")
+			return filterShop(q, f)
+		},
+	},
+	{
+		Name: "rooms",
+		Columns: []Column{
+			{"id", Int}, {"common_code", String}, {"code", String}, {"name", String},
+			{"total_devices", Int}, {"no_smoking", Int}, {"width", Float}, {"height", Float},
+		},
+		query: func(db *gorm.DB, f Filter) *gorm.DB {
+			q := db.Model(&models.Room{}).
+				Select("rooms.id, shops.common_code, rooms.code, rooms.name, rooms.total_devices, rooms.no_smoking, rooms.width, rooms.height").
+				Joins("JOIN shops ON shops.id = rooms.shop_id").
+				Order("rooms.id")
+			return filterShop(q, f)
+		},
+	},
+	{
+		Name: "snapshots",
+		Columns: []Column{
+			{"id", Int}, {"common_code", String}, {"shop_name", String}, {"timestamp", Time},
+			{"shop_status", String}, {"total_devices", Int}, {"used_devices", Int}, {"usage_rate", Float},
+		},
+		query: func(db *gorm.DB, f Filter) *gorm.DB {
+			q := db.Model(&models.Snapshot{}).
+				Select("snapshots.id, shops.common_code, shops.name, snapshots.timestamp, snapshots.shop_status, snapshots.total_devices, snapshots.used_devices, snapshots.usage_rate").
+				Joins("JOIN shops ON shops.id = snapshots.shop_id").
+				Order("snapshots.timestamp, snapshots.id")
+			return filterTime(filterShop(q, f), f)
+		},
+	},
+	{
+		Name: "room_snapshots",
+		Columns: []Column{
+			{"snapshot_id", Int}, {"common_code", String}, {"timestamp", Time}, {"room_code", String},
+			{"room_name", String}, {"total_devices", Int}, {"used_devices", Int}, {"usage_rate", Float},
+		},
+		query: func(db *gorm.DB, f Filter) *gorm.DB {
+			q := db.Model(&models.RoomSnapshot{}).
+				Select("room_snapshots.snapshot_id, shops.common_code, snapshots.timestamp, rooms.code, rooms.name, room_snapshots.total_devices, room_snapshots.used_devices, room_snapshots.usage_rate").
+				Joins("JOIN snapshots ON snapshots.id = room_snapshots.snapshot_id").
+				Joins("JOIN shops ON shops.id = snapshots.shop_id").
+				Joins("JOIN rooms ON rooms.id = room_snapshots.room_id").
+				Order("snapshots.timestamp, room_snapshots.id")
+			return filterTime(filterShop(q, f), f)
+		},
+	},
+}
+
+func filterShop(q *gorm.DB, f Filter) *gorm.DB {
+	if f.Shop != "" {
+		q = q.Where("shops.common_code = ?", f.Shop)
+	}
+	return q
+}
+
+func filterTime(q *gorm.DB, f Filter) *gorm.DB {
+	if !f.From.IsZero() {
+		q = q.Where("snapshots.timestamp >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		q = q.Where("snapshots.timestamp < ?", f.To.UTC())
+	}
+	return q
+}
+
+// Lookup returns the dataset called name.
+func Lookup(name string) (Dataset, error) {
+	var names []string
+	for _, ds := range Datasets {
+		if ds.Name == name {
+			return ds, nil
+		}
+		names = append(names, ds.Name)
+	}
+	return Dataset{}, fmt.Errorf("unknown dataset %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// FormatFromPath guesses the export format from a file extension, defaulting to CSV.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".parquet":
+		return FormatParquet
+	default:
+		return FormatCSV
+	}
+}
+
+// Export streams the rows of ds matching f to w in format, one row at a time.
+func Export(db *gorm.DB, ds Dataset, f Filter, format string, w io.Writer) error {
+	writer, err := NewWriter(format, w, ds.Columns)
+	if err != nil {
+		return err
+	}
+
+	rows, err := ds.query(db, f).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", ds.Name, err)
+	}
+	defer rows.Close()
+
+	values := make([]any, len(ds.Columns))
+	dest := make([]any, len(ds.Columns))
+	for i, column := range ds.Columns {
+		switch column.Kind {
+		case Int:
+			dest[i] = new(sql.NullInt64)
+		case Float:
+			dest[i] = new(sql.NullFloat64)
+		case String:
+			dest[i] = new(sql.NullString)
+		case Time:
+			dest[i] = new(sql.NullTime)
+		}
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read %s: %w", ds.Name, err)
+		}
+		for i, d := range dest {
+			switch d := d.(type) {
+			case *sql.NullInt64:
+				values[i] = d.Int64
+			case *sql.NullFloat64:
+				values[i] = d.Float64
+			case *sql.NullString:
+				values[i] = d.String
+			case *sql.NullTime:
+				values[i] = d.Time
+			}
+		}
+		if err := writer.Write(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", ds.Name, err)
+	}
+	return writer.Close()
+}
+
+// ParseFilter builds a filter from inclusive YYYY-MM-DD dates in loc; empty dates leave the range open.
+func ParseFilter(shop, from, to string, loc *time.Location) (Filter, error) {
+	f := Filter{Shop: shop}
+	if from != "" {
+		start, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			return f, fmt.Errorf("invalid from date: %w", err)
+		}
+		f.From = start
+	}
+	if to != "" {
+		end, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil {
+			return f, fmt.Errorf("invalid to date: %w", err)
+		}
+		f.To = end.AddDate(0, 0, 1)
+	}
+	return f, nil
+}
@@ -0,0 +1,48 @@
+package export
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Handler serves GET ?dataset=snapshots&format=csv&shop=CODE&from=DATE&to=DATE,
+// streaming the export straight into the response. Dates are days in the zone returned by
+// location, which is read on every request so a reloaded time zone takes effect.
+func Handler(db *gorm.DB, location func() *time.Location) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		name := query.Get("dataset")
+		if name == "" {
+			name = "snapshots"
+		}
+		ds, err := Lookup(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = FormatCSV
+		}
+		if !ValidFormat(format) {
+			http.Error(w, fmt.Sprintf("unknown export format %q", format), http.StatusBadRequest)
+			return
+		}
+		filter, err := ParseFilter(query.Get("shop"), query.Get("from"), query.Get("to"), location())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ds.Name+"."+format))
+		// 数据已开始写出后无法再返回错误状态码，只能记录日志
+		if err := Export(db, ds, filter, format, w); err != nil {
+			log.Printf("Export of %s failed: %v", ds.Name, err)
+		}
+	})
+}
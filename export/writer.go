@@ -0,0 +1,206 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{FormatCSV, FormatJSONL, FormatParquet}
+
+// ValidFormat reports whether format is one of Formats.
+func ValidFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType returns the MIME type of format, for the HTTP endpoint.
+func ContentType(format string) string {
+	switch format {
+	case FormatJSONL:
+		return "application/x-ndjson"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Writer encodes rows of values matching the columns it was created with.
+type Writer interface {
+	Write(values []any) error
+	// Close flushes buffered rows; it does not close the underlying io.Writer.
+	Close() error
+}
+
+func NewWriter(format string, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w), columns: columns}, nil
+	case FormatParquet:
+		return newParquetWriter(w, columns), nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: writer}, nil
+}
+
+func (c *csvWriter) Write(values []any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case int64:
+			record[i] = strconv.FormatInt(v, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			record[i] = v
+		case time.Time:
+			record[i] = v.Format(time.RFC3339)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes one JSON object per line, keeping the column order.
+type jsonlWriter struct {
+	w       *bufio.Writer
+	columns []Column
+}
+
+func (j *jsonlWriter) Write(values []any) error {
+	j.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(j.columns[i].Name)
+		j.w.Write(key)
+		j.w.WriteByte(':')
+		if t, ok := value.(time.Time); ok {
+			value = t.Format(time.RFC3339)
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		j.w.Write(data)
+	}
+	_, err := j.w.WriteString("}\n")
+	return err
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
+
+// parquetRowGroupSize bounds how many rows are buffered in memory before a row group is written.
+const parquetRowGroupSize = 50000
+
+type parquetWriter struct {
+	w *parquet.Writer
+	// leaf is the position of each column in the schema, which orders columns by name.
+	leaf []int
+	row  parquet.Row
+	rows int
+}
+
+func newParquetWriter(w io.Writer, columns []Column) *parquetWriter {
+	group := parquet.Group{}
+	for _, column := range columns {
+		var node parquet.Node
+		switch column.Kind {
+		case Int:
+			node = parquet.Int(64)
+		case Float:
+			node = parquet.Leaf(parquet.DoubleType)
+		case String:
+			node = parquet.String()
+		case Time:
+			node = parquet.Timestamp(parquet.Millisecond)
+		}
+		group[column.Name] = parquet.Compressed(node, &parquet.Zstd)
+	}
+	schema := parquet.NewSchema("export", group)
+
+	index := make(map[string]int)
+	for i, path := range schema.Columns() {
+		index[path[0]] = i
+	}
+	p := &parquetWriter{
+		w:    parquet.NewWriter(w, schema),
+		leaf: make([]int, len(columns)),
+		row:  make(parquet.Row, len(columns)),
+	}
+	for i, column := range columns {
+		p.leaf[i] = index[column.Name]
+	}
+	return p
+}
+
+func (p *parquetWriter) Write(values []any) error {
+	for i, value := range values {
+		var v parquet.Value
+		switch value := value.(type) {
+		case int64:
+			v = parquet.Int64Value(value)
+		case float64:
+			v = parquet.DoubleValue(value)
+		case string:
+			v = parquet.ByteArrayValue([]byte(value))
+		case time.Time:
+			v = parquet.Int64Value(value.UnixMilli())
+		}
+		p.row[p.leaf[i]] = v.Level(0, 0, p.leaf[i])
+	}
+	if _, err := p.w.WriteRows([]parquet.Row{p.row}); err != nil {
+		return err
+	}
+	if p.rows++; p.rows%parquetRowGroupSize == 0 {
+		return p.w.Flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.Close()
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+var (
+	testColumns = []Column{{"id", Int}, {"name", String}, {"usage_rate", Float}, {"timestamp", Time}}
+	testAt      = time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+	testRows    = [][]any{
+		{int64(1), "一号店", 37.5, testAt},
+		{int64(2), `带,逗号"引号`, 0.0, testAt.Add(10 * time.Minute)},
+	}
+)
+
+func writeRows(t *testing.T, format string, rows [][]any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, testColumns)
+	if err != nil {
+		t.Fatalf("NewWriter(%q): %v", format, err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestTextWriters(t *testing.T) {
+	tests := []struct {
+		format string
+		rows   [][]any
+		want   string
+	}{
+		{FormatCSV, nil, "id,name,usage_rate,timestamp\n"},
+		{FormatCSV, testRows, "id,name,usage_rate,timestamp\n" +
+			"1,一号店,37.5,2026-03-02T12:30:00Z\n" +
+			"2,\"带,逗号\"\"引号\",0,2026-03-02T12:40:00Z\n"},
+		{FormatJSONL, nil, ""},
+		{FormatJSONL, testRows,
+			`{"id":1,"name":"一号店","usage_rate":37.5,"timestamp":"2026-03-02T12:30:00Z"}` + "\n" +
+				`{"id":2,"name":"带,逗号\"引号","usage_rate":0,"timestamp":"2026-03-02T12:40:00Z"}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := string(writeRows(t, tt.format, tt.rows)); got != tt.want {
+				t.Errorf("output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetWriter(t *testing.T) {
+	type row struct {
+		ID        int64     `parquet:"id"`
+		Name      string    `parquet:"name"`
+		UsageRate float64   `parquet:"usage_rate"`
+		Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	}
+	data := writeRows(t, FormatParquet, testRows)
+	got, err := parquet.Read[row](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to read parquet: %v", err)
+	}
+	want := []row{
+		{1, "一号店", 37.5, testAt},
+		{2, `带,逗号"引号`, 0, testAt.Add(10 * time.Minute)},
+	}
+	for i := range got {
+		got[i].Timestamp = got[i].Timestamp.UTC()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewWriterUnknownFormat(t *testing.T) {
+	if _, err := NewWriter("xml", &bytes.Buffer{}, testColumns); err == nil {
+		t.Error("NewWriter(\"xml\") returned no error")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		name     string
+		from, to string
+		want     Filter
+		wantErr  bool
+	}{
+		{"open", "", "", Filter{Shop: "A"}, false},
+		{"inclusive days in loc", "2026-03-01", "2026-03-02",
+			Filter{Shop: "A", From: time.Date(2026, 3, 1, 0, 0, 0, 0, cst), To: time.Date(2026, 3, 3, 0, 0, 0, 0, cst)}, false},
+		{"from only", "2026-03-01", "", Filter{Shop: "A", From: time.Date(2026, 3, 1, 0, 0, 0, 0, cst)}, false},
+		{"invalid from", "03/01", "", Filter{}, true},
+		{"invalid to", "", "2026-02-30", Filter{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter("A", tt.from, tt.to, cst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Shop != tt.want.Shop || !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To)) {
+				t.Errorf("ParseFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
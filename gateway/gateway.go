@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the gateway behind the shops' mini program.
+const DefaultBaseURL = "https://vip-gateway.wywk.cn"
+
+// Client fetches raw response bodies from the gateway. Everything that talks to the
+// gateway goes through Default, so that Use can swap in a local stand-in.
+type Client interface {
+	Get(path string, query url.Values) ([]byte, error)
+	Post(path string, payload any) ([]byte, error)
+}
+
+var (
+	mu      sync.RWMutex
+	current Client = New("")
+)
+
+// Use makes c the client returned by Default; the config's gatewayURL sets it.
+func Use(c Client) {
+	mu.Lock()
+	current = c
+	mu.Unlock()
+}
+
+// Default returns the client used by crawls and discovery.
+func Default() Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// HTTPClient talks to a gateway, or anything serving the same paths, over HTTP.
+type HTTPClient struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// New returns an HTTPClient for baseURL, or for DefaultBaseURL if it is empty.
+func New(baseURL string) *HTTPClient {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &HTTPClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *HTTPClient) Get(path string, query url.Values) ([]byte, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *HTTPClient) Post(path string, payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+func (c *HTTPClient) do(req *http.Request) ([]byte, error) {
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	if got := New("").BaseURL; got != DefaultBaseURL {
+		t.Errorf("New(\"\").BaseURL = %q, want %q", got, DefaultBaseURL)
+	}
+	if got := New("http://localhost:8080/").BaseURL; got != "http://localhost:8080" {
+		t.Errorf("trailing slash kept: %q", got)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/info":
+			if r.Method != http.MethodGet {
+				t.Errorf("info: method %s", r.Method)
+			}
+			w.Write([]byte(`{"code": "` + r.URL.Query().Get("commonCode") + `"}`))
+		case "/detail":
+			var payload map[string]string
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("detail: method %s, content type %q", r.Method, r.Header.Get("Content-Type"))
+			}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Errorf("detail: %v", err)
+			}
+			w.Write([]byte(`{"code": "` + payload["commonCode"] + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "not found")
+		}
+	}))
+	defer server.Close()
+	client := New(server.URL)
+
+	body, err := client.Get("/info", url.Values{"commonCode": {"A 1"}})
+	if err != nil || string(body) != `{"code": "A 1"}` {
+		t.Errorf("Get = %s, %v", body, err)
+	}
+	body, err = client.Post("/detail", map[string]string{"commonCode": "B"})
+	if err != nil || string(body) != `{"code": "B"}` {
+		t.Errorf("Post = %s, %v", body, err)
+	}
+	if body, err := client.Get("/missing", nil); err == nil {
+		t.Errorf("Get of a missing path = %s, want an error", body)
+	}
+}
+
+// stub answers every request with its path.
+type stub struct{}
+
+func (stub) Get(path string, query url.Values) ([]byte, error) { return []byte(path), nil }
+func (stub) Post(path string, payload any) ([]byte, error)     { return []byte(path), nil }
+
+func TestUse(t *testing.T) {
+	defer Use(Default())
+	Use(stub{})
+	if body, _ := Default().Get("/x", nil); string(body) != "/x" {
+		t.Errorf("Default() does not return the client set by Use")
+	}
+}
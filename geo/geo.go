@@ -0,0 +1,110 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"wywk/models"
+)
+
+// Point is a GCJ-02 position, the datum used upstream and by Chinese map apps, so that
+// coordinates copied from one of them line up with the shops.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Valid reports whether p is a position at all; zero stands for unknown.
+func (p Point) Valid() bool {
+	return (p.Lat != 0 || p.Lon != 0) && math.Abs(p.Lat) <= 90 && math.Abs(p.Lon) <= 180
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("%.6f,%.6f", p.Lat, p.Lon)
+}
+
+// ParsePoint reads "LAT,LON".
+func ParsePoint(s string) (Point, error) {
+	lat, lon, ok := strings.Cut(s, ",")
+	var p Point
+	var errLat, errLon error
+	p.Lat, errLat = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	p.Lon, errLon = strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	if !ok || errLat != nil || errLon != nil || !p.Valid() {
+		return Point{}, fmt.Errorf("invalid point %q, want LAT,LON", s)
+	}
+	return p, nil
+}
+
+const earthRadiusKm = 6371.0
+
+// Distance is the great-circle distance between a and b in kilometers.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// Place is a named point distances are measured from, such as home or the office.
+type Place struct {
+	Name  string
+	Point Point
+}
+
+// manual holds coordinates set in the config by commonCode, and places the configured
+// places. Configure replaces both as a whole, so readers may keep what they got.
+var (
+	mu     sync.RWMutex
+	manual map[string]Point
+	places []Place
+)
+
+// Configure sets the configured places and the shop coordinates by commonCode.
+func Configure(configuredPlaces []Place, shopPoints map[string]Point) {
+	mu.Lock()
+	defer mu.Unlock()
+	places = configuredPlaces
+	manual = shopPoints
+}
+
+// Places returns the configured places; the slice must not be modified.
+func Places() []Place {
+	mu.RLock()
+	defer mu.RUnlock()
+	return places
+}
+
+// ShopPoint returns the position of shop: the configured one, or else the one reported upstream.
+func ShopPoint(shop *models.Shop) (Point, bool) {
+	mu.RLock()
+	p, ok := manual[shop.CommonCode]
+	mu.RUnlock()
+	if ok && p.Valid() {
+		return p, true
+	}
+	p = Point{Lat: shop.Latitude, Lon: shop.Longitude}
+	return p, p.Valid()
+}
+
+// FindPlace returns the configured place called name.
+func FindPlace(name string) (Place, bool) {
+	for _, place := range Places() {
+		if place.Name == name {
+			return place, true
+		}
+	}
+	return Place{}, false
+}
+
+// FormatKm formats a distance for reports, in meters below one kilometer.
+func FormatKm(km float64) string {
+	if km < 1 {
+		return fmt.Sprintf("%.0fm", km*1000)
+	}
+	return fmt.Sprintf("%.1fkm", km)
+}
@@ -0,0 +1,116 @@
+package geo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"wywk/db/dbtest"
+	"wywk/models"
+	"wywk/rollup"
+)
+
+func TestParsePoint(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Point
+		ok   bool
+	}{
+		{"31.2304,121.4737", Point{31.2304, 121.4737}, true},
+		{" 31.2304 , 121.4737 ", Point{31.2304, 121.4737}, true},
+		{"31.2304", Point{}, false},
+		{"0,0", Point{}, false},
+		{"91,121", Point{}, false},
+		{"a,b", Point{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePoint(tt.in)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParsePoint(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// 人民广场到陆家嘴约 2.7 公里
+	a, b := Point{31.2304, 121.4737}, Point{31.2397, 121.4998}
+	if got := Distance(a, b); math.Abs(got-2.67) > 0.05 {
+		t.Errorf("Distance() = %.3f, want about 2.67", got)
+	}
+	if got := Distance(a, a); got != 0 {
+		t.Errorf("Distance to itself = %v, want 0", got)
+	}
+}
+
+func TestFormatKm(t *testing.T) {
+	tests := []struct {
+		km   float64
+		want string
+	}{
+		{0.25, "250m"}, {1, "1.0km"}, {12.34, "12.3km"},
+	}
+	for _, tt := range tests {
+		if got := FormatKm(tt.km); got != tt.want {
+			t.Errorf("FormatKm(%v) = %q, want %q", tt.km, got, tt.want)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	defer Configure(Places(), nil)
+	defer rollup.SetCrawlInterval(rollup.CrawlInterval())
+	rollup.SetCrawlInterval(10 * time.Minute)
+	database := dbtest.Open(t)
+
+	home := Point{31.2304, 121.4737}
+	now := time.Now()
+	shops := []struct {
+		code     string
+		lat, lon float64
+		used     int
+		at       time.Time
+	}{
+		{"FAR", 31.30, 121.50, 5, now},
+		{"NEAR", 31.231, 121.474, 5, now},
+		{"FULL", 31.2305, 121.4738, 10, now},
+		{"STALE", 31.2306, 121.4739, 0, now.Add(-time.Hour)},
+		{"MANUAL", 0, 0, 5, now},
+	}
+	for _, s := range shops {
+		shop := models.Shop{CommonCode: s.code, Name: s.code, Latitude: s.lat, Longitude: s.lon}
+		if err := database.Create(&shop).Error; err != nil {
+			t.Fatal(err)
+		}
+		snapshot := models.Snapshot{ShopID: shop.ID, Timestamp: s.at, ShopStatus: "营业中", TotalDevices: 10, UsedDevices: s.used}
+		if err := database.Create(&snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 上游没有坐标的店铺用配置里的坐标
+	Configure([]Place{{Name: "家", Point: home}}, map[string]Point{"MANUAL": {31.25, 121.48}})
+
+	got, err := Nearest(database, home, 0)
+	if err != nil {
+		t.Fatalf("Nearest: %v", err)
+	}
+	var codes []string
+	for _, s := range got {
+		codes = append(codes, s.CommonCode)
+	}
+	want := []string{"NEAR", "MANUAL", "FAR"}
+	if len(codes) != len(want) {
+		t.Fatalf("Nearest() = %q, want %q", codes, want)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("Nearest() = %q, want %q", codes, want)
+		}
+	}
+	if km := got[0].Distances["家"]; km != got[0].DistanceKm {
+		t.Errorf("distance from 家 = %v, want %v", km, got[0].DistanceKm)
+	}
+
+	if got, err := Nearest(database, home, 1); err != nil || len(got) != 1 {
+		t.Errorf("Nearest(limit 1) returned %d shops, %v", len(got), err)
+	}
+}
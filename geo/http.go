@@ -0,0 +1,36 @@
+package geo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"gorm.io/gorm"
+)
+
+//go:embed map.html
+var mapPage []byte
+
+// Handler serves the map page at /map and the data it shows at /map/shops.json.
+func Handler(db *gorm.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/map", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(mapPage)
+	})
+	mux.HandleFunc("/map/shops.json", func(w http.ResponseWriter, r *http.Request) {
+		shops, err := Latest(db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		configured := Places()
+		places := make([]map[string]any, 0, len(configured))
+		for _, place := range configured {
+			places = append(places, map[string]any{"name": place.Name, "point": place.Point})
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"shops": shops, "places": places})
+	})
+	return mux
+}
@@ -0,0 +1,145 @@
+package geo
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+	"wywk/report"
+	"wywk/rollup"
+)
+
+// ShopSeats is a shop with its position and latest snapshot.
+type ShopSeats struct {
+	CommonCode   string    `json:"commonCode"`
+	Name         string    `json:"name"`
+	Address      string    `json:"address"`
+	Point        *Point    `json:"point,omitempty"` // nil when the position is unknown
+	Status       string    `json:"status"`
+	TotalDevices int       `json:"totalDevices"`
+	FreeDevices  int       `json:"freeDevices"`
+	UsageRate    float64   `json:"usageRate"`
+	At           time.Time `json:"at"`
+	// Stale is set when the latest snapshot is older than a crawl, so the seats may be taken by now.
+	Stale bool `json:"stale"`
+	// Distances from each configured place in kilometers, by place name.
+	Distances map[string]float64 `json:"distances,omitempty"`
+	// DistanceKm is the distance from the point of a Nearest query.
+	DistanceKm float64 `json:"distanceKm,omitempty"`
+}
+
+// Open reports whether the shop is open and has free seats according to a recent snapshot.
+func (s ShopSeats) Open() bool {
+	return !s.Stale && s.Status == "营业中" && s.FreeDevices > 0
+}
+
+// Latest returns every shop with its position, distances from the places and latest snapshot.
+func Latest(db *gorm.DB) ([]ShopSeats, error) {
+	var shops []models.Shop
+	if err := db.Order("id").Find(&shops).Error; err != nil {
+		return nil, fmt.Errorf("failed to list shops: %w", err)
+	}
+	now := time.Now()
+	places := Places()
+	result := make([]ShopSeats, 0, len(shops))
+	for i := range shops {
+		shop := &shops[i]
+		seats := ShopSeats{CommonCode: shop.CommonCode, Name: shop.Name, Address: shop.Address}
+		if p, ok := ShopPoint(shop); ok {
+			seats.Point = &p
+			seats.Distances = make(map[string]float64)
+			for _, place := range places {
+				seats.Distances[place.Name] = Distance(place.Point, p)
+			}
+		}
+
+		var snapshot models.Snapshot
+		err := db.Where("shop_id = ?", shop.ID).Order("timestamp DESC").Limit(1).Find(&snapshot).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to load latest snapshot of %s: %w", shop.CommonCode, err)
+		}
+		if snapshot.ID != 0 {
+			seats.Status = snapshot.ShopStatus
+			seats.TotalDevices = snapshot.TotalDevices
+			seats.FreeDevices = snapshot.TotalDevices - snapshot.UsedDevices
+			seats.UsageRate = snapshot.UsageRate
+			seats.At = snapshot.Timestamp
+		}
+		seats.Stale = snapshot.ID == 0 || now.Sub(snapshot.Timestamp) > rollup.MaxSpan()
+		result = append(result, seats)
+	}
+	return result, nil
+}
+
+// Nearest returns the shops with free seats ordered by distance from p, at most limit of them.
+// Shops without a position or a recent snapshot are left out.
+func Nearest(db *gorm.DB, p Point, limit int) ([]ShopSeats, error) {
+	shops, err := Latest(db)
+	if err != nil {
+		return nil, err
+	}
+	var nearest []ShopSeats
+	for _, shop := range shops {
+		if shop.Point != nil && shop.Open() {
+			shop.DistanceKm = Distance(p, *shop.Point)
+			nearest = append(nearest, shop)
+		}
+	}
+	sort.SliceStable(nearest, func(i, j int) bool { return nearest[i].DistanceKm < nearest[j].DistanceKm })
+	if limit > 0 && len(nearest) > limit {
+		nearest = nearest[:limit]
+	}
+	return nearest, nil
+}
+
+// NearestReport lists the result of Nearest from the point called from.
+func NearestReport(from string, shops []ShopSeats, loc *time.Location) *report.Report {
+	r := &report.Report{Title: fmt.Sprintf("离%s最近的有空位门店", from), Data: shops}
+	if len(shops) == 0 {
+		r.AddSection("").Lines = []string{"附近没有有空位的门店"}
+		return r
+	}
+	best := r.AddSection("")
+	best.AddMetric("最近", fmt.Sprintf("%s (%s)，空闲 %d/%d 台", shops[0].Name, FormatKm(shops[0].DistanceKm), shops[0].FreeDevices, shops[0].TotalDevices))
+	best.AddMetric("地址", shops[0].Address)
+
+	table := &report.Table{Columns: []string{"店铺", "距离", "空闲", "使用率", "更新"}}
+	for _, s := range shops {
+		table.Rows = append(table.Rows, []string{
+			s.Name, FormatKm(s.DistanceKm), fmt.Sprintf("%d/%d", s.FreeDevices, s.TotalDevices),
+			fmt.Sprintf("%.0f%%", s.UsageRate), s.At.In(loc).Format("15:04"),
+		})
+	}
+	r.AddSection("").Table = table
+	return r
+}
+
+// ShopsReport lists the shops with their positions and distances from each place.
+func ShopsReport(shops []ShopSeats) *report.Report {
+	r := &report.Report{Title: "门店位置", Data: shops}
+	places := Places()
+	columns := []string{"编号", "店铺", "坐标"}
+	for _, place := range places {
+		columns = append(columns, "距"+place.Name)
+	}
+	table := &report.Table{Columns: columns}
+	for _, s := range shops {
+		row := []string{s.CommonCode, s.Name, "未知"}
+		if s.Point != nil {
+			row[2] = s.Point.String()
+		}
+		for _, place := range places {
+			if km, ok := s.Distances[place.Name]; ok {
+				row = append(row, FormatKm(km))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	r.AddSection("").Table = table
+	return r
+}
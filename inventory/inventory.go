@@ -0,0 +1,116 @@
+package inventory
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+// Fields recorded in the device change log.
+const (
+	FieldIP   = "ip"
+	FieldRoom = "room"
+	FieldSeat = "seat"
+	FieldName = "name"
+)
+
+// clientKey identifies a device. Seats without a client number fall back to their element ID.
+func clientKey(elementID int, info *models.ClientInfo) string {
+	if info.ClientNo != "" {
+		return info.ClientNo
+	}
+	return "seat:" + strconv.Itoa(elementID)
+}
+
+// Update records the devices in detail as seen at at: new devices are added, known ones
+// get their last-seen time bumped, and IP, room, seat and name changes are logged.
+func Update(db *gorm.DB, shop *models.Shop, detail *models.DetailResponse, at time.Time) error {
+	var known []models.Device
+	if err := db.Where("shop_id = ?", shop.ID).Find(&known).Error; err != nil {
+		return fmt.Errorf("failed to load devices of %s: %w", shop.Name, err)
+	}
+	devices := make(map[string]*models.Device, len(known))
+	for i := range known {
+		devices[known[i].ClientNo] = &known[i]
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var unchanged []uint
+		seen := make(map[string]bool)
+		for _, area := range detail.Data.Areas {
+			for _, element := range area.Elements {
+				info := element.ClientInfo
+				if element.ElementCode != "SEAT" || info == nil {
+					continue
+				}
+				key := clientKey(element.ID, info)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				device, ok := devices[key]
+				if !ok {
+					device = &models.Device{
+						ShopID:      shop.ID,
+						ClientNo:    key,
+						DisplayName: info.DisplayName,
+						ClientIP:    info.ClientIp,
+						RoomCode:    info.RoomCode,
+						ElementID:   element.ID,
+						FirstSeen:   at,
+						LastSeen:    at,
+					}
+					if err := tx.Create(device).Error; err != nil {
+						return fmt.Errorf("failed to add device %s: %w", key, err)
+					}
+					continue
+				}
+
+				var changes []models.DeviceChange
+				track := func(field, old, new string) {
+					if old != new {
+						changes = append(changes, models.DeviceChange{DeviceID: device.ID, Field: field, OldValue: old, NewValue: new, ChangedAt: at})
+					}
+				}
+				track(FieldIP, device.ClientIP, info.ClientIp)
+				track(FieldRoom, device.RoomCode, info.RoomCode)
+				track(FieldSeat, strconv.Itoa(device.ElementID), strconv.Itoa(element.ID))
+				track(FieldName, device.DisplayName, info.DisplayName)
+				if len(changes) == 0 {
+					unchanged = append(unchanged, device.ID)
+					continue
+				}
+
+				for _, change := range changes {
+					log.Printf("Device %s of %s changed %s: %s -> %s", key, shop.Name, change.Field, change.OldValue, change.NewValue)
+				}
+				if err := tx.Create(&changes).Error; err != nil {
+					return fmt.Errorf("failed to log changes of device %s: %w", key, err)
+				}
+				device.ClientIP = info.ClientIp
+				device.RoomCode = info.RoomCode
+				device.ElementID = element.ID
+				device.DisplayName = info.DisplayName
+				device.LastSeen = at
+				if err := tx.Save(device).Error; err != nil {
+					return fmt.Errorf("failed to update device %s: %w", key, err)
+				}
+			}
+		}
+
+		// 大多数设备每次都没有变化，批量更新最后出现时间
+		for start := 0; start < len(unchanged); start += 500 {
+			batch := unchanged[start:min(start+500, len(unchanged))]
+			if err := tx.Model(&models.Device{}).Where("id IN ?", batch).Update("last_seen", at).Error; err != nil {
+				return fmt.Errorf("failed to update devices of %s: %w", shop.Name, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"wywk/db/dbtest"
+	"wywk/models"
+)
+
+// seat is a seat element at id with the client info given.
+func seat(id int, clientNo, name, ip, room string) models.Element {
+	return models.Element{ID: id, ElementCode: "SEAT", ClientInfo: &models.ClientInfo{ClientNo: clientNo, DisplayName: name, ClientIp: ip, RoomCode: room}}
+}
+
+func detail(elements ...models.Element) *models.DetailResponse {
+	return &models.DetailResponse{Data: models.DetailData{Areas: []models.Area{{Elements: elements}}}}
+}
+
+func TestUpdate(t *testing.T) {
+	database := dbtest.Open(t)
+	shop := models.Shop{CommonCode: "A", Name: "A"}
+	if err := database.Create(&shop).Error; err != nil {
+		t.Fatal(err)
+	}
+	rooms := []models.Room{{ShopID: shop.ID, Code: "R1", Name: "大厅"}, {ShopID: shop.ID, Code: "R2", Name: "包间"}}
+	if err := database.Create(&rooms).Error; err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	second := first.Add(10 * time.Minute)
+
+	// 没有客户端编号的座位按元素 ID 识别，重复出现的设备只记录一次
+	err := Update(database, &shop, detail(
+		seat(1, "PC01", "01", "10.0.0.1", "R1"),
+		seat(2, "PC02", "02", "10.0.0.2", "R1"),
+		seat(3, "", "03", "", "R1"),
+		seat(4, "PC01", "01", "10.0.0.1", "R1"),
+		models.Element{ID: 5, ElementCode: "PRIVATE_ROOM"},
+	), first)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	// 第二次 PC01 换了 IP 和房间，PC02 没有出现
+	err = Update(database, &shop, detail(
+		seat(1, "PC01", "01", "10.0.0.9", "R2"),
+		seat(3, "", "03", "", "R1"),
+	), second)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	devices, err := List(database, "A")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []struct {
+		clientNo, ip, room string
+		missing            bool
+	}{
+		{"PC01", "10.0.0.9", "包间", false},
+		{"PC02", "10.0.0.2", "大厅", true},
+		{"seat:3", "", "大厅", false},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("List() = %+v, want %d devices", devices, len(want))
+	}
+	for i, w := range want {
+		d := devices[i]
+		if d.ClientNo != w.clientNo || d.ClientIP != w.ip || d.RoomName != w.room || d.Missing != w.missing {
+			t.Errorf("device %d = %+v, want %+v", i, d, w)
+		}
+	}
+	if !devices[0].FirstSeen.Equal(first) || !devices[0].LastSeen.Equal(second) || !devices[2].LastSeen.Equal(second) {
+		t.Errorf("seen times not tracked: %+v", devices)
+	}
+
+	changes, err := Changes(database, "A", first)
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+	got := make(map[string]ChangeInfo)
+	for _, c := range changes {
+		got[c.Field] = c
+	}
+	if len(changes) != 2 || got[FieldIP].NewValue != "10.0.0.9" || got[FieldRoom].OldValue != "R1" || got[FieldRoom].NewValue != "R2" {
+		t.Errorf("Changes() = %+v, want the IP and room change of PC01", changes)
+	}
+	if changes, err := Changes(database, "A", second.Add(time.Second)); err != nil || len(changes) != 0 {
+		t.Errorf("Changes after the last crawl = %+v, %v, want none", changes, err)
+	}
+}
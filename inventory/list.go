@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+	"wywk/report"
+)
+
+// DeviceInfo is a device as listed by the inventory command and API.
+type DeviceInfo struct {
+	CommonCode  string    `json:"commonCode"`
+	ShopName    string    `json:"shopName"`
+	ClientNo    string    `json:"clientNo"`
+	DisplayName string    `json:"displayName"`
+	ClientIP    string    `json:"clientIp"`
+	RoomCode    string    `json:"roomCode"`
+	RoomName    string    `json:"roomName"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+	// Missing is set when the device was not in the latest crawl of its shop.
+	Missing bool `json:"missing"`
+}
+
+// ChangeInfo is one entry of the device change log.
+type ChangeInfo struct {
+	CommonCode  string    `json:"commonCode"`
+	ClientNo    string    `json:"clientNo"`
+	DisplayName string    `json:"displayName"`
+	Field       string    `json:"field"`
+	OldValue    string    `json:"oldValue"`
+	NewValue    string    `json:"newValue"`
+	ChangedAt   time.Time `json:"changedAt"`
+}
+
+// List returns the devices of the shop with commonCode, or of every shop if it is empty.
+func List(db *gorm.DB, commonCode string) ([]DeviceInfo, error) {
+	query := db.Model(&models.Device{}).
+		Select("shops.common_code, shops.name as shop_name, devices.client_no, devices.display_name, devices.client_ip, devices.room_code, rooms.name as room_name, devices.first_seen, devices.last_seen").
+		Joins("JOIN shops ON shops.id = devices.shop_id").
+		Joins("LEFT JOIN rooms ON rooms.shop_id = devices.shop_id AND rooms.code = devices.room_code").
+		Order("shops.common_code, devices.display_name, devices.client_no")
+	if commonCode != "" {
+		query = query.Where("shops.common_code = ?", commonCode)
+	}
+	devices := []DeviceInfo{}
+	if err := query.Scan(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	latest := make(map[string]time.Time)
+	for _, d := range devices {
+		if d.LastSeen.After(latest[d.CommonCode]) {
+			latest[d.CommonCode] = d.LastSeen
+		}
+	}
+	for i := range devices {
+		devices[i].Missing = devices[i].LastSeen.Before(latest[devices[i].CommonCode])
+	}
+	return devices, nil
+}
+
+// Changes returns the device changes since since, newest first.
+func Changes(db *gorm.DB, commonCode string, since time.Time) ([]ChangeInfo, error) {
+	query := db.Model(&models.DeviceChange{}).
+		Select("shops.common_code, devices.client_no, devices.display_name, device_changes.field, device_changes.old_value, device_changes.new_value, device_changes.changed_at").
+		Joins("JOIN devices ON devices.id = device_changes.device_id").
+		Joins("JOIN shops ON shops.id = devices.shop_id").
+		Where("device_changes.changed_at >= ?", since.UTC()).
+		Order("device_changes.changed_at DESC, device_changes.id DESC")
+	if commonCode != "" {
+		query = query.Where("shops.common_code = ?", commonCode)
+	}
+	changes := []ChangeInfo{}
+	if err := query.Scan(&changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list device changes: %w", err)
+	}
+	return changes, nil
+}
+
+// DevicesReport lays out devices as a table, one section per shop.
+func DevicesReport(devices []DeviceInfo, loc *time.Location) *report.Report {
+	r := &report.Report{Title: "设备清单"}
+	var section *report.Section
+	for _, d := range devices {
+		if section == nil || section.Title != d.ShopName {
+			section = r.AddSection(d.ShopName)
+			section.Table = &report.Table{Columns: []string{"名称", "编号", "IP", "房间", "首次出现", "最后出现"}}
+		}
+		lastSeen := d.LastSeen.In(loc).Format("01-02 15:04")
+		if d.Missing {
+			lastSeen += " (未出现)"
+		}
+		room := d.RoomName
+		if room == "" {
+			room = d.RoomCode
+		}
+		section.Table.Rows = append(section.Table.Rows, []string{
+			d.DisplayName, d.ClientNo, d.ClientIP, room, d.FirstSeen.In(loc).Format("2006-01-02"), lastSeen,
+		})
+	}
+	return r
+}
+
+// ChangesReport lists device changes as a table.
+func ChangesReport(changes []ChangeInfo, loc *time.Location) *report.Report {
+	r := &report.Report{Title: "设备变更记录"}
+	table := &report.Table{Columns: []string{"时间", "店铺", "设备", "变更", "原值", "新值"}}
+	for _, c := range changes {
+		table.Rows = append(table.Rows, []string{
+			c.ChangedAt.In(loc).Format("2006-01-02 15:04"), c.CommonCode, c.DisplayName, fieldNames[c.Field], c.OldValue, c.NewValue,
+		})
+	}
+	r.AddSection("").Table = table
+	return r
+}
+
+var fieldNames = map[string]string{
+	FieldIP:   "IP",
+	FieldRoom: "房间",
+	FieldSeat: "座位",
+	FieldName: "名称",
+}
+
+// Handler serves GET /api/devices?shop=CODE and /api/devices/changes?shop=CODE&days=N as JSON.
+func Handler(db *gorm.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/devices", func(w http.ResponseWriter, r *http.Request) {
+		devices, err := List(db, r.URL.Query().Get("shop"))
+		writeJSON(w, devices, err)
+	})
+	mux.HandleFunc("/api/devices/changes", func(w http.ResponseWriter, r *http.Request) {
+		days := 7
+		if value := r.URL.Query().Get("days"); value != "" {
+			var err error
+			if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+				http.Error(w, "invalid days", http.StatusBadRequest)
+				return
+			}
+		}
+		changes, err := Changes(db, r.URL.Query().Get("shop"), time.Now().AddDate(0, 0, -days))
+		writeJSON(w, changes, err)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(v)
+}
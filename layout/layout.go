@@ -0,0 +1,230 @@
+package layout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+const (
+	codeSeat = "SEAT"
+	codeRoom = "PRIVATE_ROOM"
+)
+
+// Element is the static part of a floor plan element. The client info is left out: the
+// upstream only sends it for seats in use, so the layout would change with the seat status.
+type Element struct {
+	ID     int     `json:"id"`
+	Code   string  `json:"code"`
+	Name   string  `json:"name,omitempty"`
+	Area   string  `json:"area,omitempty"`
+	Room   int     `json:"room,omitempty"` // PRIVATE_ROOM element containing the seat, from Area.Relations
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"w"`
+	Height float64 `json:"h"`
+	Rotate float64 `json:"r,omitempty"`
+}
+
+// Layout is every element of a shop's floor plan, ordered by ID.
+type Layout []Element
+
+// FromDetail extracts the layout of a detail response.
+func FromDetail(detail *models.DetailResponse) Layout {
+	parent := make(map[int]int)
+	for _, area := range detail.Data.Areas {
+		for _, relation := range area.Relations {
+			for _, seatID := range relation.ChildID {
+				parent[seatID] = relation.ParentID
+			}
+		}
+	}
+
+	var l Layout
+	for _, area := range detail.Data.Areas {
+		for _, e := range area.Elements {
+			l = append(l, Element{
+				ID:     e.ID,
+				Code:   e.ElementCode,
+				Name:   e.DisplayName,
+				Area:   area.AreaName,
+				Room:   parent[e.ID],
+				X:      e.PointX,
+				Y:      e.PointY,
+				Width:  e.Width,
+				Height: e.Height,
+				Rotate: e.Rotate,
+			})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+// Hash identifies the layout; equal layouts have equal hashes.
+func (l Layout) Hash() string {
+	data, _ := json.Marshal(l)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func (l Layout) count(code string) int {
+	n := 0
+	for _, e := range l {
+		if e.Code == code {
+			n++
+		}
+	}
+	return n
+}
+
+// label names an element in change descriptions.
+func (e Element) label() string {
+	kind := "元素"
+	switch e.Code {
+	case codeSeat:
+		kind = "座位"
+	case codeRoom:
+		kind = "房间"
+	}
+	if e.Name != "" {
+		return fmt.Sprintf("%s %s", kind, e.Name)
+	}
+	return fmt.Sprintf("%s #%d", kind, e.ID)
+}
+
+// Diff describes the seats and rooms that were added, removed or moved between old and new.
+// Other elements, such as walls and decorations, are only counted.
+func Diff(old, new Layout) []string {
+	oldByID := make(map[int]Element)
+	for _, e := range old {
+		oldByID[e.ID] = e
+	}
+	newByID := make(map[int]Element)
+	for _, e := range new {
+		newByID[e.ID] = e
+	}
+
+	var changes []string
+	others := 0
+	for _, e := range new {
+		if e.Code != codeSeat && e.Code != codeRoom {
+			if o, ok := oldByID[e.ID]; !ok || o != e {
+				others++
+			}
+			continue
+		}
+		o, ok := oldByID[e.ID]
+		switch {
+		case !ok:
+			changes = append(changes, "新增"+e.label()+roomSuffix(e, newByID))
+		case e.Code == codeSeat && o.Room != e.Room:
+			changes = append(changes, fmt.Sprintf("%s 换房间: %s -> %s", e.label(), roomName(o, oldByID), roomName(e, newByID)))
+		case o.X != e.X || o.Y != e.Y || o.Width != e.Width || o.Height != e.Height || o.Rotate != e.Rotate || o.Area != e.Area:
+			changes = append(changes, e.label()+" 位置调整")
+		case o.Name != e.Name:
+			changes = append(changes, fmt.Sprintf("%s 改名为 %s", o.label(), e.Name))
+		}
+	}
+	for _, o := range old {
+		if _, ok := newByID[o.ID]; ok {
+			continue
+		}
+		if o.Code != codeSeat && o.Code != codeRoom {
+			others++
+			continue
+		}
+		changes = append(changes, "移除"+o.label()+roomSuffix(o, oldByID))
+	}
+	if others > 0 {
+		changes = append(changes, fmt.Sprintf("其他元素变化 %d 处", others))
+	}
+	return changes
+}
+
+// roomName names the room of seat e, looked up in the layout byID it belongs to.
+func roomName(e Element, byID map[int]Element) string {
+	if e.Room == 0 {
+		return "大厅"
+	}
+	if room := byID[e.Room]; room.Name != "" {
+		return room.Name
+	}
+	return fmt.Sprintf("#%d", e.Room)
+}
+
+func roomSuffix(e Element, byID map[int]Element) string {
+	if e.Code != codeSeat {
+		return ""
+	}
+	return " (" + roomName(e, byID) + ")"
+}
+
+// maxNotifiedChanges keeps renovation notifications readable; the full list stays in the history.
+const maxNotifiedChanges = 20
+
+// OnChange is called when a shop's layout differs from its previous version.
+var OnChange func(shop *models.Shop, seats, rooms int, changes []string)
+
+// Check compares the layout in detail with the latest recorded version of shop and records a new
+// version when it differs. The first layout of a shop is recorded without a notification.
+func Check(db *gorm.DB, shop *models.Shop, detail *models.DetailResponse, at time.Time) error {
+	current := FromDetail(detail)
+	hash := current.Hash()
+
+	var previous models.LayoutVersion
+	db.Where("shop_id = ?", shop.ID).Order("detected_at DESC, id DESC").Limit(1).Find(&previous)
+	if previous.ID != 0 && previous.Hash == hash {
+		return nil
+	}
+
+	var changes []string
+	if previous.ID != 0 {
+		var old Layout
+		if err := json.Unmarshal([]byte(previous.Layout), &old); err != nil {
+			return fmt.Errorf("failed to read previous layout of %s: %w", shop.Name, err)
+		}
+		// 旧版本记录了座位的客户端信息，解析时已丢弃；其余相同则不算变化
+		if old.Hash() == hash {
+			return nil
+		}
+		changes = Diff(old, current)
+	}
+
+	data, _ := json.Marshal(current)
+	version := models.LayoutVersion{
+		ShopID:     shop.ID,
+		Hash:       hash,
+		Seats:      current.count(codeSeat),
+		Rooms:      current.count(codeRoom),
+		Layout:     string(data),
+		Changes:    strings.Join(changes, "\n"),
+		DetectedAt: at,
+	}
+	if err := db.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to save layout version of %s: %w", shop.Name, err)
+	}
+	if previous.ID == 0 {
+		log.Printf("Recorded initial layout of %s: %d seats, %d rooms", shop.Name, version.Seats, version.Rooms)
+		return nil
+	}
+
+	log.Printf("Layout of %s changed: %d changes", shop.Name, len(changes))
+	if OnChange != nil && len(changes) > 0 {
+		if len(changes) > maxNotifiedChanges {
+			more := len(changes) - maxNotifiedChanges
+			changes = append(changes[:maxNotifiedChanges:maxNotifiedChanges], fmt.Sprintf("等共 %d 处变化", maxNotifiedChanges+more))
+		}
+		OnChange(shop, version.Seats, version.Rooms, changes)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package layout
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"wywk/db"
+	"wywk/models"
+)
+
+var (
+	seat1 = Element{ID: 1, Code: codeSeat, Name: "01", X: 10, Y: 10, Width: 5, Height: 5}
+	seat2 = Element{ID: 2, Code: codeSeat, Name: "02", Room: 9, X: 20, Y: 10, Width: 5, Height: 5}
+	room  = Element{ID: 9, Code: codeRoom, Name: "包间1", X: 0, Y: 0, Width: 50, Height: 50}
+	wall  = Element{ID: 20, Code: "WALL", X: 0, Y: 0, Width: 100, Height: 1}
+)
+
+func with(e Element, change func(*Element)) Element {
+	change(&e)
+	return e
+}
+
+func TestDiff(t *testing.T) {
+	base := Layout{seat1, seat2, room, wall}
+	tests := []struct {
+		name string
+		new  Layout
+		want []string
+	}{
+		{"unchanged", base, nil},
+		{"seat added", append(Layout{with(seat1, func(e *Element) { e.ID, e.Name = 3, "03" })}, base...),
+			[]string{"新增座位 03 (大厅)"}},
+		{"seat removed", Layout{seat1, room, wall}, []string{"移除座位 02 (包间1)"}},
+		{"seat without name or room", append(Layout{{ID: 4, Code: codeSeat}}, base...), []string{"新增座位 #4 (大厅)"}},
+		{"room removed", Layout{seat1, seat2, wall}, []string{"移除房间 包间1"}},
+		{"seat in unknown room", Layout{seat1, with(seat2, func(e *Element) { e.ID, e.Room = 5, 8 }), room, wall},
+			[]string{"新增座位 02 (#8)", "移除座位 02 (包间1)"}},
+		{"seat moved", Layout{with(seat1, func(e *Element) { e.X = 11 }), seat2, room, wall}, []string{"座位 01 位置调整"}},
+		{"seat rotated", Layout{with(seat1, func(e *Element) { e.Rotate = 90 }), seat2, room, wall}, []string{"座位 01 位置调整"}},
+		{"seat changed room", Layout{with(seat1, func(e *Element) { e.Room = 9 }), seat2, room, wall}, []string{"座位 01 换房间: 大厅 -> 包间1"}},
+		{"seat left private room", Layout{seat1, with(seat2, func(e *Element) { e.Room = 0 }), room, wall}, []string{"座位 02 换房间: 包间1 -> 大厅"}},
+		{"room renamed", Layout{seat1, seat2, with(room, func(e *Element) { e.Name = "包间A" }), wall}, []string{"房间 包间1 改名为 包间A"}},
+		{"other elements only counted", Layout{seat1, seat2, room, with(wall, func(e *Element) { e.Width = 90 }), {ID: 21, Code: "DOOR"}},
+			[]string{"其他元素变化 2 处"}},
+		{"other element removed", Layout{seat1, seat2, room}, []string{"其他元素变化 1 处"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(base, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromDetail(t *testing.T) {
+	detail := &models.DetailResponse{Data: models.DetailData{Areas: []models.Area{{
+		AreaName: "一楼",
+		Elements: []models.Element{
+			{ID: 9, ElementCode: codeRoom, DisplayName: "包间1", Width: 50, Height: 50},
+			{ID: 2, ElementCode: codeSeat, PointX: 20, PointY: 10, ClientInfo: &models.ClientInfo{RoomCode: "B", DisplayName: "02", Status: 1}},
+			{ID: 1, ElementCode: codeSeat, DisplayName: "01", PointX: 10, PointY: 10, ClientInfo: &models.ClientInfo{RoomCode: "A", DisplayName: "X"}},
+		},
+		Relations: []models.Relation{{ParentID: 9, ChildID: []int{2}}},
+	}}}}
+	want := Layout{
+		{ID: 1, Code: codeSeat, Name: "01", Area: "一楼", X: 10, Y: 10},
+		{ID: 2, Code: codeSeat, Area: "一楼", Room: 9, X: 20, Y: 10},
+		{ID: 9, Code: codeRoom, Name: "包间1", Area: "一楼", Width: 50, Height: 50},
+	}
+	got := FromDetail(detail)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromDetail() = %+v, want %+v", got, want)
+	}
+
+	// 座位状态不属于布局，空闲座位没有客户端信息
+	detail.Data.Areas[0].Elements[1].ClientInfo.Status = 0
+	if FromDetail(detail).Hash() != got.Hash() {
+		t.Error("Hash() changed with the seat status")
+	}
+	detail.Data.Areas[0].Elements[1].ClientInfo = nil
+	detail.Data.Areas[0].Elements[2].ClientInfo = nil
+	if FromDetail(detail).Hash() != got.Hash() {
+		t.Error("Hash() changed without client info")
+	}
+}
+
+func TestCheckIgnoresLegacyClientInfo(t *testing.T) {
+	database := db.Connect(filepath.Join(t.TempDir(), "test.db"))
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	shop := &models.Shop{ID: 1, Name: "门店A"}
+	detail := &models.DetailResponse{Data: models.DetailData{Areas: []models.Area{{
+		Elements: []models.Element{{ID: 1, ElementCode: codeSeat, DisplayName: "01"}},
+	}}}}
+	// 以前的版本把使用中座位的 roomCode 记进了布局
+	legacy := `[{"id":1,"code":"SEAT","name":"01","roomCode":"A","x":0,"y":0,"w":0,"h":0}]`
+	database.Create(&models.LayoutVersion{ShopID: shop.ID, Hash: "legacy", Layout: legacy, DetectedAt: time.Now()})
+
+	defer func(f func(*models.Shop, int, int, []string)) { OnChange = f }(OnChange)
+	notified := 0
+	OnChange = func(*models.Shop, int, int, []string) { notified++ }
+	if err := Check(database, shop, detail, time.Now()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	var versions int64
+	database.Model(&models.LayoutVersion{}).Count(&versions)
+	if versions != 1 || notified != 0 {
+		t.Errorf("got %d versions and %d notifications, want 1 and 0", versions, notified)
+	}
+}
@@ -1,42 +1,41 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
+	_ "time/tzdata" // the configured zone must load on hosts without a zoneinfo database
 
 	"gorm.io/gorm"
 
 	"wywk/api"
+	"wywk/calendar"
+	"wywk/config"
 	"wywk/daily"
-	"wywk/db"
 	"wywk/notification"
+	"wywk/rollup"
 )
 
-func processShop(db *gorm.DB, commonCode string, barkTokens []string) {
+func processShop(db *gorm.DB, commonCode string) {
 	log.Printf("Processing shop with common code: %s", commonCode)
 	stats, shopName, err := api.GetShopStats(db, commonCode)
 	if err != nil {
 		log.Printf("Error getting stats for %s: %v", commonCode, err)
-		notificationMessage := fmt.Sprintf("获取 %s 状态失败: %v", commonCode, err)
-		notification.SendBarkNotifications(barkTokens, notificationMessage, "") // No shopName if error getting stats
+		// 同一店铺持续失败时只在去重时间内告警一次
+		notification.SendAlert(notification.Alert{
+			Key:  "crawl-failed:" + commonCode,
+			Body: fmt.Sprintf("获取 %s 状态失败: %v", commonCode, err),
+		})
 		return
 	}
 
-	//fmt.Println(stats)
-	//notification.SendBarkNotifications(barkTokens, stats, shopName)
+	//notification.SendReport(notification.BarkChannels(barkTokens), stats)
 	_, _ = stats, shopName
 }
 
-type Config struct {
-	CommonCodes []string `json:"commonCodes"`
-	BarkTokens  []string `json:"barkTokens"`
-}
-
 func ChangeWorkingDir() {
 	var err error
 	executable, err := os.Executable()
@@ -51,60 +50,73 @@ func ChangeWorkingDir() {
 	}
 }
 
-func crawlData() {
-	ChangeWorkingDir()
-	// --- Config Loading ---
-	configFile, err := os.Open("config.json")
-	if err != nil {
-		log.Fatalf("Error opening config file: %v", err)
+func crawlData(db *gorm.DB, cfg *config.Config) {
+	// 先补发之前失败的通知，以及之前的运行中因免打扰、限流或汇总而排队的告警
+	notification.RetryOutbox()
+	notification.FlushAlerts()
+	for _, commonCode := range cfg.CommonCodes {
+		processShop(db, commonCode)
 	}
-	defer configFile.Close()
-
-	var config Config
-	jsonParser := json.NewDecoder(configFile)
-	if err = jsonParser.Decode(&config); err != nil {
-		log.Fatalf("Error parsing config file: %v", err)
+	if err := rollup.Run(db, cfg.Location()); err != nil {
+		log.Printf("Failed to roll up snapshots: %v", err)
 	}
+}
 
-	// --- Database Setup ---
-	db := db.InitDB()
+// catchUpDays is how far back the daily job looks for reports that were missed.
+const catchUpDays = 7
+
+func sendDailyReports(db *gorm.DB, cfg *config.Config) {
+	log.Println("Running daily report job...")
+	if year := time.Now().In(cfg.Location()).Year(); !calendar.HasYear(year) {
+		// 没有节假日数据时所有日期只按星期分类，同类日对比会失真
+		notification.SendAlert(notification.Alert{
+			Key:  fmt.Sprintf("calendar:%d", year),
+			Body: fmt.Sprintf("节假日日历缺少 %d 年的数据，请在配置的 holidayFile 中补充当年的放假和调休安排", year),
+		})
+	}
+	channels := notification.ChannelsFromConfig(cfg)
+	if cfg.Leaderboard && len(cfg.CommonCodes) > 1 {
+		// 多店时合并为一条排行消息，而不是每店一条日报
+		daily.CatchUpLeaderboards(db, cfg.CommonCodes, channels, catchUpDays, cfg.Location())
+	} else {
+		for _, commonCode := range cfg.CommonCodes {
+			daily.CatchUpDailyReports(db, commonCode, channels, catchUpDays, cfg.Location())
+		}
+	}
+	log.Println("Daily report job finished.")
 
-	// --- Main Logic ---
-	for _, commonCode := range config.CommonCodes {
-		processShop(db, commonCode, config.BarkTokens)
+	// 报告发送后再清理过期的原始数据
+	if _, err := rollup.Prune(db, cfg.RetentionDays, cfg.Location()); err != nil {
+		log.Printf("Failed to prune old snapshots: %v", err)
 	}
 }
 
 func main() {
-	// 1. Crawl live data and save it.
-	crawlData()
-
-	// 2. If it's between 00:00 and 01:00, generate and send a report from DB.
-	now := time.Now()
-	if now.Hour() == 0 {
-		log.Println("Running daily report job...")
-		ChangeWorkingDir()
-
-		// --- Config Loading ---
-		configFile, err := os.Open("config.json")
-		if err != nil {
-			log.Fatalf("Error opening config file for reporting: %v", err)
-		}
-		defer configFile.Close()
-
-		var config Config
-		jsonParser := json.NewDecoder(configFile)
-		if err = jsonParser.Decode(&config); err != nil {
-			log.Fatalf("Error parsing config file for reporting: %v", err)
+	if len(os.Args) < 2 {
+		// 兼容旧的 cron 用法: 不带参数时抓取数据，并在 00:00 - 01:00 之间发送日报
+		opts := &options{configPath: config.DefaultPath}
+		opts.resolve()
+		cfg := opts.loadConfig()
+		db := opts.openDB()
+		crawlData(db, cfg)
+		if time.Now().In(cfg.Location()).Hour() == 0 {
+			sendDailyReports(db, cfg)
 		}
+		return
+	}
 
-		// --- Database Setup ---
-		db := db.InitDB()
-
-		// --- Reporting Logic ---
-		for _, commonCode := range config.CommonCodes {
-			daily.GenerateAndSendDailyReport(db, commonCode, config.BarkTokens)
+	name, args := os.Args[1], os.Args[2:]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			return
 		}
-		log.Println("Daily report job finished.")
 	}
+	if name != "help" && name != "-h" && name != "--help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	}
+	usage()
+	os.Exit(2)
 }
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,14 +13,18 @@ type Shop struct {
 	CommonCode string `gorm:"uniqueIndex"`
 	Name       string
 	Address    string
-	Snapshots  []Snapshot `gorm:"foreignKey:ShopID"`
-	Rooms      []Room     `gorm:"foreignKey:ShopID"`
+	// Latitude and Longitude are GCJ-02, like every map app in China; zero when unknown.
+	Latitude  float64
+	Longitude float64
+	Snapshots []Snapshot `gorm:"foreignKey:ShopID"`
+	Rooms     []Room     `gorm:"foreignKey:ShopID"`
 }
 
+// Room codes are only unique within a shop.
 type Room struct {
-	ID           uint `gorm:"primaryKey"`
-	ShopID       uint
-	Code         string `gorm:"uniqueIndex"`
+	ID           uint   `gorm:"primaryKey"`
+	ShopID       uint   `gorm:"uniqueIndex:idx_rooms_shop_code"`
+	Code         string `gorm:"uniqueIndex:idx_rooms_shop_code"`
 	Name         string
 	TotalDevices int
 	NoSmoking    int
@@ -46,6 +53,151 @@ type RoomSnapshot struct {
 	UsageRate    float64 // New field for room usage rate
 }
 
+// ShopRollup aggregates the snapshots of a shop over one hour or one day, so raw
+// snapshots can be pruned while reports over old ranges keep working.
+type ShopRollup struct {
+	ID             uint      `gorm:"primaryKey"`
+	ShopID         uint      `gorm:"uniqueIndex:idx_shop_rollups_period"`
+	Granularity    string    `gorm:"uniqueIndex:idx_shop_rollups_period"` // "hour" or "day"
+	PeriodStart    time.Time `gorm:"uniqueIndex:idx_shop_rollups_period"`
+	Samples        int       // number of snapshots aggregated
+	Minutes        float64   // time covered by the snapshots; averages are weighted by it
+	TotalDevices   int       // from the last snapshot in the period
+	AvgUsageRate   float64
+	MaxUsageRate   float64
+	AvgUsedDevices float64
+	MaxUsedDevices int
+	DeviceHours    float64 // occupied device time in hours
+	PeakMinutes    float64 // time spent at or above 90% usage
+}
+
+// RoomRollup aggregates the room snapshots of a room over one hour or one day.
+type RoomRollup struct {
+	ID             uint      `gorm:"primaryKey"`
+	RoomID         uint      `gorm:"uniqueIndex:idx_room_rollups_period"`
+	Granularity    string    `gorm:"uniqueIndex:idx_room_rollups_period"`
+	PeriodStart    time.Time `gorm:"uniqueIndex:idx_room_rollups_period"`
+	Samples        int
+	Minutes        float64
+	TotalDevices   int
+	AvgUsageRate   float64
+	MaxUsageRate   float64
+	AvgUsedDevices float64
+	MaxUsedDevices int
+	DeviceHours    float64
+	PeakMinutes    float64
+}
+
+// RoomNameChange records a room being renamed upstream while keeping its code.
+type RoomNameChange struct {
+	ID        uint `gorm:"primaryKey"`
+	RoomID    uint `gorm:"index"`
+	OldName   string
+	NewName   string
+	ChangedAt time.Time
+}
+
+// ReportHistory records which reports have been sent, so missed periods can be
+// caught up and duplicates avoided.
+type ReportHistory struct {
+	ID          uint      `gorm:"primaryKey"`
+	ShopID      uint      `gorm:"uniqueIndex:idx_report_history_period"`
+	Kind        string    `gorm:"uniqueIndex:idx_report_history_period"` // "daily" or "weekly", "leaderboard-daily" etc. under shop 0
+	PeriodStart time.Time `gorm:"uniqueIndex:idx_report_history_period"`
+	PeriodEnd   time.Time
+	SentAt      time.Time
+}
+
+// LayoutVersion is one distinct layout of a shop's floor plan, recorded when a crawl
+// sees elements added, removed or moved compared with the previous version.
+type LayoutVersion struct {
+	ID         uint `gorm:"primaryKey"`
+	ShopID     uint `gorm:"index"`
+	Hash       string
+	Seats      int
+	Rooms      int
+	Layout     string // JSON of the layout elements
+	Changes    string // one change per line, empty for the first version
+	DetectedAt time.Time
+}
+
+// Device is one client machine of a shop, keyed by its client number.
+type Device struct {
+	ID          uint   `gorm:"primaryKey"`
+	ShopID      uint   `gorm:"uniqueIndex:idx_devices_shop_client"`
+	ClientNo    string `gorm:"uniqueIndex:idx_devices_shop_client"`
+	DisplayName string
+	ClientIP    string
+	RoomCode    string
+	ElementID   int // seat element it was last seen at
+	FirstSeen   time.Time
+	LastSeen    time.Time
+}
+
+// DeviceChange records a device changing its IP, room, seat or name between crawls.
+type DeviceChange struct {
+	ID        uint   `gorm:"primaryKey"`
+	DeviceID  uint   `gorm:"index"`
+	Field     string // "ip", "room", "seat" or "name"
+	OldValue  string
+	NewValue  string
+	ChangedAt time.Time
+}
+
+// OutboxMessage is a rendered notification for one channel, kept until it is delivered.
+type OutboxMessage struct {
+	ID            uint   `gorm:"primaryKey"`
+	Recipient     string // hash identifying the channel, without its secrets
+	ChannelName   string
+	Title         string
+	Body          string
+	GroupName     string
+	Images        string // JSON, charts included
+	Status        string `gorm:"index:idx_outbox_messages_due"` // "pending", "sent" or "failed"
+	Attempts      int
+	PartsSent     int       // parts already delivered when a channel sends several messages
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_messages_due"`
+	LastError     string
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+// QueuedAlert is an alert waiting in the dispatcher queue of one recipient, held for a
+// digest, quiet hours or the rate limit.
+type QueuedAlert struct {
+	ID        uint   `gorm:"primaryKey"`
+	Recipient string // hash identifying the channel, as in OutboxMessage
+	DedupKey  string
+	GroupName string
+	Body      string
+	At        time.Time
+	HeldQuiet bool // the queue of the recipient was held during quiet hours
+}
+
+// AlertKey is the dedup key of an accepted alert; repeats are dropped until it expires.
+type AlertKey struct {
+	ID         uint `gorm:"primaryKey"`
+	DedupKey   string
+	AcceptedAt time.Time
+}
+
+// AlertSend is a message sent to an alert recipient, counted against its hourly rate limit.
+type AlertSend struct {
+	ID        uint `gorm:"primaryKey"`
+	Recipient string
+	SentAt    time.Time
+}
+
+// SchemaFingerprint is the last seen shape of an upstream response of one shop.
+type SchemaFingerprint struct {
+	ID         uint   `gorm:"primaryKey"`
+	CommonCode string `gorm:"uniqueIndex:idx_schema_fingerprints_endpoint"`
+	Endpoint   string `gorm:"uniqueIndex:idx_schema_fingerprints_endpoint"` // archive.Info or archive.Detail
+	Hash       string
+	Shape      string // JSON object of field path -> JSON type
+	UpdatedAt  time.Time
+}
+
 // endregion
 
 // region API Response Structs
@@ -121,9 +273,28 @@ type ShopInfoResponse struct {
 }
 
 type ShopInfoData struct {
-	StoreName    string `json:"storeName"`
-	StoreAddress string `json:"storeAddress"`
-	ShopStatus   string `json:"shopStatus"`
+	StoreName    string     `json:"storeName"`
+	StoreAddress string     `json:"storeAddress"`
+	ShopStatus   string     `json:"shopStatus"`
+	Latitude     Coordinate `json:"latitude"`
+	Longitude    Coordinate `json:"longitude"`
+}
+
+// Coordinate accepts numbers as well as numeric strings, which the gateway uses for some fields.
+type Coordinate float64
+
+func (c *Coordinate) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*c = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate %s", data)
+	}
+	*c = Coordinate(f)
+	return nil
 }
 
 //endregion
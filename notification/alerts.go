@@ -0,0 +1,443 @@
+package notification
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/config"
+	"wywk/models"
+	"wywk/report"
+)
+
+// Alert is a real-time message, as opposed to a scheduled report. Alerts go through the
+// dispatcher, which deduplicates them and paces them per recipient.
+type Alert struct {
+	// Key identifies repeats of the same alert, which are dropped for the dedup TTL.
+	// Empty never deduplicates.
+	Key   string
+	Group string // 店名，与店铺无关的告警为空
+	Body  string
+	At    time.Time
+}
+
+// recipient is one channel that gets alerts, with its queue and send history.
+type recipient struct {
+	channel    Channel
+	rateLimit  int // per hour, 0 for none
+	quietStart int // minutes after midnight; no quiet hours when equal to quietEnd
+	quietEnd   int
+
+	queue     []Alert
+	heldQuiet bool        // part of the queue was held during quiet hours
+	sent      []time.Time // sends within the last hour, for the rate limit
+}
+
+func (r *recipient) quiet(now time.Time) bool {
+	if r.quietStart == r.quietEnd {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if r.quietStart < r.quietEnd {
+		return minute >= r.quietStart && minute < r.quietEnd
+	}
+	return minute >= r.quietStart || minute < r.quietEnd
+}
+
+// allowance returns how many messages r may get now under its rate limit, -1 for any number.
+func (r *recipient) allowance(now time.Time) int {
+	kept := r.sent[:0]
+	for _, t := range r.sent {
+		if now.Sub(t) < time.Hour {
+			kept = append(kept, t)
+		}
+	}
+	r.sent = kept
+	if r.rateLimit == 0 {
+		return -1
+	}
+	return max(r.rateLimit-len(r.sent), 0)
+}
+
+// Dispatcher queues alerts per recipient and sends them subject to dedup keys, rate
+// limits, quiet hours and digests. With a database the queues, dedup keys and send history
+// are stored there, so that short-lived runs such as cron crawls share them.
+type Dispatcher struct {
+	mu          sync.Mutex
+	db          *gorm.DB
+	recipients  map[string]*recipient
+	seen        map[string]time.Time // dedup key -> time the alert was accepted
+	dedupTTL    time.Duration
+	digest      time.Duration
+	quietDigest bool
+	loc         *time.Location
+}
+
+// NewDispatcher returns a dispatcher without recipients; Configure adds them.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{recipients: make(map[string]*recipient), seen: make(map[string]time.Time), loc: time.Local}
+}
+
+// alerts is the dispatcher behind SendAlert, configured by Configure.
+var alerts = NewDispatcher()
+
+// SendAlert dispatches an alert to every alert recipient.
+func SendAlert(a Alert) {
+	alerts.Dispatch(a)
+}
+
+// FlushAlerts sends the queued alerts that are due, such as those held by an earlier run.
+func FlushAlerts() {
+	alerts.Flush(time.Now())
+}
+
+// RunAlerts flushes the queued alerts every minute until stop is closed.
+func RunAlerts(stop <-chan struct{}) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			alerts.Flush(now)
+		}
+	}
+}
+
+// Configure replaces the recipients and settings with those of cfg: Bark tokens and every
+// channel with alerts set. Queues and send history of recipients still configured are kept.
+func (d *Dispatcher) Configure(cfg *config.Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dedupTTL = cfg.Alerts.DedupTTL()
+	d.digest = time.Duration(cfg.Alerts.DigestMinutes) * time.Minute
+	d.quietDigest = cfg.Alerts.QuietDigest
+	d.loc = cfg.Location()
+
+	add := func(recipients map[string]*recipient, channel Channel, rateLimit int, quietHours string) {
+		r := &recipient{channel: channel, rateLimit: rateLimit}
+		// config.Validate already checked the format
+		r.quietStart, r.quietEnd, _ = config.ParseQuietHours(quietHours)
+		id := recipientID(channel)
+		if old, ok := d.recipients[id]; ok {
+			r.queue, r.heldQuiet, r.sent = old.queue, old.heldQuiet, old.sent
+		}
+		recipients[id] = r
+	}
+	recipients := make(map[string]*recipient)
+	for _, channel := range BarkChannels(cfg.BarkTokens) {
+		add(recipients, channel, cfg.Alerts.RateLimit(), cfg.Alerts.QuietHours)
+	}
+	for i, channel := range ChannelsFromConfig(&config.Config{Channels: cfg.Channels}) {
+		c := cfg.Channels[i]
+		if !c.Alerts {
+			continue
+		}
+		rateLimit := cfg.Alerts.RateLimit()
+		if c.RateLimitPerHour != 0 {
+			rateLimit = config.AlertConfig{RateLimitPerHour: c.RateLimitPerHour}.RateLimit()
+		}
+		quietHours := cfg.Alerts.QuietHours
+		if c.QuietHours != "" {
+			quietHours = c.QuietHours
+		}
+		add(recipients, channel, rateLimit, quietHours)
+	}
+	for id, old := range d.recipients {
+		if _, ok := recipients[id]; !ok && len(old.queue) > 0 {
+			log.Printf("Dropping %d queued alerts for removed recipient %s", len(old.queue), old.channel.Name())
+		}
+	}
+	d.recipients = recipients
+}
+
+// UseDB keeps the state of d in db from now on. Call it before dispatching alerts; state
+// held only in memory until then is replaced by the stored one.
+func (d *Dispatcher) UseDB(db *gorm.DB) {
+	d.mu.Lock()
+	d.db = db
+	d.mu.Unlock()
+}
+
+// update runs fn on the state of d under its lock. With a database the state is loaded
+// before fn and saved after it in one transaction; if that fails, fn still runs on the state
+// in memory.
+func (d *Dispatcher) update(now time.Time, fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.db == nil || len(d.recipients) == 0 {
+		fn()
+		return
+	}
+	ran := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := d.load(tx); err != nil {
+			return err
+		}
+		fn()
+		ran = true
+		return d.save(tx, now)
+	})
+	if err != nil {
+		log.Printf("Failed to store alert queue: %v", err)
+		if !ran {
+			fn()
+		}
+	}
+}
+
+// load replaces the queues, send history and dedup keys in memory with the stored ones.
+// Queued alerts of recipients that are no longer configured are dropped.
+func (d *Dispatcher) load(tx *gorm.DB) error {
+	var queued []models.QueuedAlert
+	if err := tx.Order("id").Find(&queued).Error; err != nil {
+		return err
+	}
+	var sends []models.AlertSend
+	if err := tx.Order("id").Find(&sends).Error; err != nil {
+		return err
+	}
+	var keys []models.AlertKey
+	if err := tx.Find(&keys).Error; err != nil {
+		return err
+	}
+
+	for _, r := range d.recipients {
+		r.queue, r.heldQuiet, r.sent = nil, false, nil
+	}
+	dropped := 0
+	for _, q := range queued {
+		r, ok := d.recipients[q.Recipient]
+		if !ok {
+			dropped++
+			continue
+		}
+		r.queue = append(r.queue, Alert{Key: q.DedupKey, Group: q.GroupName, Body: q.Body, At: q.At})
+		r.heldQuiet = r.heldQuiet || q.HeldQuiet
+	}
+	if dropped > 0 {
+		log.Printf("Dropping %d queued alerts for removed recipients", dropped)
+	}
+	for _, send := range sends {
+		if r, ok := d.recipients[send.Recipient]; ok {
+			r.sent = append(r.sent, send.SentAt)
+		}
+	}
+	d.seen = make(map[string]time.Time, len(keys))
+	for _, key := range keys {
+		d.seen[key.DedupKey] = key.AcceptedAt
+	}
+	return nil
+}
+
+// save replaces the stored state with the one in memory, leaving out sends older than an
+// hour and expired dedup keys.
+func (d *Dispatcher) save(tx *gorm.DB, now time.Time) error {
+	all := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+	for _, model := range []any{&models.QueuedAlert{}, &models.AlertSend{}, &models.AlertKey{}} {
+		if err := all.Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	var queued []models.QueuedAlert
+	var sends []models.AlertSend
+	for id, r := range d.recipients {
+		for _, a := range r.queue {
+			queued = append(queued, models.QueuedAlert{
+				Recipient: id, DedupKey: a.Key, GroupName: a.Group, Body: a.Body, At: a.At.UTC(), HeldQuiet: r.heldQuiet,
+			})
+		}
+		for _, t := range r.sent {
+			if now.Sub(t) < time.Hour {
+				sends = append(sends, models.AlertSend{Recipient: id, SentAt: t.UTC()})
+			}
+		}
+	}
+	var keys []models.AlertKey
+	for key, at := range d.seen {
+		if now.Sub(at) < d.dedupTTL {
+			keys = append(keys, models.AlertKey{DedupKey: key, AcceptedAt: at.UTC()})
+		}
+	}
+
+	if len(queued) > 0 {
+		if err := tx.CreateInBatches(queued, 100).Error; err != nil {
+			return err
+		}
+	}
+	if len(sends) > 0 {
+		if err := tx.CreateInBatches(sends, 100).Error; err != nil {
+			return err
+		}
+	}
+	if len(keys) > 0 {
+		return tx.CreateInBatches(keys, 100).Error
+	}
+	return nil
+}
+
+// recipientID tells recipients apart without keeping their secrets around in plain text.
+func recipientID(channel Channel) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%T %+v", channel, channel)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Dispatch queues a for every recipient, unless an alert with the same key was accepted
+// within the dedup TTL, and sends what is due right away.
+func (d *Dispatcher) Dispatch(a Alert) {
+	if a.At.IsZero() {
+		a.At = time.Now()
+	}
+	queued := false
+	d.update(a.At, func() {
+		if len(d.recipients) == 0 {
+			log.Println("No alert recipients configured. Skipping alert.")
+			return
+		}
+		if a.Key != "" {
+			for key, at := range d.seen {
+				if a.At.Sub(at) >= d.dedupTTL {
+					delete(d.seen, key)
+				}
+			}
+			if _, ok := d.seen[a.Key]; ok {
+				log.Printf("Dropping duplicate alert %s", a.Key)
+				return
+			}
+			d.seen[a.Key] = a.At
+		}
+		for _, r := range d.recipients {
+			r.queue = append(r.queue, a)
+		}
+		queued = true
+	})
+	if queued {
+		d.Flush(a.At)
+	}
+}
+
+// Flush sends the queued alerts that are due at now. Outside quiet hours, once a digest
+// window has passed, a recipient gets its queue as one digest when there is more than one
+// alert and digests are enabled or its rate limit would not allow them all; otherwise one
+// message per alert.
+func (d *Dispatcher) Flush(now time.Time) {
+	type delivery struct {
+		channel Channel
+		alerts  []Alert
+		digest  bool
+	}
+	var deliveries []delivery
+	var loc *time.Location
+
+	d.update(now, func() {
+		local := now.In(d.loc)
+		for _, r := range d.recipients {
+			if len(r.queue) == 0 {
+				continue
+			}
+			if r.quiet(local) {
+				r.heldQuiet = true
+				continue
+			}
+			if d.digest > 0 && now.Sub(r.queue[0].At) < d.digest {
+				continue
+			}
+			allowance := r.allowance(now)
+			if allowance == 0 {
+				continue
+			}
+			digest := d.digest > 0 || (d.quietDigest && r.heldQuiet) || (allowance > 0 && len(r.queue) > allowance)
+			if digest && len(r.queue) > 1 {
+				deliveries = append(deliveries, delivery{channel: r.channel, alerts: r.queue, digest: true})
+				r.sent = append(r.sent, now)
+				r.queue = nil
+			} else {
+				for len(r.queue) > 0 && allowance != 0 {
+					deliveries = append(deliveries, delivery{channel: r.channel, alerts: r.queue[:1]})
+					r.sent = append(r.sent, now)
+					r.queue = r.queue[1:]
+					allowance--
+				}
+			}
+			if len(r.queue) == 0 {
+				r.heldQuiet = false
+			}
+		}
+		loc = d.loc
+	})
+
+	// 发送可能较慢，不持有锁
+	for _, delivery := range deliveries {
+		var r *report.Report
+		if delivery.digest {
+			r = digestReport(delivery.alerts, loc)
+		} else {
+			a := delivery.alerts[0]
+			r = &report.Report{Group: a.Group}
+			r.AddSection("").Lines = strings.Split(a.Body, "\n")
+		}
+		if err := sendAlert(delivery.channel, r); err != nil {
+			log.Printf("Failed to send alert to %s: %v", delivery.channel.Name(), err)
+		}
+	}
+}
+
+// Pending returns the number of queued alerts over all recipients.
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pending := 0
+	for _, r := range d.recipients {
+		pending += len(r.queue)
+	}
+	return pending
+}
+
+// digestReport lists alerts by shop, in the order they were raised.
+func digestReport(alerts []Alert, loc *time.Location) *report.Report {
+	r := &report.Report{Title: fmt.Sprintf("告警汇总 (%d 条)", len(alerts)), Group: "告警汇总"}
+	var groups []string
+	byGroup := make(map[string][]Alert)
+	for _, a := range alerts {
+		if _, ok := byGroup[a.Group]; !ok {
+			groups = append(groups, a.Group)
+		}
+		byGroup[a.Group] = append(byGroup[a.Group], a)
+	}
+	// 与店铺无关的告警放在最前
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i] == "" && groups[j] != "" })
+	for _, group := range groups {
+		section := r.AddSection(group)
+		for _, a := range byGroup[group] {
+			section.Lines = append(section.Lines, a.At.In(loc).Format("15:04")+" "+strings.ReplaceAll(a.Body, "\n", "\n    "))
+		}
+	}
+	return r
+}
+
+// sendAlert renders r for channel and sends it; the title falls back to a generic subject
+// for channels that need one, such as email.
+func sendAlert(channel Channel, r *report.Report) error {
+	body, err := report.Render(channel.Format(), r)
+	if err != nil {
+		return err
+	}
+	title := r.Title
+	if title == "" {
+		title = "告警"
+		if r.Group != "" {
+			title += " - " + r.Group
+		}
+	}
+	return deliver(channel, title, strings.TrimRight(body, "\n"), r.Group, nil)
+}
@@ -0,0 +1,224 @@
+package notification
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/config"
+	"wywk/db"
+	"wywk/report"
+)
+
+// sentMessage is one message a fakeChannel was asked to send.
+type sentMessage struct {
+	title, body string
+	images      int
+}
+
+// fakeChannel records what it sends and fails with the queued errors first.
+type fakeChannel struct {
+	name   string
+	log    *[]sentMessage
+	errs   *[]error
+	during func() // called while sending, if set
+}
+
+func newFakeChannel(name string) fakeChannel {
+	return fakeChannel{name: name, log: &[]sentMessage{}, errs: &[]error{}}
+}
+
+func (c fakeChannel) Name() string   { return c.name }
+func (c fakeChannel) Format() string { return report.FormatText }
+
+func (c fakeChannel) Send(title, body, group string, images []report.Image) error {
+	*c.log = append(*c.log, sentMessage{title: title, body: body, images: len(images)})
+	if c.during != nil {
+		c.during()
+	}
+	if len(*c.errs) > 0 {
+		err := (*c.errs)[0]
+		*c.errs = (*c.errs)[1:]
+		return err
+	}
+	return nil
+}
+
+// openTestDB returns a migrated SQLite database in a temporary directory.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	database := db.Connect(filepath.Join(t.TempDir(), "test.db"))
+	if err := db.Migrate(database); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return database
+}
+
+func testDispatcher(channel Channel, r recipient) *Dispatcher {
+	d := NewDispatcher()
+	d.loc = time.UTC
+	d.dedupTTL = time.Hour
+	r.channel = channel
+	d.recipients[recipientID(channel)] = &r
+	return d
+}
+
+var noon = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+func queued(n int, at time.Time) []Alert {
+	alerts := make([]Alert, n)
+	for i := range alerts {
+		alerts[i] = Alert{Body: "告警" + string(rune('A'+i)), At: at}
+	}
+	return alerts
+}
+
+func TestDispatcherFlush(t *testing.T) {
+	nightStart, nightEnd, _ := config.ParseQuietHours("23:00-08:00")
+
+	tests := []struct {
+		name        string
+		recipient   recipient
+		digest      time.Duration
+		quietDigest bool
+		now         time.Time
+		titles      []string // titles of the messages sent
+		left        int      // alerts still queued
+		heldQuiet   bool
+	}{
+		{
+			name:      "one message per alert",
+			recipient: recipient{queue: queued(2, noon)},
+			now:       noon,
+			titles:    []string{"告警", "告警"},
+		},
+		{
+			name:      "nothing queued",
+			recipient: recipient{},
+			now:       noon,
+		},
+		{
+			name:      "rate limit turns the queue into a digest",
+			recipient: recipient{rateLimit: 1, queue: queued(3, noon)},
+			now:       noon,
+			titles:    []string{"告警汇总 (3 条)"},
+		},
+		{
+			name:      "rate limit used up",
+			recipient: recipient{rateLimit: 1, queue: queued(2, noon), sent: []time.Time{noon.Add(-30 * time.Minute)}},
+			now:       noon,
+			left:      2,
+		},
+		{
+			name:      "sends older than an hour do not count",
+			recipient: recipient{rateLimit: 1, queue: queued(1, noon), sent: []time.Time{noon.Add(-time.Hour)}},
+			now:       noon,
+			titles:    []string{"告警"},
+		},
+		{
+			name:      "held during quiet hours",
+			recipient: recipient{quietStart: nightStart, quietEnd: nightEnd, queue: queued(2, noon.Add(-10*time.Hour))},
+			now:       noon.Add(-10 * time.Hour),
+			left:      2,
+			heldQuiet: true,
+		},
+		{
+			name:        "quiet digest after quiet hours",
+			recipient:   recipient{quietStart: nightStart, quietEnd: nightEnd, heldQuiet: true, queue: queued(2, noon.Add(-10*time.Hour))},
+			quietDigest: true,
+			now:         noon.Add(-4 * time.Hour),
+			titles:      []string{"告警汇总 (2 条)"},
+		},
+		{
+			name:      "quiet hours over without digest",
+			recipient: recipient{quietStart: nightStart, quietEnd: nightEnd, heldQuiet: true, queue: queued(2, noon.Add(-10*time.Hour))},
+			now:       noon.Add(-4 * time.Hour),
+			titles:    []string{"告警", "告警"},
+		},
+		{
+			name:      "digest window still open",
+			recipient: recipient{queue: queued(2, noon.Add(-5*time.Minute))},
+			digest:    10 * time.Minute,
+			now:       noon,
+			left:      2,
+		},
+		{
+			name:      "digest window passed",
+			recipient: recipient{queue: queued(2, noon.Add(-10*time.Minute))},
+			digest:    10 * time.Minute,
+			now:       noon,
+			titles:    []string{"告警汇总 (2 条)"},
+		},
+		{
+			name:      "single alert is no digest",
+			recipient: recipient{queue: []Alert{{Group: "一号店", Body: "掉线", At: noon.Add(-time.Hour)}}},
+			digest:    10 * time.Minute,
+			now:       noon,
+			titles:    []string{"告警 - 一号店"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newFakeChannel("fake")
+			d := testDispatcher(channel, tt.recipient)
+			d.digest, d.quietDigest = tt.digest, tt.quietDigest
+			d.Flush(tt.now)
+
+			var titles []string
+			for _, m := range *channel.log {
+				titles = append(titles, m.title)
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.titles, "|") {
+				t.Errorf("sent %q, want %q", titles, tt.titles)
+			}
+			if got := d.Pending(); got != tt.left {
+				t.Errorf("Pending() = %d, want %d", got, tt.left)
+			}
+			if r := d.recipients[recipientID(channel)]; r.heldQuiet != tt.heldQuiet {
+				t.Errorf("heldQuiet = %v, want %v", r.heldQuiet, tt.heldQuiet)
+			}
+		})
+	}
+}
+
+func TestDispatcherKeepsStateInDB(t *testing.T) {
+	database := openTestDB(t)
+	channel := newFakeChannel("fake")
+	newDispatcher := func() *Dispatcher {
+		d := testDispatcher(channel, recipient{rateLimit: 1})
+		d.digest = 10 * time.Minute
+		d.UseDB(database)
+		return d
+	}
+
+	// 第一次运行：告警进入汇总窗口，尚未发送
+	first := newDispatcher()
+	first.Dispatch(Alert{Key: "offline:A", Body: "A 掉线", At: noon})
+	first.Dispatch(Alert{Key: "offline:B", Body: "B 掉线", At: noon.Add(time.Minute)})
+	if len(*channel.log) != 0 {
+		t.Fatalf("sent %d messages inside the digest window", len(*channel.log))
+	}
+
+	// 第二次运行：重复的告警被丢弃，队列到期后作为汇总发出
+	second := newDispatcher()
+	second.Dispatch(Alert{Key: "offline:A", Body: "A 掉线", At: noon.Add(5 * time.Minute)})
+	second.Flush(noon.Add(11 * time.Minute))
+	if len(*channel.log) != 1 || (*channel.log)[0].title != "告警汇总 (2 条)" {
+		t.Fatalf("sent %+v, want one digest of 2 alerts", *channel.log)
+	}
+
+	// 第三次运行：上一次的发送计入限流
+	third := newDispatcher()
+	third.Dispatch(Alert{Key: "offline:C", Body: "C 掉线", At: noon.Add(30 * time.Minute)})
+	third.Flush(noon.Add(45 * time.Minute))
+	if len(*channel.log) != 1 {
+		t.Fatalf("sent %d messages, want the rate limit to hold the third alert", len(*channel.log))
+	}
+	third.Flush(noon.Add(72 * time.Minute))
+	if len(*channel.log) != 2 {
+		t.Fatalf("sent %d messages, want the third alert once the hour has passed", len(*channel.log))
+	}
+}
@@ -0,0 +1,223 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"wywk/config"
+	"wywk/report"
+)
+
+// ChannelsFromConfig builds every channel configured in cfg, Bark tokens included.
+func ChannelsFromConfig(cfg *config.Config) []Channel {
+	channels := BarkChannels(cfg.BarkTokens)
+	for _, c := range cfg.Channels {
+		var channel Channel
+		switch c.Type {
+		case config.ChannelBark:
+			channel = BarkChannel{Token: c.Token}
+		case config.ChannelTelegram:
+			channel = TelegramChannel{Token: c.Token, ChatID: c.ChatID}
+		case config.ChannelWeCom:
+			channel = WeComChannel{Webhook: c.Webhook}
+		case config.ChannelFeishu:
+			channel = FeishuChannel{Webhook: c.Webhook}
+		case config.ChannelEmail:
+			channel = EmailChannel{Host: c.SMTPHost, Port: c.SMTPPort, Username: c.Username, Password: c.Password, From: c.From, To: c.To}
+		default:
+			continue // rejected by config.Validate
+		}
+		if c.Format != "" {
+			channel = formatOverride{Channel: channel, format: c.Format}
+		}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// formatOverride lets the config pick a different report format for a channel.
+type formatOverride struct {
+	Channel
+	format string
+}
+
+func (c formatOverride) Format() string {
+	return c.format
+}
+
+// postJSON posts payload to url and checks the HTTP status.
+func postJSON(url string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+// TelegramChannel sends reports through a Telegram bot, with charts as photos.
+type TelegramChannel struct {
+	Token  string
+	ChatID string
+}
+
+func (c TelegramChannel) Name() string {
+	return "telegram " + c.ChatID
+}
+
+func (c TelegramChannel) Format() string {
+	return report.FormatText
+}
+
+func (c TelegramChannel) Send(title, body, group string, images []report.Image) error {
+	apiURL := "https://api.telegram.org/bot" + c.Token
+	sent := 0
+	if body != "" {
+		// Telegram 单条消息最多 4096 个字符
+		if runes := []rune(body); len(runes) > 4096 {
+			body = string(runes[:4096])
+		}
+		if _, err := postJSON(apiURL+"/sendMessage", map[string]string{"chat_id": c.ChatID, "text": body}); err != nil {
+			return fmt.Errorf("telegram sendMessage: %w", err)
+		}
+		sent++
+	}
+
+	for _, image := range images {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		_ = writer.WriteField("chat_id", c.ChatID)
+		_ = writer.WriteField("caption", image.Title)
+		part, err := writer.CreateFormFile("photo", image.Name)
+		if err != nil {
+			return partial(sent, err)
+		}
+		_, _ = part.Write(image.PNG)
+		_ = writer.Close()
+
+		resp, err := http.Post(apiURL+"/sendPhoto", writer.FormDataContentType(), &buf)
+		if err != nil {
+			return partial(sent, fmt.Errorf("telegram sendPhoto: %w", err))
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return partial(sent, fmt.Errorf("telegram sendPhoto failed with status %d: %s", resp.StatusCode, string(respBody)))
+		}
+		sent++
+	}
+	return nil
+}
+
+// WeComChannel sends reports to a WeCom (企业微信) group robot, with charts as image messages.
+type WeComChannel struct {
+	Webhook string
+}
+
+func (c WeComChannel) Name() string {
+	return "wecom ..." + getLast4Chars(c.Webhook)
+}
+
+func (c WeComChannel) Format() string {
+	return report.FormatMarkdown
+}
+
+func (c WeComChannel) Send(title, body, group string, images []report.Image) error {
+	sent := 0
+	if body != "" {
+		if err := c.post(map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": body},
+		}); err != nil {
+			return err
+		}
+		sent++
+	}
+	for _, image := range images {
+		sum := md5.Sum(image.PNG)
+		if err := c.post(map[string]interface{}{
+			"msgtype": "image",
+			"image": map[string]string{
+				"base64": base64.StdEncoding.EncodeToString(image.PNG),
+				"md5":    hex.EncodeToString(sum[:]),
+			},
+		}); err != nil {
+			return partial(sent, err)
+		}
+		sent++
+	}
+	return nil
+}
+
+// post sends one robot message; the robot API reports errors in errcode with status 200.
+func (c WeComChannel) post(payload map[string]interface{}) error {
+	body, err := postJSON(c.Webhook, payload)
+	if err != nil {
+		return fmt.Errorf("wecom robot: %w", err)
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("wecom robot error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// FeishuChannel sends reports to a Feishu (飞书) group robot. Custom robots cannot upload
+// images, so published charts are sent as links.
+type FeishuChannel struct {
+	Webhook string
+}
+
+func (c FeishuChannel) Name() string {
+	return "feishu ..." + getLast4Chars(c.Webhook)
+}
+
+func (c FeishuChannel) Format() string {
+	return report.FormatText
+}
+
+func (c FeishuChannel) Send(title, body, group string, images []report.Image) error {
+	var text strings.Builder
+	text.WriteString(body)
+	for _, image := range images {
+		if image.URL != "" {
+			text.WriteString(fmt.Sprintf("\n%s: %s", image.Title, image.URL))
+		}
+	}
+
+	respBody, err := postJSON(c.Webhook, map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": text.String()},
+	})
+	if err != nil {
+		return fmt.Errorf("feishu robot: %w", err)
+	}
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(respBody, &result); err == nil && result.Code != 0 {
+		return fmt.Errorf("feishu robot error %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"wywk/report"
+)
+
+// EmailChannel sends HTML reports over SMTP with charts as attachments.
+type EmailChannel struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (c EmailChannel) Name() string {
+	return "email " + strings.Join(c.To, ",")
+}
+
+func (c EmailChannel) Format() string {
+	return report.FormatHTML
+}
+
+func (c EmailChannel) Send(title, body, group string, images []report.Image) error {
+	var msg bytes.Buffer
+	writer := multipart.NewWriter(&msg)
+
+	header := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		c.From, strings.Join(c.To, ", "), mime.BEncoding.Encode("UTF-8", title), writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	writeBase64(part, []byte(body))
+
+	for _, image := range images {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", image.Name)},
+		})
+		if err != nil {
+			return err
+		}
+		writeBase64(part, image.PNG)
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if c.Username != "" {
+		auth = smtp.PlainAuth("", c.Username, c.Password, c.Host)
+	}
+	addr := c.Host + ":" + strconv.Itoa(port)
+	if err := smtp.SendMail(addr, auth, c.From, c.To, append([]byte(header), msg.Bytes()...)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// writeBase64 writes data base64-encoded in 76 character lines, as MIME requires.
+func writeBase64(w interface{ Write([]byte) (int, error) }, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		_, _ = w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	_, _ = w.Write([]byte(encoded + "\r\n"))
+}
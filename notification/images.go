@@ -0,0 +1,100 @@
+package notification
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"wywk/report"
+)
+
+var (
+	imagesMu     sync.RWMutex
+	imageDir     = "charts"
+	imageBaseURL = ""
+)
+
+// UseImages sets where report images are published so that link-only channels such as
+// Bark can reference them: files go to dir and are linked below baseURL. Publishing is
+// disabled while baseURL is empty. `serve --addr` serves ImageDir under /charts/.
+func UseImages(dir, baseURL string) {
+	imagesMu.Lock()
+	imageDir, imageBaseURL = dir, baseURL
+	imagesMu.Unlock()
+}
+
+// ImageDir returns the directory set by UseImages.
+func ImageDir() string {
+	imagesMu.RLock()
+	defer imagesMu.RUnlock()
+	return imageDir
+}
+
+func imageURL() string {
+	imagesMu.RLock()
+	defer imagesMu.RUnlock()
+	return imageBaseURL
+}
+
+// publishImages writes the images of r to ImageDir and sets their URLs.
+func publishImages(r *report.Report) {
+	baseURL := imageURL()
+	if baseURL == "" {
+		return
+	}
+	prefix := time.Now().Format("20060102150405")
+	names := saveImages(r, ImageDir(), prefix)
+	for i := range r.Images {
+		if name, ok := names[i]; ok && r.Images[i].URL == "" {
+			r.Images[i].URL = strings.TrimRight(baseURL, "/") + "/" + url.PathEscape(name)
+		}
+	}
+}
+
+// SaveImages writes the images of r to ImageDir with the given file name prefix and
+// returns their paths.
+func SaveImages(r *report.Report, prefix string) []string {
+	dir := ImageDir()
+	var paths []string
+	for _, name := range saveImages(r, dir, prefix) {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// saveImages writes the images of r to dir and returns the file names written, keyed by image index.
+func saveImages(r *report.Report, dir, prefix string) map[int]string {
+	names := make(map[int]string)
+	if len(r.Images) == 0 {
+		return names
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Failed to create image directory %s: %v", dir, err)
+		return names
+	}
+	for i, image := range r.Images {
+		name := fmt.Sprintf("%s-%s-%s", prefix, safeFileName(r.Group), image.Name)
+		if err := os.WriteFile(filepath.Join(dir, name), image.PNG, 0o644); err != nil {
+			log.Printf("Failed to save image %s: %v", name, err)
+			continue
+		}
+		names[i] = name
+	}
+	return names
+}
+
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' || r == '?' || r == '#' || r == '%' {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+
+	"wywk/report"
 )
 
 func sendBarkNotification_get(barkBaseURL, message, shopName string) error {
@@ -36,19 +38,25 @@ func sendBarkNotification_get(barkBaseURL, message, shopName string) error {
 	return nil
 }
 
-func sendBarkNotification(barkBaseURL, message, shopName string) error {
+func sendBarkNotification(barkBaseURL, title, message, shopName, imageURL string) error {
 	// Ensure barkBaseURL has a scheme
 	if !strings.Contains(barkBaseURL, "://") {
 		barkBaseURL = "https://api.day.app/" + barkBaseURL
 	}
 	barkBaseURL = strings.TrimRight(barkBaseURL, "/")
 
-	// Bark POST JSON 格式
+	// Bark POST JSON 格式，没有标题时用分组名
+	if title == "" {
+		title = shopName
+	}
 	payload := map[string]string{
-		"title": shopName,
+		"title": title,
 		"body":  message,
 		"group": shopName, // 用 shopName 分组
 	}
+	if imageURL != "" {
+		payload["image"] = imageURL
+	}
 
 	data, err := json.Marshal(payload)
 	if err != nil {
@@ -70,21 +78,98 @@ func sendBarkNotification(barkBaseURL, message, shopName string) error {
 	return nil
 }
 
-func SendBarkNotifications(barkTokens []string, message, shopName string) {
-	if len(barkTokens) == 0 {
-		log.Println("No Bark tokens configured. Skipping notification.")
-		return
+func getLast4Chars(s string) string {
+	if len(s) > 4 {
+		return s[len(s)-4:]
 	}
-	for _, token := range barkTokens {
-		if err := sendBarkNotification(token, message, shopName); err != nil {
-			log.Printf("Failed to send Bark notification to token ending in ...%s for shop %s: %v", getLast4Chars(token), shopName, err)
+	return s
+}
+
+// Channel is a notification destination that accepts reports in one format.
+type Channel interface {
+	Name() string
+	Format() string // one of the report.Format* constants
+	// Send delivers a rendered report. Channels that cannot attach images may link
+	// to their URL instead, or ignore them. Channels that send the body and images as
+	// separate messages skip an empty body and return a *PartialError when some of them
+	// went out, so that a retry sends only the rest.
+	Send(title, body, group string, images []report.Image) error
+}
+
+// PartialError is a failed send of which the first Sent parts were delivered: the body,
+// unless it was empty, and then the images in order.
+type PartialError struct {
+	Sent int
+	Err  error
+}
+
+func (e *PartialError) Error() string { return e.Err.Error() }
+
+func (e *PartialError) Unwrap() error { return e.Err }
+
+// partial returns err as a *PartialError when sent parts were delivered before it.
+func partial(sent int, err error) error {
+	if sent == 0 {
+		return err
+	}
+	return &PartialError{Sent: sent, Err: err}
+}
+
+// BarkChannel sends plain-text reports to one Bark device.
+type BarkChannel struct {
+	Token string
+}
+
+func (c BarkChannel) Name() string {
+	return "bark ..." + getLast4Chars(c.Token)
+}
+
+func (c BarkChannel) Format() string {
+	return report.FormatText
+}
+
+// Send uses the first published image for Bark's image field, since Bark can only show one.
+func (c BarkChannel) Send(title, body, group string, images []report.Image) error {
+	imageURL := ""
+	for _, image := range images {
+		if image.URL != "" {
+			imageURL = image.URL
+			break
 		}
 	}
+	return sendBarkNotification(c.Token, title, body, group, imageURL)
 }
 
-func getLast4Chars(s string) string {
-	if len(s) > 4 {
-		return s[len(s)-4:]
+// BarkChannels wraps every Bark token in a channel.
+func BarkChannels(barkTokens []string) []Channel {
+	var channels []Channel
+	for _, token := range barkTokens {
+		channels = append(channels, BarkChannel{Token: token})
+	}
+	return channels
+}
+
+// SendReport renders r in the format of each channel and sends it.
+func SendReport(channels []Channel, r *report.Report) {
+	if len(channels) == 0 {
+		log.Println("No notification channels configured. Skipping notification.")
+		return
+	}
+	publishImages(r)
+
+	rendered := make(map[string]string)
+	for _, channel := range channels {
+		body, ok := rendered[channel.Format()]
+		if !ok {
+			var err error
+			if body, err = report.Render(channel.Format(), r); err != nil {
+				log.Printf("Failed to render report for %s: %v", channel.Name(), err)
+				continue
+			}
+			rendered[channel.Format()] = body
+		}
+		if err := deliver(channel, r.Title, body, r.Group, r.Images); err != nil {
+			log.Printf("Failed to send report to %s for shop %s: %v", channel.Name(), r.Group, err)
+		}
 	}
-	return s
 }
@@ -0,0 +1,49 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wywk/report"
+)
+
+func TestBarkChannelSend(t *testing.T) {
+	var payloads []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+	channel := BarkChannel{Token: server.URL}
+
+	images := []report.Image{{Name: "a.png"}, {Name: "b.png", URL: "http://example.com/b.png"}}
+	if err := channel.Send("【日报】门店A", "正文", "门店A", images); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := channel.Send("", "正文", "门店A", nil); err != nil {
+		t.Fatalf("Send without title: %v", err)
+	}
+
+	want := []map[string]string{
+		{"title": "【日报】门店A", "body": "正文", "group": "门店A", "image": "http://example.com/b.png"},
+		{"title": "门店A", "body": "正文", "group": "门店A"},
+	}
+	if len(payloads) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(payloads), len(want))
+	}
+	for i := range want {
+		for key, value := range want[i] {
+			if payloads[i][key] != value {
+				t.Errorf("request %d: %s = %q, want %q", i, key, payloads[i][key], value)
+			}
+		}
+		if len(payloads[i]) != len(want[i]) {
+			t.Errorf("request %d: payload %v, want %v", i, payloads[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/config"
+	"wywk/models"
+	"wywk/report"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+
+	// maxAttempts gives up on a notification after about two hours of retries: the waits
+	// between its attempts add up to 1+2+...+64 = 127 minutes.
+	maxAttempts = 8
+	retryBase   = time.Minute
+	retryMax    = 6 * time.Hour
+	// sendLease is how long a send may take before RetryOutbox treats it as lost, such as when
+	// the process exited during the send, and tries again. Well above retryBase, so that a slow
+	// email or a Bark message with many images is not sent twice.
+	sendLease = 30 * time.Minute
+	// outboxKeepDays is how long delivered notifications stay listed.
+	outboxKeepDays = 30
+)
+
+var (
+	// outbox stores notifications before they are sent; nil sends them once without a record.
+	outbox *gorm.DB
+	// retryMu keeps RetryOutbox from running twice at once and sending a notification twice.
+	retryMu sync.Mutex
+
+	channelsMu sync.Mutex
+	// channels resolves the recipients of stored notifications: the configured channels and
+	// any other channel used since the process started.
+	channels = make(map[string]Channel)
+)
+
+// UseOutbox keeps notifications in db until they are delivered, so failed sends are retried,
+// along with the queues of the alert dispatcher.
+func UseOutbox(db *gorm.DB) {
+	outbox = db
+	alerts.UseDB(db)
+}
+
+// Configure applies cfg to the alert dispatcher and registers its channels for retries.
+func Configure(cfg *config.Config) {
+	alerts.Configure(cfg)
+	for _, channel := range ChannelsFromConfig(cfg) {
+		rememberChannel(channel)
+	}
+}
+
+func rememberChannel(channel Channel) string {
+	id := recipientID(channel)
+	channelsMu.Lock()
+	channels[id] = channel
+	channelsMu.Unlock()
+	return id
+}
+
+func lookupChannel(id string) Channel {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	return channels[id]
+}
+
+// backoff is the wait before the next attempt after attempts failed ones.
+func backoff(attempts int) time.Duration {
+	if attempts > 20 {
+		return retryMax
+	}
+	return min(retryBase<<(attempts-1), retryMax)
+}
+
+// outboxImage keeps the chart itself, which report.Image leaves out of JSON.
+type outboxImage struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+	PNG   []byte `json:"png,omitempty"`
+}
+
+func encodeImages(images []report.Image) string {
+	if len(images) == 0 {
+		return ""
+	}
+	stored := make([]outboxImage, len(images))
+	for i, image := range images {
+		stored[i] = outboxImage{Name: image.Name, Title: image.Title, URL: image.URL, PNG: image.PNG}
+	}
+	data, _ := json.Marshal(stored)
+	return string(data)
+}
+
+func decodeImages(data string) []report.Image {
+	var stored []outboxImage
+	if data == "" || json.Unmarshal([]byte(data), &stored) != nil {
+		return nil
+	}
+	images := make([]report.Image, len(stored))
+	for i, image := range stored {
+		images[i] = report.Image{Name: image.Name, Title: image.Title, URL: image.URL, PNG: image.PNG}
+	}
+	return images
+}
+
+// deliver sends a rendered notification through channel. With an outbox it is stored first
+// and retried with exponential backoff if the send fails.
+func deliver(channel Channel, title, body, group string, images []report.Image) error {
+	id := rememberChannel(channel)
+	if outbox == nil {
+		return channel.Send(title, body, group, images)
+	}
+	now := time.Now().UTC()
+	// 先记录再发送；发送期间 NextAttemptAt 推后 sendLease，仅在发送中途进程退出时才会重试
+	msg := models.OutboxMessage{
+		Recipient:     id,
+		ChannelName:   channel.Name(),
+		Title:         title,
+		Body:          body,
+		GroupName:     group,
+		Images:        encodeImages(images),
+		Status:        OutboxPending,
+		NextAttemptAt: now.Add(sendLease),
+		CreatedAt:     now,
+	}
+	if err := outbox.Create(&msg).Error; err != nil {
+		log.Printf("Failed to store notification for %s, sending without retries: %v", channel.Name(), err)
+		return channel.Send(title, body, group, images)
+	}
+	return attempt(channel, &msg)
+}
+
+// attempt sends msg once, without the parts an earlier attempt delivered, and records the outcome.
+func attempt(channel Channel, msg *models.OutboxMessage) error {
+	body, images := msg.Body, decodeImages(msg.Images)
+	skip := msg.PartsSent
+	if skip > 0 && body != "" {
+		body = ""
+		skip--
+	}
+	images = images[min(skip, len(images)):]
+
+	err := channel.Send(msg.Title, body, msg.GroupName, images)
+	var partial *PartialError
+	if errors.As(err, &partial) {
+		msg.PartsSent += partial.Sent
+	}
+	now := time.Now().UTC()
+	msg.Attempts++
+	if err == nil {
+		msg.Status = OutboxSent
+		msg.SentAt = &now
+		msg.LastError = ""
+	} else {
+		msg.LastError = err.Error()
+		if msg.Attempts >= maxAttempts {
+			msg.Status = OutboxFailed
+		} else {
+			msg.NextAttemptAt = now.Add(backoff(msg.Attempts))
+		}
+	}
+	if saveErr := outbox.Save(msg).Error; saveErr != nil {
+		log.Printf("Failed to update notification %d: %v", msg.ID, saveErr)
+	}
+	return err
+}
+
+// RetryOutbox retries the pending notifications that are due and forgets delivered ones
+// after outboxKeepDays.
+func RetryOutbox() {
+	if outbox == nil {
+		return
+	}
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	now := time.Now().UTC()
+	var due []models.OutboxMessage
+	if err := outbox.Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).Order("id").Find(&due).Error; err != nil {
+		log.Printf("Failed to load pending notifications: %v", err)
+		return
+	}
+	for i := range due {
+		_ = retry(&due[i]) // logged by retry
+	}
+
+	cutoff := now.AddDate(0, 0, -outboxKeepDays)
+	if err := outbox.Where("status = ? AND sent_at < ?", OutboxSent, cutoff).Delete(&models.OutboxMessage{}).Error; err != nil {
+		log.Printf("Failed to prune delivered notifications: %v", err)
+	}
+}
+
+// RunOutbox retries due notifications every retryBase until stop is closed, so that their
+// backoff is kept between crawls.
+func RunOutbox(stop <-chan struct{}) {
+	ticker := time.NewTicker(retryBase)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			RetryOutbox()
+		}
+	}
+}
+
+func retry(msg *models.OutboxMessage) error {
+	channel := lookupChannel(msg.Recipient)
+	if channel == nil {
+		msg.Status = OutboxFailed
+		msg.LastError = "channel is no longer configured"
+		if err := outbox.Save(msg).Error; err != nil {
+			log.Printf("Failed to update notification %d: %v", msg.ID, err)
+		}
+		return fmt.Errorf("notification %d: %s", msg.ID, msg.LastError)
+	}
+	// 发送前先占用，避免另一个进程的 RetryOutbox 同时发送
+	msg.NextAttemptAt = time.Now().UTC().Add(sendLease)
+	if err := outbox.Model(msg).Update("next_attempt_at", msg.NextAttemptAt).Error; err != nil {
+		log.Printf("Failed to update notification %d: %v", msg.ID, err)
+	}
+	if err := attempt(channel, msg); err != nil {
+		log.Printf("Attempt %d of notification %d to %s failed: %v", msg.Attempts, msg.ID, msg.ChannelName, err)
+		return err
+	}
+	log.Printf("Notification %d delivered to %s after %d attempts", msg.ID, msg.ChannelName, msg.Attempts)
+	return nil
+}
+
+// ListOutbox returns the latest notifications with status, or of any status if it is empty.
+func ListOutbox(db *gorm.DB, status string, limit int) ([]models.OutboxMessage, error) {
+	query := db.Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var messages []models.OutboxMessage
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return messages, nil
+}
+
+// Resend sends the notifications with ids again right away, whatever their status. Failed
+// ones that fail again get a fresh round of retries. Sent and failed ones are sent in full;
+// pending ones skip the parts that already went out.
+func Resend(ids []uint) error {
+	if outbox == nil {
+		return fmt.Errorf("no notification outbox")
+	}
+	var messages []models.OutboxMessage
+	if err := outbox.Where("id IN ?", ids).Order("id").Find(&messages).Error; err != nil {
+		return fmt.Errorf("failed to load notifications: %w", err)
+	}
+	if len(messages) != len(ids) {
+		return fmt.Errorf("found %d of %d notifications", len(messages), len(ids))
+	}
+	failed := 0
+	for i := range messages {
+		if messages[i].Status != OutboxPending {
+			messages[i].PartsSent = 0
+		}
+		messages[i].Status = OutboxPending
+		messages[i].Attempts = 0
+		if err := retry(&messages[i]); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d notifications failed again and will be retried", failed, len(messages))
+	}
+	return nil
+}
+
+// OutboxReport lists notifications as a table.
+func OutboxReport(messages []models.OutboxMessage, loc *time.Location) *report.Report {
+	r := &report.Report{Title: "通知发送记录"}
+	table := &report.Table{Columns: []string{"ID", "创建", "渠道", "标题", "状态", "次数", "下次重试", "错误"}}
+	for _, m := range messages {
+		next := "-"
+		if m.Status == OutboxPending {
+			next = m.NextAttemptAt.In(loc).Format("01-02 15:04")
+		}
+		title := m.Title
+		if title == "" {
+			title = m.GroupName
+		}
+		table.Rows = append(table.Rows, []string{
+			strconv.FormatUint(uint64(m.ID), 10), m.CreatedAt.In(loc).Format("01-02 15:04"), m.ChannelName,
+			title, statusNames[m.Status], strconv.Itoa(m.Attempts), next, m.LastError,
+		})
+	}
+	r.AddSection("").Table = table
+	return r
+}
+
+var statusNames = map[string]string{
+	OutboxPending: "待重试",
+	OutboxSent:    "已发送",
+	OutboxFailed:  "失败",
+}
@@ -0,0 +1,200 @@
+package notification
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"wywk/models"
+	"wywk/report"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, 64 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, retryMax},
+		{20, retryMax},
+		{100, retryMax},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+
+	// 注释里说的约两小时：放弃前各次重试之间的等待
+	var total time.Duration
+	for attempts := 1; attempts < maxAttempts; attempts++ {
+		total += backoff(attempts)
+	}
+	if total != 127*time.Minute {
+		t.Errorf("waits before giving up add up to %v, want 127m", total)
+	}
+}
+
+func TestOutboxAttempts(t *testing.T) {
+	defer func() { outbox = nil }()
+	outbox = openTestDB(t)
+
+	images := []report.Image{{Name: "a.png"}, {Name: "b.png"}, {Name: "c.png"}}
+	failure := errors.New("gateway timeout")
+	tests := []struct {
+		name     string
+		body     string
+		errs     []error
+		attempts int
+		want     []sentMessage // what each attempt sent
+		status   string
+	}{
+		{
+			name:     "sent at once",
+			body:     "正文",
+			attempts: 1,
+			want:     []sentMessage{{"标题", "正文", 3}},
+			status:   OutboxSent,
+		},
+		{
+			name:     "retried in full",
+			body:     "正文",
+			errs:     []error{failure},
+			attempts: 2,
+			want:     []sentMessage{{"标题", "正文", 3}, {"标题", "正文", 3}},
+			status:   OutboxSent,
+		},
+		{
+			name:     "retry skips the delivered body and image",
+			body:     "正文",
+			errs:     []error{partial(2, failure)},
+			attempts: 2,
+			want:     []sentMessage{{"标题", "正文", 3}, {"标题", "", 2}},
+			status:   OutboxSent,
+		},
+		{
+			name:     "partial sends add up",
+			body:     "正文",
+			errs:     []error{partial(1, failure), partial(1, failure)},
+			attempts: 3,
+			want:     []sentMessage{{"标题", "正文", 3}, {"标题", "", 3}, {"标题", "", 2}},
+			status:   OutboxSent,
+		},
+		{
+			name:     "images only",
+			errs:     []error{partial(2, failure)},
+			attempts: 2,
+			want:     []sentMessage{{"标题", "", 3}, {"标题", "", 1}},
+			status:   OutboxSent,
+		},
+		{
+			name:     "gives up after maxAttempts",
+			body:     "正文",
+			errs:     []error{failure, failure, failure},
+			attempts: 3,
+			want:     []sentMessage{{"标题", "正文", 3}, {"标题", "正文", 3}, {"标题", "正文", 3}},
+			status:   OutboxFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newFakeChannel(tt.name)
+			*channel.errs = append(*channel.errs, tt.errs...)
+			msg := &models.OutboxMessage{
+				Recipient: rememberChannel(channel), ChannelName: channel.Name(), Title: "标题", Body: tt.body,
+				Images: encodeImages(images), Status: OutboxPending,
+			}
+			if tt.status == OutboxFailed {
+				msg.Attempts = maxAttempts - tt.attempts
+			}
+			if err := outbox.Create(msg).Error; err != nil {
+				t.Fatalf("failed to store message: %v", err)
+			}
+			err := attempt(channel, msg)
+			for i := 1; err != nil && i < tt.attempts; i++ {
+				err = retry(msg)
+			}
+
+			var stored models.OutboxMessage
+			if err := outbox.First(&stored, msg.ID).Error; err != nil {
+				t.Fatalf("failed to load message: %v", err)
+			}
+			if stored.Status != tt.status {
+				t.Errorf("status = %s, want %s", stored.Status, tt.status)
+			}
+			if len(*channel.log) != len(tt.want) {
+				t.Fatalf("sent %+v, want %+v", *channel.log, tt.want)
+			}
+			for i, m := range *channel.log {
+				if m != tt.want[i] {
+					t.Errorf("attempt %d sent %+v, want %+v", i+1, m, tt.want[i])
+				}
+			}
+			if tt.status == OutboxSent && stored.LastError != "" {
+				t.Errorf("LastError = %q after delivery", stored.LastError)
+			}
+		})
+	}
+}
+
+func TestOutboxSendIsNotRetriedWhileInProgress(t *testing.T) {
+	defer func() { outbox = nil }()
+	outbox = openTestDB(t)
+
+	channel := newFakeChannel("slow")
+	channel.during = func() {
+		// 发送中途：这一行不能在接下来几次 RunOutbox 的间隔内到期
+		var msg models.OutboxMessage
+		if err := outbox.First(&msg).Error; err != nil {
+			t.Fatalf("failed to load message: %v", err)
+		}
+		if due := time.Until(msg.NextAttemptAt); due < 10*retryBase {
+			t.Errorf("message in flight is due for a retry in %v", due)
+		}
+		RetryOutbox()
+	}
+	if err := deliver(channel, "标题", "正文", "", nil); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if len(*channel.log) != 1 {
+		t.Errorf("sent %d times, want once", len(*channel.log))
+	}
+}
+
+func TestResend(t *testing.T) {
+	defer func() { outbox = nil }()
+	outbox = openTestDB(t)
+
+	images := encodeImages([]report.Image{{Name: "a.png"}, {Name: "b.png"}})
+	tests := []struct {
+		name   string
+		status string
+		want   sentMessage
+	}{
+		{"pending skips delivered parts", OutboxPending, sentMessage{"标题", "", 1}},
+		{"sent is sent in full", OutboxSent, sentMessage{"标题", "正文", 2}},
+		{"failed is sent in full", OutboxFailed, sentMessage{"标题", "正文", 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newFakeChannel(tt.name)
+			msg := &models.OutboxMessage{
+				Recipient: rememberChannel(channel), ChannelName: channel.Name(), Title: "标题", Body: "正文",
+				Images: images, Status: tt.status, Attempts: 3, PartsSent: 2,
+			}
+			if err := outbox.Create(msg).Error; err != nil {
+				t.Fatalf("failed to store message: %v", err)
+			}
+			if err := Resend([]uint{msg.ID}); err != nil {
+				t.Fatalf("Resend: %v", err)
+			}
+			if len(*channel.log) != 1 || (*channel.log)[0] != tt.want {
+				t.Errorf("sent %+v, want %+v", *channel.log, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// HTMLRenderer renders an HTML fragment suitable for email bodies.
+type HTMLRenderer struct{}
+
+func (HTMLRenderer) Render(r *Report) (string, error) {
+	var b strings.Builder
+	if r.Title != "" {
+		b.WriteString(fmt.Sprintf("<h2>%s</h2>\n", html.EscapeString(r.Title)))
+	}
+	for _, section := range r.Sections {
+		if section.Title != "" {
+			b.WriteString(fmt.Sprintf("<h3>%s</h3>\n", html.EscapeString(section.Title)))
+		}
+		if len(section.Metrics) > 0 {
+			b.WriteString("<ul>\n")
+			for _, metric := range section.Metrics {
+				b.WriteString(fmt.Sprintf("<li><b>%s</b>: %s</li>\n", html.EscapeString(metric.Name), html.EscapeString(metric.Value)))
+			}
+			b.WriteString("</ul>\n")
+		}
+		for _, line := range section.Lines {
+			b.WriteString(fmt.Sprintf("<p>%s</p>\n", html.EscapeString(line)))
+		}
+		if section.Table != nil {
+			b.WriteString("<table border=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n<tr>")
+			for _, column := range section.Table.Columns {
+				b.WriteString("<th>" + html.EscapeString(column) + "</th>")
+			}
+			b.WriteString("</tr>\n")
+			for _, row := range section.Table.Rows {
+				b.WriteString("<tr>")
+				for _, cell := range row {
+					b.WriteString("<td>" + html.EscapeString(cell) + "</td>")
+				}
+				b.WriteString("</tr>\n")
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,14 @@
+package report
+
+import "encoding/json"
+
+// JSONRenderer renders the report structure as indented JSON, for webhooks and scripts.
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(r *Report) (string, error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,39 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MarkdownRenderer renders GitHub-flavored Markdown.
+type MarkdownRenderer struct{}
+
+func (MarkdownRenderer) Render(r *Report) (string, error) {
+	var b strings.Builder
+	if r.Title != "" {
+		b.WriteString(fmt.Sprintf("## %s\n\n", r.Title))
+	}
+	for _, section := range r.Sections {
+		if section.Title != "" {
+			b.WriteString(fmt.Sprintf("### %s\n\n", section.Title))
+		}
+		for _, metric := range section.Metrics {
+			b.WriteString(fmt.Sprintf("- **%s**: %s\n", metric.Name, metric.Value))
+		}
+		if len(section.Metrics) > 0 {
+			b.WriteString("\n")
+		}
+		for _, line := range section.Lines {
+			b.WriteString(line + "\n\n")
+		}
+		if section.Table != nil {
+			b.WriteString("| " + strings.Join(section.Table.Columns, " | ") + " |\n")
+			b.WriteString("|" + strings.Repeat(" --- |", len(section.Table.Columns)) + "\n")
+			for _, row := range section.Table.Rows {
+				b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+			}
+			b.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
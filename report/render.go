@@ -0,0 +1,127 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+)
+
+// Renderer turns a Report into the text sent to a notification channel.
+type Renderer interface {
+	Render(r *Report) (string, error)
+}
+
+var renderers = map[string]Renderer{}
+
+// Register makes a renderer available under format, replacing any existing one.
+func Register(format string, renderer Renderer) {
+	renderers[format] = renderer
+}
+
+// Render renders r with its template for format if there is one, otherwise with the
+// renderer registered for format.
+func Render(format string, r *Report) (string, error) {
+	if text, ok, err := renderTemplate(format, r); ok {
+		return text, err
+	}
+	renderer, ok := renderers[format]
+	if !ok {
+		return "", fmt.Errorf("unknown report format %q, want one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return renderer.Render(r)
+}
+
+// Formats lists the registered formats.
+func Formats() []string {
+	var formats []string
+	for format := range renderers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+func init() {
+	Register(FormatText, TextRenderer{})
+	Register(FormatMarkdown, MarkdownRenderer{})
+	Register(FormatHTML, HTMLRenderer{})
+	Register(FormatJSON, JSONRenderer{})
+}
+
+// TextRenderer renders plain text suitable for Bark and other push services.
+type TextRenderer struct{}
+
+func (TextRenderer) Render(r *Report) (string, error) {
+	var b strings.Builder
+	if r.Title != "" {
+		b.WriteString(r.Title + "\n")
+	}
+	for i, section := range r.Sections {
+		if section.Title != "" {
+			if i > 0 || r.Title != "" {
+				b.WriteString("\n")
+			}
+			b.WriteString(fmt.Sprintf("--- %s ---\n", section.Title))
+		}
+		for _, metric := range section.Metrics {
+			b.WriteString(fmt.Sprintf("%s: %s\n", metric.Name, metric.Value))
+		}
+		for _, line := range section.Lines {
+			b.WriteString(line + "\n")
+		}
+		if section.Table != nil {
+			writeTextTable(&b, section.Table)
+		}
+	}
+	return b.String(), nil
+}
+
+func writeTextTable(b *strings.Builder, table *Table) {
+	widths := make([]int, len(table.Columns))
+	for i, column := range table.Columns {
+		widths[i] = displayWidth(column)
+	}
+	for _, row := range table.Rows {
+		for i, cell := range row {
+			if i < len(widths) && displayWidth(cell) > widths[i] {
+				widths[i] = displayWidth(cell)
+			}
+		}
+	}
+
+	writeRow := func(cells []string) {
+		b.WriteString("║")
+		for i, cell := range cells {
+			padding := 0
+			if i < len(widths) {
+				padding = widths[i] - displayWidth(cell)
+			}
+			b.WriteString(" " + strings.Repeat(" ", padding) + cell + " ║")
+		}
+		b.WriteString("\n")
+	}
+	writeRow(table.Columns)
+	for _, row := range table.Rows {
+		writeRow(row)
+	}
+}
+
+// displayWidth approximates the width of s in a monospace font, counting CJK characters as two columns.
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
@@ -0,0 +1,53 @@
+package report
+
+// Report is a structured report produced by a builder and turned into text by a Renderer,
+// so that every notification channel can get a format it supports.
+type Report struct {
+	Title    string    `json:"title"`
+	Group    string    `json:"group,omitempty"` // 通知分组，一般为店名
+	Sections []Section `json:"sections"`
+	Images   []Image   `json:"images,omitempty"`
+
+	// Template names the user-editable templates (<Template>.<format>.tmpl) used instead of
+	// the generic renderers, and Data is the raw data those templates can access.
+	Template string      `json:"-"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// Section is a titled block of metrics, free-form lines and an optional table.
+type Section struct {
+	Title   string   `json:"title,omitempty"`
+	Metrics []Metric `json:"metrics,omitempty"`
+	Lines   []string `json:"lines,omitempty"`
+	Table   *Table   `json:"table,omitempty"`
+}
+
+// Metric is a single named value, already formatted for display.
+type Metric struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Image is a chart attached to the report. URL is set once the image has been
+// published somewhere reachable, for channels that can only link to images.
+type Image struct {
+	Name  string `json:"name"` // file name, e.g. "hourly.png"
+	Title string `json:"title"`
+	PNG   []byte `json:"-"`
+	URL   string `json:"url,omitempty"`
+}
+
+type Table struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// AddSection appends a section and returns it for further filling.
+func (r *Report) AddSection(title string) *Section {
+	r.Sections = append(r.Sections, Section{Title: title})
+	return &r.Sections[len(r.Sections)-1]
+}
+
+func (s *Section) AddMetric(name, value string) {
+	s.Metrics = append(s.Metrics, Metric{Name: name, Value: value})
+}
@@ -0,0 +1,111 @@
+package report
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sample() *Report {
+	r := &Report{Title: "日报", Group: "A"}
+	summary := r.AddSection("概览")
+	summary.AddMetric("使用率", "50%")
+	summary.Lines = []string{"<备注>"}
+	r.AddSection("").Table = &Table{Columns: []string{"房间", "台数"}, Rows: [][]string{{"大厅", "10"}, {"VIP", "2"}}}
+	return r
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatText, "日报\n\n--- 概览 ---\n使用率: 50%\n<备注>\n║ 房间 ║ 台数 ║\n║ 大厅 ║   10 ║\n║  VIP ║    2 ║\n"},
+		{FormatMarkdown, "## 日报\n\n### 概览\n\n- **使用率**: 50%\n\n<备注>\n\n| 房间 | 台数 |\n| --- | --- |\n| 大厅 | 10 |\n| VIP | 2 |\n"},
+		{FormatHTML, "<h2>日报</h2>\n<h3>概览</h3>\n<ul>\n<li><b>使用率</b>: 50%</li>\n</ul>\n<p>&lt;备注&gt;</p>\n" +
+			"<table border=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n<tr><th>房间</th><th>台数</th></tr>\n<tr><td>大厅</td><td>10</td></tr>\n<tr><td>VIP</td><td>2</td></tr>\n</table>\n"},
+	}
+	for _, tt := range tests {
+		got, err := Render(tt.format, sample())
+		if err != nil || got != tt.want {
+			t.Errorf("Render(%s) = %q, %v, want %q", tt.format, got, err, tt.want)
+		}
+	}
+
+	text, err := Render(FormatJSON, sample())
+	var decoded Report
+	if err != nil || json.Unmarshal([]byte(text), &decoded) != nil || decoded.Sections[1].Table.Rows[1][0] != "VIP" {
+		t.Errorf("Render(json) = %s, %v", text, err)
+	}
+	if _, err := Render("pdf", sample()); err == nil {
+		t.Error("Render of an unknown format succeeded")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	defer LoadTemplates("")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "custom.text.tmpl"), []byte(`{{.Title}} {{pct .Data}} {{bar .Data 4}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "custom.html.tmpl"), []byte(`<b>{{.Title}}</b>`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTemplates(dir); err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	r := &Report{Title: "<A>", Template: "custom", Data: 50.0}
+	if got, err := Render(FormatText, r); err != nil || got != "<A> 50.00% ██░░" {
+		t.Errorf("text template = %q, %v", got, err)
+	}
+	// html 模板会转义内容
+	if got, err := Render(FormatHTML, r); err != nil || got != "<b>&lt;A&gt;</b>" {
+		t.Errorf("html template = %q, %v", got, err)
+	}
+	// 没有对应格式的模板时使用通用渲染
+	if got, err := Render(FormatMarkdown, r); err != nil || got != "## <A>\n" {
+		t.Errorf("markdown without template = %q, %v", got, err)
+	}
+
+	// 解析失败时保留原来的模板
+	if err := os.WriteFile(filepath.Join(dir, "broken.text.tmpl"), []byte(`{{.Title`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadTemplates(dir); err == nil {
+		t.Fatal("LoadTemplates with a broken template succeeded")
+	}
+	if got, _ := Render(FormatText, r); !strings.HasPrefix(got, "<A> ") {
+		t.Errorf("templates replaced after a failed load: %q", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		minutes float64
+		want    string
+	}{
+		{0, "0分"}, {59.6, "1小时"}, {45, "45分"}, {120, "2小时"}, {150, "2小时30分"},
+	}
+	for _, tt := range tests {
+		if got := Duration(tt.minutes); got != tt.want {
+			t.Errorf("Duration(%v) = %q, want %q", tt.minutes, got, tt.want)
+		}
+	}
+}
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		percentage float64
+		want       string
+	}{
+		{-5, "░░░░"}, {25, "█░░░"}, {100, "████"}, {150, "████"},
+	}
+	for _, tt := range tests {
+		if got := Bar(tt.percentage, 4); got != tt.want {
+			t.Errorf("Bar(%v, 4) = %q, want %q", tt.percentage, got, tt.want)
+		}
+	}
+}
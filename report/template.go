@@ -0,0 +1,167 @@
+package report
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// Built-in templates, named <template>.<format>.tmpl. Files with the same name in the
+// configured template directory take precedence.
+//
+//go:embed templates/*.tmpl
+var defaultTemplates embed.FS
+
+// executor is implemented by both text/template and html/template templates.
+type executor interface {
+	Execute(w *bytes.Buffer, data interface{}) error
+}
+
+type textExecutor struct{ t *texttemplate.Template }
+
+func (e textExecutor) Execute(w *bytes.Buffer, data interface{}) error { return e.t.Execute(w, data) }
+
+type htmlExecutor struct{ t *htmltemplate.Template }
+
+func (e htmlExecutor) Execute(w *bytes.Buffer, data interface{}) error { return e.t.Execute(w, data) }
+
+var (
+	templatesMu sync.RWMutex
+	templates   = map[string]executor{}
+)
+
+var templateFuncs = map[string]interface{}{
+	"bar":      Bar,
+	"duration": Duration,
+	"pct":      func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+	"signed": func(v float64) string {
+		return fmt.Sprintf("%+.2f", v)
+	},
+	"sub":    func(a, b float64) float64 { return a - b },
+	"repeat": strings.Repeat,
+}
+
+func init() {
+	if err := LoadTemplates(""); err != nil {
+		log.Fatalf("Failed to parse built-in report templates: %v", err)
+	}
+}
+
+// LoadTemplates parses the built-in templates and then every *.tmpl file in dir, replacing
+// the active set only if all of them parse. An empty dir loads the built-in templates only.
+func LoadTemplates(dir string) error {
+	set, err := ParseTemplates(dir)
+	if err != nil {
+		return err
+	}
+	UseTemplates(set)
+	return nil
+}
+
+// TemplateSet is a parsed set of templates, made active by UseTemplates.
+type TemplateSet struct {
+	byName map[string]executor
+}
+
+// ParseTemplates parses the built-in templates and then every *.tmpl file in dir without
+// making them active, so that a config can be checked before anything is applied.
+func ParseTemplates(dir string) (*TemplateSet, error) {
+	loaded := map[string]executor{}
+	if err := parseTemplates(defaultTemplates, "templates", loaded); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := parseTemplates(os.DirFS(dir), ".", loaded); err != nil {
+			return nil, err
+		}
+	}
+	return &TemplateSet{byName: loaded}, nil
+}
+
+// UseTemplates makes set the active templates.
+func UseTemplates(set *TemplateSet) {
+	templatesMu.Lock()
+	templates = set.byName
+	templatesMu.Unlock()
+}
+
+func parseTemplates(fsys fs.FS, dir string, into map[string]executor) error {
+	paths, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.tmpl")))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %w", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		if strings.HasSuffix(name, "."+FormatHTML) {
+			t, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("failed to parse template %s: %w", path, err)
+			}
+			into[name] = htmlExecutor{t}
+		} else {
+			t, err := texttemplate.New(name).Funcs(templateFuncs).Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("failed to parse template %s: %w", path, err)
+			}
+			into[name] = textExecutor{t}
+		}
+	}
+	return nil
+}
+
+// renderTemplate renders r with the template for its Template name and format, if one exists.
+func renderTemplate(format string, r *Report) (string, bool, error) {
+	if r.Template == "" {
+		return "", false, nil
+	}
+	templatesMu.RLock()
+	t, ok := templates[r.Template+"."+format]
+	templatesMu.RUnlock()
+	if !ok {
+		return "", false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, r); err != nil {
+		return "", true, fmt.Errorf("failed to execute template %s.%s: %w", r.Template, format, err)
+	}
+	return buf.String(), true, nil
+}
+
+// Bar creates a simple text-based bar for a percentage.
+func Bar(percentage float64, barLength int) string {
+	if percentage < 0 {
+		percentage = 0
+	}
+	if percentage > 100 {
+		percentage = 100
+	}
+	filledLength := int(percentage / 100 * float64(barLength))
+	return strings.Repeat("█", filledLength) + strings.Repeat("░", barLength-filledLength)
+}
+
+// Duration formats minutes as hours and minutes, e.g. "2小时30分".
+func Duration(minutes float64) string {
+	m := int(math.Round(minutes))
+	switch {
+	case m < 60:
+		return fmt.Sprintf("%d分", m)
+	case m%60 == 0:
+		return fmt.Sprintf("%d小时", m/60)
+	default:
+		return fmt.Sprintf("%d小时%d分", m/60, m%60)
+	}
+}
@@ -0,0 +1,141 @@
+package rollup
+
+import (
+	"sync"
+	"time"
+
+	"wywk/models"
+)
+
+var (
+	mu            sync.RWMutex
+	crawlInterval = 10 * time.Minute
+)
+
+// SetCrawlInterval sets the expected time between two snapshots of a shop; set from the config.
+func SetCrawlInterval(d time.Duration) {
+	mu.Lock()
+	crawlInterval = d
+	mu.Unlock()
+}
+
+// CrawlInterval returns the interval set by SetCrawlInterval.
+func CrawlInterval() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	return crawlInterval
+}
+
+// PeakRate is the usage rate (in percent) at or above which a shop or room counts as at peak.
+const PeakRate = 90.0
+
+// MaxSpan caps how long one snapshot counts for, so values don't carry over gaps in the crawl.
+func MaxSpan() time.Duration {
+	return CrawlInterval() * 3 / 2
+}
+
+// Sample is one shop snapshot, or one room snapshot with its snapshot's timestamp.
+type Sample struct {
+	Timestamp    time.Time
+	TotalDevices int
+	UsedDevices  int
+	UsageRate    float64
+}
+
+// Spans returns how many minutes each sample stands for: until the next sample, or until
+// end for the last one, capped at MaxSpan. Samples must be ordered by time.
+func Spans(samples []Sample, end time.Time) []float64 {
+	spans := make([]float64, len(samples))
+	for i, s := range samples {
+		next := end
+		if i+1 < len(samples) {
+			next = samples[i+1].Timestamp
+		}
+		spans[i] = max(min(next.Sub(s.Timestamp), MaxSpan()), 0).Minutes()
+	}
+	return spans
+}
+
+// Aggregate accumulates statistics weighted by the time each sample, or each finer rollup,
+// covers, so that irregular polling does not skew the averages.
+type Aggregate struct {
+	Samples        int
+	Minutes        float64 // time covered by the samples
+	TotalDevices   int     // from the latest sample
+	MaxUsageRate   float64
+	MaxUsedDevices int
+	PeakMinutes    float64 // time spent at or above PeakRate
+
+	lastAt  time.Time
+	sumRate float64 // usage rate × minutes
+	sumUsed float64 // used devices × minutes
+}
+
+func (a *Aggregate) add(at time.Time, samples int, minutes float64, totalDevices int, avgRate, maxRate, avgUsed float64, maxUsed int, peakMinutes float64) {
+	if a.Samples == 0 || maxRate > a.MaxUsageRate {
+		a.MaxUsageRate = maxRate
+	}
+	if a.Samples == 0 || maxUsed > a.MaxUsedDevices {
+		a.MaxUsedDevices = maxUsed
+	}
+	if !at.Before(a.lastAt) {
+		a.lastAt = at
+		a.TotalDevices = totalDevices
+	}
+	a.Samples += samples
+	a.Minutes += minutes
+	a.PeakMinutes += peakMinutes
+	a.sumRate += avgRate * minutes
+	a.sumUsed += avgUsed * minutes
+}
+
+// AddSample adds a snapshot that stands for minutes, as returned by Spans.
+func (a *Aggregate) AddSample(s Sample, minutes float64) {
+	peak := 0.0
+	if s.UsageRate >= PeakRate {
+		peak = minutes
+	}
+	a.add(s.Timestamp, 1, minutes, s.TotalDevices, s.UsageRate, s.UsageRate, float64(s.UsedDevices), s.UsedDevices, peak)
+}
+
+// AddShopRollup adds a finer shop rollup.
+func (a *Aggregate) AddShopRollup(r models.ShopRollup) {
+	a.add(r.PeriodStart, r.Samples, r.Minutes, r.TotalDevices, r.AvgUsageRate, r.MaxUsageRate, r.AvgUsedDevices, r.MaxUsedDevices, r.PeakMinutes)
+}
+
+// AddRoomRollup adds a finer room rollup.
+func (a *Aggregate) AddRoomRollup(r models.RoomRollup) {
+	a.add(r.PeriodStart, r.Samples, r.Minutes, r.TotalDevices, r.AvgUsageRate, r.MaxUsageRate, r.AvgUsedDevices, r.MaxUsedDevices, r.PeakMinutes)
+}
+
+func (a *Aggregate) AvgUsageRate() float64 {
+	if a.Minutes == 0 {
+		return 0
+	}
+	return a.sumRate / a.Minutes
+}
+
+func (a *Aggregate) AvgUsedDevices() float64 {
+	if a.Minutes == 0 {
+		return 0
+	}
+	return a.sumUsed / a.Minutes
+}
+
+// DeviceHours is the occupied device time: used devices integrated over time, in hours.
+func (a *Aggregate) DeviceHours() float64 {
+	return a.sumUsed / 60
+}
+
+// Group aggregates samples by key, each weighted by its span up to end.
+func Group(samples []Sample, end time.Time, key func(Sample) string) map[string]*Aggregate {
+	groups := make(map[string]*Aggregate)
+	for i, minutes := range Spans(samples, end) {
+		k := key(samples[i])
+		if groups[k] == nil {
+			groups[k] = &Aggregate{}
+		}
+		groups[k].AddSample(samples[i], minutes)
+	}
+	return groups
+}
@@ -0,0 +1,184 @@
+package rollup
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"wywk/models"
+)
+
+var t0 = time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return t0.Add(time.Duration(minutes) * time.Minute)
+}
+
+func samplesAt(minutes ...int) []Sample {
+	samples := make([]Sample, len(minutes))
+	for i, m := range minutes {
+		samples[i] = Sample{Timestamp: at(m)}
+	}
+	return samples
+}
+
+func TestSpans(t *testing.T) {
+	defer SetCrawlInterval(CrawlInterval())
+	SetCrawlInterval(10 * time.Minute) // MaxSpan 15 分钟
+
+	tests := []struct {
+		name    string
+		samples []Sample
+		end     time.Time
+		want    []float64
+	}{
+		{"empty", nil, at(60), []float64{}},
+		{"regular", samplesAt(0, 10, 20), at(30), []float64{10, 10, 10}},
+		{"irregular", samplesAt(0, 3, 10), at(12), []float64{3, 7, 2}},
+		{"gap capped", samplesAt(0, 60), at(65), []float64{15, 5}},
+		{"last capped at end", samplesAt(0), at(60), []float64{15}},
+		{"end before last sample", samplesAt(0, 10), at(5), []float64{10, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Spans(tt.samples, tt.end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Spans() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Spans() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name         string
+		fill         func(a *Aggregate)
+		samples      int
+		minutes      float64
+		totalDevices int
+		avgRate      float64
+		maxRate      float64
+		avgUsed      float64
+		maxUsed      int
+		peakMinutes  float64
+		deviceHours  float64
+	}{
+		{
+			name: "empty",
+			fill: func(a *Aggregate) {},
+		},
+		{
+			name: "weighted by minutes",
+			fill: func(a *Aggregate) {
+				a.AddSample(Sample{Timestamp: at(0), TotalDevices: 10, UsedDevices: 2, UsageRate: 20}, 10)
+				a.AddSample(Sample{Timestamp: at(10), TotalDevices: 10, UsedDevices: 8, UsageRate: 80}, 30)
+			},
+			samples: 2, minutes: 40, totalDevices: 10,
+			avgRate: 65, maxRate: 80, avgUsed: 6.5, maxUsed: 8,
+			deviceHours: 260.0 / 60,
+		},
+		{
+			name: "peak and latest total",
+			fill: func(a *Aggregate) {
+				a.AddSample(Sample{Timestamp: at(10), TotalDevices: 12, UsedDevices: 11, UsageRate: 91.67}, 10)
+				// 先到的旧样本不覆盖最新的设备总数
+				a.AddSample(Sample{Timestamp: at(0), TotalDevices: 10, UsedDevices: 9, UsageRate: 90}, 10)
+			},
+			samples: 2, minutes: 20, totalDevices: 12,
+			avgRate: 90.835, maxRate: 91.67, avgUsed: 10, maxUsed: 11,
+			peakMinutes: 20, deviceHours: 200.0 / 60,
+		},
+		{
+			name: "max of zero usage",
+			fill: func(a *Aggregate) {
+				a.AddSample(Sample{Timestamp: at(0), TotalDevices: 10}, 10)
+			},
+			samples: 1, minutes: 10, totalDevices: 10,
+		},
+		{
+			name: "rollups",
+			fill: func(a *Aggregate) {
+				a.AddShopRollup(models.ShopRollup{PeriodStart: at(0), Samples: 6, Minutes: 60, TotalDevices: 10,
+					AvgUsageRate: 30, MaxUsageRate: 50, AvgUsedDevices: 3, MaxUsedDevices: 5, PeakMinutes: 0})
+				a.AddShopRollup(models.ShopRollup{PeriodStart: at(60), Samples: 3, Minutes: 30, TotalDevices: 20,
+					AvgUsageRate: 60, MaxUsageRate: 95, AvgUsedDevices: 12, MaxUsedDevices: 19, PeakMinutes: 10})
+			},
+			samples: 9, minutes: 90, totalDevices: 20,
+			avgRate: 40, maxRate: 95, avgUsed: 6, maxUsed: 19,
+			peakMinutes: 10, deviceHours: 9,
+		},
+		{
+			name: "room rollups",
+			fill: func(a *Aggregate) {
+				a.AddRoomRollup(models.RoomRollup{PeriodStart: at(0), Samples: 4, Minutes: 40, TotalDevices: 5,
+					AvgUsageRate: 40, MaxUsageRate: 60, AvgUsedDevices: 2, MaxUsedDevices: 3})
+			},
+			samples: 4, minutes: 40, totalDevices: 5,
+			avgRate: 40, maxRate: 60, avgUsed: 2, maxUsed: 3,
+			deviceHours: 80.0 / 60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Aggregate{}
+			tt.fill(a)
+			if a.Samples != tt.samples || a.Minutes != tt.minutes || a.TotalDevices != tt.totalDevices || a.MaxUsedDevices != tt.maxUsed {
+				t.Errorf("samples, minutes, total, max used = %d, %v, %d, %d, want %d, %v, %d, %d",
+					a.Samples, a.Minutes, a.TotalDevices, a.MaxUsedDevices, tt.samples, tt.minutes, tt.totalDevices, tt.maxUsed)
+			}
+			checks := []struct {
+				name      string
+				got, want float64
+			}{
+				{"AvgUsageRate", a.AvgUsageRate(), tt.avgRate},
+				{"MaxUsageRate", a.MaxUsageRate, tt.maxRate},
+				{"AvgUsedDevices", a.AvgUsedDevices(), tt.avgUsed},
+				{"PeakMinutes", a.PeakMinutes, tt.peakMinutes},
+				{"DeviceHours", a.DeviceHours(), tt.deviceHours},
+			}
+			for _, c := range checks {
+				if math.Abs(c.got-c.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	defer SetCrawlInterval(CrawlInterval())
+	SetCrawlInterval(10 * time.Minute)
+
+	samples := []Sample{
+		{Timestamp: at(40), UsedDevices: 1, UsageRate: 10},
+		{Timestamp: at(50), UsedDevices: 2, UsageRate: 20},
+		{Timestamp: at(60), UsedDevices: 3, UsageRate: 30},
+	}
+	groups := Group(samples, at(70), hourKey)
+	tests := []struct {
+		key     string
+		samples int
+		avgRate float64
+	}{
+		{hourKey(samples[0]), 2, 15},
+		{hourKey(samples[2]), 1, 30},
+	}
+	if len(groups) != len(tests) {
+		t.Fatalf("Group() returned %d groups, want %d", len(groups), len(tests))
+	}
+	for _, tt := range tests {
+		a := groups[tt.key]
+		if a == nil {
+			t.Errorf("group %s missing", tt.key)
+			continue
+		}
+		if a.Samples != tt.samples || a.AvgUsageRate() != tt.avgRate {
+			t.Errorf("group %s = %d samples at %v%%, want %d at %v%%", tt.key, a.Samples, a.AvgUsageRate(), tt.samples, tt.avgRate)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package rollup
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/models"
+)
+
+const (
+	Hour = "hour"
+	Day  = "day"
+)
+
+// Run rolls up every complete hour, and every complete day in loc, that has not been
+// rolled up yet. It is incremental and cheap to call after every crawl.
+func Run(db *gorm.DB, loc *time.Location) error {
+	var shops []models.Shop
+	if err := db.Find(&shops).Error; err != nil {
+		return fmt.Errorf("failed to list shops: %w", err)
+	}
+	until := time.Now().Truncate(time.Hour)
+	for _, shop := range shops {
+		if err := rollupShop(db, shop.ID, until, loc); err != nil {
+			return fmt.Errorf("failed to roll up shop %s: %w", shop.Name, err)
+		}
+	}
+	return nil
+}
+
+func rollupShop(db *gorm.DB, shopID uint, until time.Time, loc *time.Location) error {
+	var last models.ShopRollup
+	var from time.Time
+	if db.Where("shop_id = ? AND granularity = ?", shopID, Hour).Order("period_start DESC").Limit(1).Find(&last); last.ID != 0 {
+		from = last.PeriodStart.Add(time.Hour)
+	} else {
+		var first models.Snapshot
+		if db.Where("shop_id = ?", shopID).Order("timestamp").Limit(1).Find(&first); first.ID == 0 {
+			return nil
+		}
+		from = first.Timestamp.Truncate(time.Hour)
+	}
+
+	// 按天分批处理，避免首次运行时一次加载全部历史数据
+	for start := from; start.Before(until); start = start.Add(24 * time.Hour) {
+		end := start.Add(24 * time.Hour)
+		if end.After(until) {
+			end = until
+		}
+		if err := rollupHours(db, shopID, start, end); err != nil {
+			return err
+		}
+	}
+	return rollupDays(db, shopID, until, loc)
+}
+
+func rollupHours(db *gorm.DB, shopID uint, start, end time.Time) error {
+	var snapshots []Sample
+	err := db.Model(&models.Snapshot{}).
+		Select("timestamp, total_devices, used_devices, usage_rate").
+		Where("shop_id = ? AND timestamp >= ? AND timestamp < ?", shopID, start.UTC(), end.UTC()).
+		Order("timestamp").
+		Scan(&snapshots).Error
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+	// 每个快照按其代表的时长加权，跨整点时计入快照所在的小时
+	shopHours := Group(snapshots, end, hourKey)
+
+	var roomRows []struct {
+		RoomID uint
+		Sample
+	}
+	err = db.Table("room_snapshots").
+		Select("room_snapshots.room_id, snapshots.timestamp, room_snapshots.total_devices, room_snapshots.used_devices, room_snapshots.usage_rate").
+		Joins("JOIN snapshots ON snapshots.id = room_snapshots.snapshot_id").
+		Where("snapshots.shop_id = ? AND snapshots.timestamp >= ? AND snapshots.timestamp < ?", shopID, start.UTC(), end.UTC()).
+		Order("snapshots.timestamp").
+		Scan(&roomRows).Error
+	if err != nil {
+		return err
+	}
+	roomSamples := make(map[uint][]Sample)
+	for _, r := range roomRows {
+		roomSamples[r.RoomID] = append(roomSamples[r.RoomID], r.Sample)
+	}
+	roomHours := make(map[uint]map[string]*Aggregate)
+	for roomID, samples := range roomSamples {
+		roomHours[roomID] = Group(samples, end, hourKey)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRollups(tx, shopID, Hour, start, end); err != nil {
+			return err
+		}
+		for hour, a := range shopHours {
+			if err := tx.Create(shopRollup(shopID, Hour, parseHour(hour), a)).Error; err != nil {
+				return err
+			}
+		}
+		for roomID, hours := range roomHours {
+			for hour, a := range hours {
+				if err := tx.Create(roomRollup(roomID, Hour, parseHour(hour), a)).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// rollupDays combines the hourly rollups of every complete day in loc that has no daily rollup yet.
+func rollupDays(db *gorm.DB, shopID uint, until time.Time, loc *time.Location) error {
+	var last, firstHour models.ShopRollup
+	var day time.Time
+	if db.Where("shop_id = ? AND granularity = ?", shopID, Day).Order("period_start DESC").Limit(1).Find(&last); last.ID != 0 {
+		day = last.PeriodStart.In(loc).AddDate(0, 0, 1)
+	} else if db.Where("shop_id = ? AND granularity = ?", shopID, Hour).Order("period_start").Limit(1).Find(&firstHour); firstHour.ID != 0 {
+		y, m, d := firstHour.PeriodStart.In(loc).Date()
+		day = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	} else {
+		return nil
+	}
+
+	for ; !day.AddDate(0, 0, 1).After(until); day = day.AddDate(0, 0, 1) {
+		if err := rollupDay(db, shopID, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollupDay replaces the daily rollups of the day starting at day with the sum of its hourly rollups.
+func rollupDay(db *gorm.DB, shopID uint, day time.Time) error {
+	next := day.AddDate(0, 0, 1)
+	var hours []models.ShopRollup
+	db.Where("shop_id = ? AND granularity = ? AND period_start >= ? AND period_start < ?", shopID, Hour, day.UTC(), next.UTC()).Find(&hours)
+	if len(hours) == 0 {
+		return deleteRollups(db, shopID, Day, day, next)
+	}
+	shopDay := &Aggregate{}
+	for _, h := range hours {
+		shopDay.AddShopRollup(h)
+	}
+
+	var roomHours []models.RoomRollup
+	db.Where("granularity = ? AND period_start >= ? AND period_start < ? AND room_id IN (SELECT id FROM rooms WHERE shop_id = ?)", Hour, day.UTC(), next.UTC(), shopID).Find(&roomHours)
+	roomDays := make(map[uint]*Aggregate)
+	for _, h := range roomHours {
+		if roomDays[h.RoomID] == nil {
+			roomDays[h.RoomID] = &Aggregate{}
+		}
+		roomDays[h.RoomID].AddRoomRollup(h)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRollups(tx, shopID, Day, day, next); err != nil {
+			return err
+		}
+		if err := tx.Create(shopRollup(shopID, Day, day, shopDay)).Error; err != nil {
+			return err
+		}
+		for roomID, a := range roomDays {
+			if err := tx.Create(roomRollup(roomID, Day, day, a)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Rebuild recomputes the rollups of shopID that cover [start, end), after the raw snapshots
+// in that range have been rewritten. Hours and days that are not complete yet are left to Run.
+func Rebuild(db *gorm.DB, shopID uint, start, end time.Time, loc *time.Location) error {
+	until := time.Now().Truncate(time.Hour)
+	if end.After(until) {
+		end = until
+	}
+	start = start.Truncate(time.Hour)
+	if !start.Before(end) {
+		return nil
+	}
+	for batch := start; batch.Before(end); batch = batch.Add(24 * time.Hour) {
+		batchEnd := batch.Add(24 * time.Hour)
+		if batchEnd.After(end) {
+			batchEnd = end
+		}
+		if err := rollupHours(db, shopID, batch, batchEnd); err != nil {
+			return err
+		}
+	}
+
+	y, m, d := start.In(loc).Date()
+	for day := time.Date(y, m, d, 0, 0, 0, 0, loc); day.Before(end) && !day.AddDate(0, 0, 1).After(until); day = day.AddDate(0, 0, 1) {
+		if err := rollupDay(db, shopID, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteRollups(tx *gorm.DB, shopID uint, granularity string, start, end time.Time) error {
+	err := tx.Where("shop_id = ? AND granularity = ? AND period_start >= ? AND period_start < ?", shopID, granularity, start.UTC(), end.UTC()).
+		Delete(&models.ShopRollup{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("granularity = ? AND period_start >= ? AND period_start < ? AND room_id IN (SELECT id FROM rooms WHERE shop_id = ?)", granularity, start.UTC(), end.UTC(), shopID).
+		Delete(&models.RoomRollup{}).Error
+}
+
+func hourKey(s Sample) string {
+	return s.Timestamp.UTC().Truncate(time.Hour).Format(time.RFC3339)
+}
+
+func parseHour(key string) time.Time {
+	hour, _ := time.Parse(time.RFC3339, key)
+	return hour
+}
+
+// Period starts are stored in UTC so lookups don't depend on the zone of the caller.
+func shopRollup(shopID uint, granularity string, start time.Time, a *Aggregate) *models.ShopRollup {
+	return &models.ShopRollup{
+		ShopID:         shopID,
+		Granularity:    granularity,
+		PeriodStart:    start.UTC(),
+		Samples:        a.Samples,
+		Minutes:        a.Minutes,
+		TotalDevices:   a.TotalDevices,
+		AvgUsageRate:   a.AvgUsageRate(),
+		MaxUsageRate:   a.MaxUsageRate,
+		AvgUsedDevices: a.AvgUsedDevices(),
+		MaxUsedDevices: a.MaxUsedDevices,
+		DeviceHours:    a.DeviceHours(),
+		PeakMinutes:    a.PeakMinutes,
+	}
+}
+
+func roomRollup(roomID uint, granularity string, start time.Time, a *Aggregate) *models.RoomRollup {
+	return &models.RoomRollup{
+		RoomID:         roomID,
+		Granularity:    granularity,
+		PeriodStart:    start.UTC(),
+		Samples:        a.Samples,
+		Minutes:        a.Minutes,
+		TotalDevices:   a.TotalDevices,
+		AvgUsageRate:   a.AvgUsageRate(),
+		MaxUsageRate:   a.MaxUsageRate,
+		AvgUsedDevices: a.AvgUsedDevices(),
+		MaxUsedDevices: a.MaxUsedDevices,
+		DeviceHours:    a.DeviceHours(),
+		PeakMinutes:    a.PeakMinutes,
+	}
+}
+
+// Prune deletes raw snapshots older than retentionDays days (counted from the start of
+// today in loc) after making sure they have been rolled up. Rollups are kept forever.
+func Prune(db *gorm.DB, retentionDays int, loc *time.Location) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	if err := Run(db, loc); err != nil {
+		return 0, err
+	}
+
+	y, m, d := time.Now().In(loc).Date()
+	cutoff := time.Date(y, m, d, 0, 0, 0, 0, loc).AddDate(0, 0, -retentionDays)
+
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("DELETE FROM room_snapshots WHERE snapshot_id IN (SELECT id FROM snapshots WHERE timestamp < ?)", cutoff.UTC()).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Where("timestamp < ?", cutoff.UTC()).Delete(&models.Snapshot{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune snapshots: %w", err)
+	}
+	log.Printf("Pruned %d snapshots older than %s", deleted, cutoff.Format("2006-01-02"))
+	return deleted, nil
+}
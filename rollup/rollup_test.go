@@ -0,0 +1,129 @@
+package rollup
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wywk/db/dbtest"
+	"wywk/models"
+)
+
+var (
+	cst      = time.FixedZone("CST", 8*3600)
+	dayStart = time.Date(2026, 3, 2, 0, 0, 0, 0, cst)
+)
+
+// usedAt is the number of used devices out of 10 in hour h of the seeded day.
+func usedAt(h int) int {
+	if h == 20 {
+		return 10 // 满座，计入高峰时长
+	}
+	return h % 5 * 2
+}
+
+// seed stores a shop with one four-device room polled every ten minutes of dayStart,
+// except between 12:00 and 14:00.
+func seed(t *testing.T, database *gorm.DB) (models.Shop, models.Room) {
+	t.Helper()
+	shop := models.Shop{CommonCode: "A", Name: "A"}
+	if err := database.Create(&shop).Error; err != nil {
+		t.Fatal(err)
+	}
+	room := models.Room{ShopID: shop.ID, Code: "R1", Name: "R1", TotalDevices: 4}
+	if err := database.Create(&room).Error; err != nil {
+		t.Fatal(err)
+	}
+	for m := 0; m < 24*60; m += 10 {
+		h := m / 60
+		if h == 12 || h == 13 {
+			continue
+		}
+		used, roomUsed := usedAt(h), min(usedAt(h), 4)
+		snapshot := models.Snapshot{
+			ShopID: shop.ID, Timestamp: dayStart.Add(time.Duration(m) * time.Minute).UTC(), ShopStatus: "营业中",
+			TotalDevices: 10, UsedDevices: used, UsageRate: float64(used) * 10,
+			RoomSnapshots: []models.RoomSnapshot{{RoomID: room.ID, TotalDevices: 4, UsedDevices: roomUsed, UsageRate: float64(roomUsed) * 25}},
+		}
+		if err := database.Create(&snapshot).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return shop, room
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRebuild(t *testing.T) {
+	defer SetCrawlInterval(CrawlInterval())
+	SetCrawlInterval(10 * time.Minute)
+
+	dbtest.Each(t, func(t *testing.T, database *gorm.DB) {
+		shop, room := seed(t, database)
+		end := dayStart.AddDate(0, 0, 1)
+		// 重复执行结果不变
+		for i := 0; i < 2; i++ {
+			if err := Rebuild(database, shop.ID, dayStart, end, cst); err != nil {
+				t.Fatalf("Rebuild: %v", err)
+			}
+		}
+
+		var hours []models.ShopRollup
+		database.Where("shop_id = ? AND granularity = ?", shop.ID, Hour).Order("period_start").Find(&hours)
+		if len(hours) != 22 {
+			t.Fatalf("got %d hourly rollups, want 22", len(hours))
+		}
+		var minutes, rateMinutes, deviceHours float64
+		for _, r := range hours {
+			h := r.PeriodStart.In(cst).Hour()
+			want := 60.0
+			if h == 11 {
+				want = 65 // 11:50 的快照跨过缺口，只计 MaxSpan
+			}
+			if r.Samples != 6 || !near(r.Minutes, want) {
+				t.Errorf("hour %02d: %d samples over %v minutes, want 6 over %v", h, r.Samples, r.Minutes, want)
+			}
+			if rate := float64(usedAt(h)) * 10; !near(r.AvgUsageRate, rate) || !near(r.MaxUsageRate, rate) {
+				t.Errorf("hour %02d: usage %v (max %v), want %v", h, r.AvgUsageRate, r.MaxUsageRate, rate)
+			}
+			if wantHours := float64(usedAt(h)) * want / 60; !near(r.DeviceHours, wantHours) {
+				t.Errorf("hour %02d: %v device hours, want %v", h, r.DeviceHours, wantHours)
+			}
+			minutes += want
+			rateMinutes += float64(usedAt(h)) * 10 * want
+			deviceHours += float64(usedAt(h)) * want / 60
+		}
+
+		var days []models.ShopRollup
+		database.Where("shop_id = ? AND granularity = ?", shop.ID, Day).Find(&days)
+		if len(days) != 1 {
+			t.Fatalf("got %d daily rollups, want 1", len(days))
+		}
+		day := days[0]
+		if !day.PeriodStart.Equal(dayStart) {
+			t.Errorf("daily rollup starts at %v, want %v", day.PeriodStart, dayStart)
+		}
+		if day.Samples != 132 || !near(day.Minutes, minutes) {
+			t.Errorf("day: %d samples over %v minutes, want 132 over %v", day.Samples, day.Minutes, minutes)
+		}
+		if !near(day.AvgUsageRate, rateMinutes/minutes) || day.MaxUsageRate != 100 || day.MaxUsedDevices != 10 {
+			t.Errorf("day: usage %v (max %v, %d devices), want %v (max 100, 10 devices)", day.AvgUsageRate, day.MaxUsageRate, day.MaxUsedDevices, rateMinutes/minutes)
+		}
+		if !near(day.DeviceHours, deviceHours) || day.PeakMinutes != 60 {
+			t.Errorf("day: %v device hours, %v peak minutes, want %v and 60", day.DeviceHours, day.PeakMinutes, deviceHours)
+		}
+
+		var roomDays []models.RoomRollup
+		database.Where("room_id = ? AND granularity = ?", room.ID, Day).Find(&roomDays)
+		if len(roomDays) != 1 {
+			t.Fatalf("got %d daily room rollups, want 1", len(roomDays))
+		}
+		if r := roomDays[0]; r.Samples != 132 || r.MaxUsedDevices != 4 || r.MaxUsageRate != 100 || r.TotalDevices != 4 {
+			t.Errorf("room day = %+v, want 132 samples, 4 of 4 devices used at most", r)
+		}
+	})
+}